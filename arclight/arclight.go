@@ -1,15 +1,123 @@
 package arclight
 
-/*
+import (
+	"fmt"
+	"io"
+	slashpath "path"
+	"strings"
+	"sync"
+)
+
+// Archive formats that Specialize() can open, keyed by MIME type.
+// Constructors return nil for files that turn out not to be archives,
+// such as compressed files that don't hold a tar.
+var ArchiveTypes = map[string]func(VfsFileNode) VfsDirFileNode{
+	"application/zip":    NewZipArchive,
+	"application/x-tar":  NewTarArchive,
+	"application/gzip":   NewGzipTarArchive,
+	"application/x-gzip": NewGzipTarArchive,
+	"application/x-xz":   NewXzTarArchive,
+}
+
+// If a file is an archive we know how to open, return it as an archive.
+// Otherwise return it unchanged.
 func Specialize(orig VfsNode) VfsNode {
-	if file, ok := orig.(VfsFileNode); ok {
-		DetectMimeTypes(file)
-		if mimetype, ok := file.Attrs()["mimetype"]; ok {
-			if mimetype == "application/zip" {
-				return NewZipArchive(file)
-			}
+	file, ok := orig.(VfsFileNode)
+	if !ok {
+		return orig
+	}
+	if _, ok := orig.(VfsDir); ok {
+		// already an archive
+		return orig
+	}
+
+	mediatype, _ := file.MimeType()
+	if newArchive, ok := ArchiveTypes[mediatype]; ok {
+		if archive := newArchive(file); archive != nil {
+			return archive
 		}
 	}
 	return orig
 }
-*/
+
+// Resolve a slash-separated path one component at a time,
+// descending into archives along the way: "backup.zip/docs/a.txt".
+// The node at the end of the path is specialized too.
+func ResolvePath(root VfsNode, path string) (VfsNode, error) {
+	return resolvePath(root, path, Specialize)
+}
+
+func resolvePath(root VfsNode, path string, specialize func(VfsNode) VfsNode) (VfsNode, error) {
+	node := specialize(root)
+	path = strings.Trim(slashpath.Clean("/"+path), "/")
+	if path == "" {
+		return node, nil
+	}
+
+	resolved := ""
+	for _, name := range strings.Split(path, "/") {
+		dir, ok := node.(VfsDir)
+		if !ok {
+			return nil, fmt.Errorf("Not a directory or archive: %s", resolved)
+		}
+		child, err := dir.Resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		node = specialize(child)
+		resolved = slashpath.Join(resolved, name)
+	}
+	return node, nil
+}
+
+// Keeps track of the archives it opens, so they can all be closed when they're no longer needed,
+// such as at the end of a request. Archives that hold nothing open are not tracked.
+type Archives struct {
+	mutex  sync.Mutex
+	opened []io.Closer
+}
+
+// Like Specialize(), but the archive is closed by Close().
+func (archives *Archives) Specialize(orig VfsNode) VfsNode {
+	if _, isDir := orig.(VfsDir); isDir {
+		return orig
+	}
+	node := Specialize(orig)
+	if closer, ok := node.(io.Closer); ok {
+		archives.mutex.Lock()
+		archives.opened = append(archives.opened, closer)
+		archives.mutex.Unlock()
+	}
+	return node
+}
+
+// Like ResolvePath(), but the archives along the way are closed by Close().
+func (archives *Archives) ResolvePath(root VfsNode, path string) (VfsNode, error) {
+	return resolvePath(root, path, archives.Specialize)
+}
+
+// Hand the archives opened so far over to a new Archives,
+// for work that outlives the current one, such as a background job.
+func (archives *Archives) Take() *Archives {
+	archives.mutex.Lock()
+	defer archives.mutex.Unlock()
+	taken := &Archives{opened: archives.opened}
+	archives.opened = nil
+	return taken
+}
+
+// Close every archive opened so far, nested archives before the archives that contain them.
+func (archives *Archives) Close() error {
+	archives.mutex.Lock()
+	opened := archives.opened
+	archives.opened = nil
+	archives.mutex.Unlock()
+
+	var firstErr error
+	for i := len(opened) - 1; i >= 0; i-- {
+		if err := opened[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,229 @@
+package arclight
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func zipBytes(t *testing.T, method uint16, files map[string][]byte) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, contents := range files {
+		fw, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(contents); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Paths that cross into an archive nested inside another archive
+func TestResolvePath_NestedArchives(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestResolvePath")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	inner := zipBytes(t, zip.Deflate, map[string][]byte{
+		"docs/a.txt": []byte("nested hello"),
+	})
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		outer := zipBytes(t, method, map[string][]byte{
+			"inner.zip": inner,
+		})
+		err := ioutil.WriteFile(filepath.Join(tempdir, "outer.zip"), outer, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fi, err := os.Stat(tempdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := ResolvePath(NewOsDir(tempdir, fi), "outer.zip/inner.zip/docs/a.txt")
+		if err != nil {
+			t.Fatalf("Couldn't resolve path with method %d: %v", method, err)
+		}
+		reader, err := node.(VfsFile).Open()
+		if err != nil {
+			t.Fatalf("Couldn't open file with method %d: %v", method, err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("Couldn't read file with method %d: %v", method, err)
+		}
+		if string(contents) != "nested hello" {
+			t.Errorf("Expected %q, got %q", "nested hello", contents)
+		}
+	}
+}
+
+// Archives opened on the way to a path are closed together, inner ones first
+func TestArchives_Close(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestArchives")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	inner := zipBytes(t, zip.Deflate, map[string][]byte{
+		"docs/a.txt": []byte("nested hello"),
+	})
+	outer := zipBytes(t, zip.Deflate, map[string][]byte{
+		"inner.zip": inner,
+	})
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "outer.zip"), outer, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archives := new(Archives)
+	node, err := archives.ResolvePath(NewOsDir(tempdir, fi), "outer.zip/inner.zip/docs/a.txt")
+	if err != nil {
+		t.Fatalf("Couldn't resolve path: %v", err)
+	}
+	if _, ok := node.(VfsFile); !ok {
+		t.Fatalf("Expected a file, got %T", node)
+	}
+	if len(archives.opened) != 2 {
+		t.Fatalf("Expected 2 open archives, got %d", len(archives.opened))
+	}
+	opened := archives.opened
+
+	if err := archives.Close(); err != nil {
+		t.Fatalf("Couldn't close archives: %v", err)
+	}
+	if len(archives.opened) != 0 {
+		t.Errorf("Expected no open archives after Close, got %d", len(archives.opened))
+	}
+	for _, closer := range opened {
+		arc := closer.(*ZipArchive)
+		if arc.reader != nil {
+			t.Errorf("Expected %s to be closed", arc.Name())
+		}
+		if _, err := arc.Children(); err == nil {
+			t.Errorf("Expected an error listing closed archive %s", arc.Name())
+		}
+	}
+}
+
+// A file in memory that counts how often it's opened
+type countingFile struct {
+	name  string
+	data  []byte
+	opens int
+}
+
+func (file *countingFile) Name() string                          { return file.name }
+func (file *countingFile) ModTime() time.Time                    { return time.Time{} }
+func (file *countingFile) Attrs() NodeAttrs                      { return NodeAttrs{} }
+func (file *countingFile) MimeType() (string, map[string]string) { return "application/zip", nil }
+func (file *countingFile) Size() int64                           { return int64(len(file.data)) }
+
+func (file *countingFile) Open() (io.ReadCloser, error) {
+	file.opens++
+	return ioutil.NopCloser(bytes.NewReader(file.data)), nil
+}
+
+// Listing and reading an archive's members opens the archive once
+func TestZipArchive_OpenOnce(t *testing.T) {
+	file := &countingFile{
+		name: "a.zip",
+		data: zipBytes(t, zip.Deflate, map[string][]byte{
+			"docs/a.txt": []byte("hello a"),
+			"docs/b.txt": []byte("hello b"),
+		}),
+	}
+	arc := NewZipArchive(file)
+	dir, err := arc.Resolve("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := dir.(VfsDir).Children()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 {
+		t.Fatalf("Expected 2 children, got %d", len(children))
+	}
+	for _, child := range children {
+		child.MimeType()
+		reader, err := child.(VfsFile).Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != "hello "+child.Name()[:1] {
+			t.Errorf("Unexpected contents of %s: %q", child.Name(), contents)
+		}
+	}
+	if file.opens != 1 {
+		t.Errorf("Expected the archive to be opened once, but it was opened %d times", file.opens)
+	}
+}
+
+// Members of a tar are only read once to find their MIME types,
+// however many times they're looked up
+func TestTarArchive_SniffOnce(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	contents := []byte("hello tar")
+	if err := tw.WriteHeader(&tar.Header{Name: "docs/a.txt", Mode: 0644, Size: int64(len(contents))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := &countingFile{name: "a.tar", data: buf.Bytes()}
+
+	sniffs := 0
+	defer func(orig func(func() (io.ReadCloser, error)) (string, map[string]string)) {
+		MimeTypeFromReader = orig
+	}(MimeTypeFromReader)
+	MimeTypeFromReader = func(open func() (io.ReadCloser, error)) (string, map[string]string) {
+		sniffs++
+		return "text/plain", nil
+	}
+
+	arc := NewTarArchive(file)
+	for i := 0; i < 3; i++ {
+		node, err := arc.Resolve("docs/a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mediatype, _ := node.MimeType(); mediatype != "text/plain" {
+			t.Errorf("Expected text/plain, got %s", mediatype)
+		}
+	}
+	if sniffs != 1 {
+		t.Errorf("Expected one sniff, got %d", sniffs)
+	}
+	if file.opens != 1 {
+		t.Errorf("Expected the headers to be read once, but the archive was opened %d times", file.opens)
+	}
+}
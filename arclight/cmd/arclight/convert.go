@@ -0,0 +1,241 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	slashpath "path"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+	"github.com/ulikunitz/xz"
+)
+
+// What each output format can hold, beyond names and contents.
+// Every format keeps permissions and symbolic links; none keep devices or pipes.
+type outputFormat struct {
+	name            string
+	comments        bool
+	archiveComment  bool
+	ownership       bool
+	subsecondMtimes bool
+}
+
+var outputFormats = map[string]outputFormat{
+	"zip":    {"zip", true, true, false, false},
+	"tar":    {"tar", true, false, true, false},
+	"tar.gz": {"tar.gz", true, false, true, false},
+	"tar.xz": {"tar.xz", true, false, true, false},
+	"dir":    {"dir", false, false, false, true},
+}
+
+// Guess the output format from the destination's name. Anything without an archive extension is a directory.
+func formatForPath(path string) outputFormat {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return outputFormats["zip"]
+	case strings.HasSuffix(lower, ".tar"):
+		return outputFormats["tar"]
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return outputFormats["tar.gz"]
+	case strings.HasSuffix(lower, ".tar.xz"), strings.HasSuffix(lower, ".txz"):
+		return outputFormats["tar.xz"]
+	}
+	return outputFormats["dir"]
+}
+
+func runConvert(args []string) error {
+	flags := newFlagSet("convert")
+	formatName := flags.String("format", "", "zip, tar, tar.gz, tar.xz, or dir (default: from dest's extension)")
+	mtime := flags.String("mtime", "", "give every entry this RFC 3339 modification time")
+	overwrite := flags.Bool("overwrite", false, "replace existing files")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src, dest := flags.Arg(0), flags.Arg(1)
+
+	format := formatForPath(dest)
+	if *formatName != "" {
+		var ok bool
+		if format, ok = outputFormats[*formatName]; !ok {
+			return fmt.Errorf("Unknown format %#v", *formatName)
+		}
+	}
+	var fixedModTime time.Time
+	if *mtime != "" {
+		var err error
+		if fixedModTime, err = time.Parse(time.RFC3339, *mtime); err != nil {
+			return err
+		}
+	}
+
+	node, err := resolve(src)
+	if err != nil {
+		return err
+	}
+	root, ok := node.(arclight.VfsDirNode)
+	if !ok {
+		return fmt.Errorf("%s: not a directory or archive", src)
+	}
+
+	report := newLossReport()
+	if err := report.check(root, "", format, !fixedModTime.IsZero()); err != nil {
+		return err
+	}
+
+	if format.name == "dir" {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		ex := &extractor{overwrite: *overwrite}
+		err = ex.extractDir(root, dest)
+	} else {
+		err = writeArchive(root, dest, format, fixedModTime, *overwrite)
+	}
+	if err != nil {
+		return err
+	}
+
+	report.write(os.Stderr)
+	return nil
+}
+
+// Write an archive file, removing it again if anything goes wrong.
+func writeArchive(root arclight.VfsDirNode, dest string, format outputFormat, fixedModTime time.Time, overwrite bool) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if overwrite {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(dest, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if err := exportArchive(f, root, format, fixedModTime); err != nil {
+		f.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return nil
+}
+
+func exportArchive(w io.Writer, root arclight.VfsDirNode, format outputFormat, fixedModTime time.Time) error {
+	tarOpts := arclight.TarExportOptions{FixedModTime: fixedModTime}
+	switch format.name {
+	case "zip":
+		return arclight.ExportZip(w, root, arclight.ZipExportOptions{FixedModTime: fixedModTime})
+	case "tar":
+		return arclight.ExportTar(w, root, tarOpts)
+	case "tar.gz":
+		gz := gzip.NewWriter(w)
+		if err := arclight.ExportTar(gz, root, tarOpts); err != nil {
+			return err
+		}
+		return gz.Close()
+	case "tar.xz":
+		xzw, err := xz.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := arclight.ExportTar(xzw, root, tarOpts); err != nil {
+			return err
+		}
+		return xzw.Close()
+	}
+	return fmt.Errorf("Can't write %s archives", format.name)
+}
+
+// Metadata that the output format can't hold, collected before converting
+// so the user finds out what didn't make it across.
+type lossReport struct {
+	kinds   []string
+	counts  map[string]int
+	samples map[string][]string
+}
+
+// Paths listed for each kind of loss; the rest are only counted.
+const lossSamples = 3
+
+func newLossReport() *lossReport {
+	report := new(lossReport)
+	report.counts = make(map[string]int)
+	report.samples = make(map[string][]string)
+	return report
+}
+
+func (report *lossReport) add(kind string, path string) {
+	if report.counts[kind] == 0 {
+		report.kinds = append(report.kinds, kind)
+	}
+	report.counts[kind]++
+	if len(report.samples[kind]) < lossSamples {
+		report.samples[kind] = append(report.samples[kind], path)
+	}
+}
+
+func (report *lossReport) check(dir arclight.VfsDirNode, path string, format outputFormat, fixedModTime bool) error {
+	if path == "" && !format.archiveComment && arclight.Comment(dir) != "" {
+		report.add("archive comment dropped", "/")
+	}
+	children, err := sortedChildren(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, child := range children {
+		childPath := slashpath.Join(path, child.Name())
+		if arclight.IsSpecial(child) {
+			report.add("devices and pipes skipped", childPath)
+			continue
+		}
+		if !format.comments && arclight.Comment(child) != "" {
+			report.add("comments dropped", childPath)
+		}
+		if !format.ownership && hasOwner(child) {
+			report.add("ownership dropped", childPath)
+		}
+		if !format.subsecondMtimes && !fixedModTime && child.ModTime().Nanosecond() != 0 {
+			report.add("modification times rounded to seconds", childPath)
+		}
+		if childDir, ok := child.(arclight.VfsDirNode); ok {
+			if err := report.check(childDir, childPath, format, fixedModTime); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasOwner(node arclight.VfsNode) bool {
+	attrs := node.Attrs()
+	for _, key := range []string{"tar.uname", "tar.gname", "tar.uid", "tar.gid"} {
+		if attrs[key] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (report *lossReport) write(w io.Writer) {
+	if len(report.kinds) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Warnings:")
+	for _, kind := range report.kinds {
+		count := report.counts[kind]
+		samples := strings.Join(report.samples[kind], ", ")
+		if count > len(report.samples[kind]) {
+			samples += ", ..."
+		}
+		fmt.Fprintf(w, "  %s: %d (%s)\n", kind, count, samples)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+func runExtract(args []string) error {
+	flags := newFlagSet("extract")
+	overwrite := flags.Bool("overwrite", false, "replace existing files")
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dest := "."
+	if flags.NArg() == 2 {
+		dest = flags.Arg(1)
+	}
+
+	node, err := resolve(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	dir, ok := node.(arclight.VfsDir)
+	if !ok {
+		return fmt.Errorf("%s: not a directory or archive", flags.Arg(0))
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	ex := &extractor{overwrite: *overwrite}
+	return ex.extractDir(dir, dest)
+}
+
+type extractor struct {
+	overwrite bool
+}
+
+// Archive entries can have any name at all, but only plain names are safe to write.
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("Unsafe name %#v", name)
+	}
+	return nil
+}
+
+// Only permission bits are applied; setuid and friends from an archive aren't trusted.
+// Directory permissions are set after their contents are written, in case they're read-only.
+func (ex *extractor) extractDir(dir arclight.VfsDir, path string) error {
+	children, err := sortedChildren(dir)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, child := range children {
+		if err := checkName(child.Name()); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		childPath := filepath.Join(path, child.Name())
+		if arclight.IsSpecial(child) {
+			continue
+		}
+
+		target, isLink, err := arclight.LinkTarget(child)
+		if err != nil {
+			return fmt.Errorf("%s: %v", childPath, err)
+		}
+		if isLink {
+			if err := ex.extractLink(target, childPath); err != nil {
+				return err
+			}
+			// os.Chtimes would follow the link
+			continue
+		}
+
+		if file, ok := child.(arclight.VfsFile); ok {
+			if err := ex.extractFile(file, arclight.NodePerm(child, 0644).Perm(), childPath); err != nil {
+				return err
+			}
+		} else if childDir, ok := child.(arclight.VfsDir); ok {
+			if err := os.Mkdir(childPath, 0755); err != nil && !os.IsExist(err) {
+				return err
+			}
+			// don't follow a symlink that was already there out of dest
+			if fi, err := os.Lstat(childPath); err != nil || !fi.IsDir() {
+				return fmt.Errorf("%s: not a directory", childPath)
+			}
+			if err := ex.extractDir(childDir, childPath); err != nil {
+				return err
+			}
+			if err := os.Chmod(childPath, arclight.NodePerm(child, 0755).Perm()); err != nil {
+				return err
+			}
+		} else {
+			continue
+		}
+		if !child.ModTime().IsZero() {
+			if err := os.Chtimes(childPath, child.ModTime(), child.ModTime()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ex *extractor) extractLink(target string, path string) error {
+	if ex.overwrite {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Symlink(target, path)
+}
+
+func (ex *extractor) extractFile(file arclight.VfsFile, perm os.FileMode, path string) error {
+	if ex.overwrite {
+		// remove rather than truncate, so a symlink is replaced instead of followed
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	reader, err := file.Open()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	defer reader.Close()
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return f.Close()
+}
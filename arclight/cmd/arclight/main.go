@@ -0,0 +1,327 @@
+// Command-line access to arclight trees. Paths can cross into archives:
+//
+//	arclight ls -l backup.zip/docs
+//	arclight cat backup.zip/docs/a.txt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+type command struct {
+	run   func(args []string) error
+	usage string
+}
+
+var commands map[string]command
+
+// Where commands write their output. Tests replace it.
+var stdout io.Writer = os.Stdout
+
+func init() {
+	commands = map[string]command{
+		"ls":      {runLs, "ls [-l] path...\n\tList directories and archives."},
+		"tree":    {runTree, "tree [-archives=false] path...\n\tList everything below a directory or archive."},
+		"cat":     {runCat, "cat path...\n\tWrite file contents to standard output."},
+		"stat":    {runStat, "stat path...\n\tShow everything arclight knows about a node."},
+		"extract": {runExtract, "extract [-overwrite] path [dest]\n\tCopy the contents of a directory or archive into dest."},
+		"convert": {runConvert, "convert [-format f] [-mtime t] [-overwrite] src dest\n\tRepack a directory or archive as zip, tar, tar.gz, tar.xz, or a directory."},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: arclight command [flags] [args]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "arclight: unknown command %#v\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "arclight %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: arclight %s\n", commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// Find the node for an OS path that may continue into archives.
+// Paths are made absolute first, so .. works the way it does in the shell.
+func resolve(path string) (arclight.VfsNode, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat("/")
+	if err != nil {
+		return nil, err
+	}
+	node, err := arclight.ResolvePath(arclight.NewOsDir("/", fi), filepath.ToSlash(abs))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return node, nil
+}
+
+// Is this node an archive we could descend into?
+// Compressed files are only archives if there's a tar inside.
+func isArchive(node arclight.VfsNode) bool {
+	if _, ok := node.(arclight.VfsDir); ok {
+		_, isFile := node.(arclight.VfsFile)
+		return isFile
+	}
+	archive := arclight.Specialize(node)
+	if closer, ok := archive.(io.Closer); ok {
+		closer.Close()
+	}
+	_, ok := archive.(arclight.VfsDir)
+	return ok
+}
+
+type byName []arclight.VfsNode
+
+func (nodes byName) Len() int {
+	return len(nodes)
+}
+
+func (nodes byName) Swap(i, j int) {
+	nodes[i], nodes[j] = nodes[j], nodes[i]
+}
+
+func (nodes byName) Less(i, j int) bool {
+	return nodes[i].Name() < nodes[j].Name()
+}
+
+func sortedChildren(dir arclight.VfsDir) ([]arclight.VfsNode, error) {
+	children, err := dir.Children()
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(byName(children))
+	return children, nil
+}
+
+func runLs(args []string) error {
+	flags := newFlagSet("ls")
+	long := flags.Bool("l", false, "show type, size, modification time, and MIME type")
+	flags.Parse(args)
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 8, 1, ' ', tabwriter.AlignRight)
+	for i, path := range paths {
+		node, err := resolve(path)
+		if err != nil {
+			return err
+		}
+		nodes := []arclight.VfsNode{node}
+		if dir, ok := node.(arclight.VfsDir); ok {
+			if nodes, err = sortedChildren(dir); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		if len(paths) > 1 {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", path)
+		}
+		for _, child := range nodes {
+			if *long {
+				writeLongEntry(w, child)
+			} else {
+				fmt.Fprintln(w, child.Name())
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// One ls -l line: type, size, mtime, MIME type, name.
+// Types are d for directories, a for archives, and - for other files.
+func writeLongEntry(w io.Writer, node arclight.VfsNode) {
+	nodeType, size := "-", ""
+	switch {
+	case isArchive(node):
+		nodeType = "a"
+	case isDir(node):
+		nodeType = "d"
+	}
+	if file, ok := node.(arclight.VfsFile); ok {
+		size = fmt.Sprintf("%d", file.Size())
+	}
+	mtime := ""
+	if !node.ModTime().IsZero() {
+		mtime = node.ModTime().Format("2006-01-02 15:04")
+	}
+	mediatype, _ := node.MimeType()
+	fmt.Fprintf(w, "%s\t%s\t %s\t %s\t %s\n", nodeType, size, mtime, mediatype, node.Name())
+}
+
+func isDir(node arclight.VfsNode) bool {
+	_, ok := node.(arclight.VfsDir)
+	return ok
+}
+
+func runTree(args []string) error {
+	flags := newFlagSet("tree")
+	archives := flags.Bool("archives", true, "descend into archives")
+	flags.Parse(args)
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	for _, path := range paths {
+		node, err := resolve(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, path)
+		if err := printTree(node, "", *archives); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func printTree(node arclight.VfsNode, indent string, archives bool) error {
+	dir, ok := node.(arclight.VfsDir)
+	if !ok {
+		return nil
+	}
+	children, err := sortedChildren(dir)
+	if err != nil {
+		return err
+	}
+	for i, child := range children {
+		branch, more := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, more = "└── ", "    "
+		}
+		if archives {
+			child = arclight.Specialize(child)
+		}
+		name := child.Name()
+		if isDir(child) {
+			name += "/"
+		}
+		fmt.Fprintln(stdout, indent+branch+name)
+		if err := printTree(child, indent+more, archives); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCat(args []string) error {
+	flags := newFlagSet("cat")
+	flags.Parse(args)
+	for _, path := range flags.Args() {
+		node, err := resolve(path)
+		if err != nil {
+			return err
+		}
+		file, ok := node.(arclight.VfsFile)
+		if !ok {
+			return fmt.Errorf("%s: not a file", path)
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		_, err = io.Copy(stdout, reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func runStat(args []string) error {
+	flags := newFlagSet("stat")
+	flags.Parse(args)
+	for i, path := range flags.Args() {
+		node, err := resolve(path)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Fprintln(stdout)
+		}
+		printStat(path, node)
+	}
+	return nil
+}
+
+func printStat(path string, node arclight.VfsNode) {
+	w := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	nodeType := "file"
+	switch {
+	case isArchive(node):
+		nodeType = "archive"
+	case isDir(node):
+		nodeType = "directory"
+	}
+	fmt.Fprintf(w, "Path:\t%s\n", path)
+	fmt.Fprintf(w, "Name:\t%s\n", node.Name())
+	fmt.Fprintf(w, "Type:\t%s\n", nodeType)
+	if file, ok := node.(arclight.VfsFile); ok {
+		fmt.Fprintf(w, "Size:\t%d\n", file.Size())
+	}
+	fmt.Fprintf(w, "Modified:\t%s\n", node.ModTime().Format("2006-01-02 15:04:05 -0700"))
+	fmt.Fprintf(w, "MIME type:\t%s\n", mime.FormatMediaType(node.MimeType()))
+
+	attrs := node.Attrs()
+	if len(attrs) > 0 {
+		keys := make([]string, 0, len(attrs))
+		for key := range attrs {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(w, "Attributes:")
+		for _, key := range keys {
+			// multi-line values like Zip comments would break the table
+			value := strings.Replace(attrs[key], "\n", "\\n", -1)
+			fmt.Fprintf(w, "  %s:\t%s\n", key, value)
+		}
+	}
+	w.Flush()
+}
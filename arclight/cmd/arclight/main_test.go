@@ -0,0 +1,176 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A tempdir with docs.zip, which holds docs/a.txt and top.txt,
+// and notes.gz, which is compressed but isn't an archive.
+func testDir(t *testing.T) string {
+	tempdir, err := ioutil.TempDir("", "TestArclight")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	for _, name := range []string{"docs/a.txt", "top.txt"} {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte("contents of " + name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "docs.zip"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write([]byte("just some notes\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "notes.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tempdir
+}
+
+// Run a command and return what it wrote.
+func run(t *testing.T, runCommand func(args []string) error, args ...string) string {
+	buf := new(bytes.Buffer)
+	stdout = buf
+	defer func() { stdout = os.Stdout }()
+	if err := runCommand(args); err != nil {
+		t.Fatalf("%v failed: %v", args, err)
+	}
+	return buf.String()
+}
+
+// Compressed files are only listed as archives if there's a tar inside
+func TestLs(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	out := run(t, runLs, "-l", tempdir)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line)
+		name := fields[len(fields)-1]
+		expected := map[string]string{"docs.zip": "a", "notes.gz": "-"}[name]
+		if fields[0] != expected {
+			t.Errorf("Expected type %s for %s, got %s", expected, name, fields[0])
+		}
+	}
+
+	out = run(t, runLs, filepath.Join(tempdir, "docs.zip"))
+	if out != "docs\ntop.txt\n" {
+		t.Errorf("Expected the archive's contents, got %q", out)
+	}
+}
+
+func TestTree(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	out := run(t, runTree, tempdir)
+	expected := tempdir + "\n" +
+		"├── docs.zip/\n" +
+		"│   ├── docs/\n" +
+		"│   │   └── a.txt\n" +
+		"│   └── top.txt\n" +
+		"└── notes.gz\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+
+	out = run(t, runTree, "-archives=false", tempdir)
+	expected = tempdir + "\n" +
+		"├── docs.zip\n" +
+		"└── notes.gz\n"
+	if out != expected {
+		t.Errorf("Expected %q, got %q", expected, out)
+	}
+}
+
+func TestCat(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	out := run(t, runCat, filepath.Join(tempdir, "docs.zip", "docs", "a.txt"))
+	if out != "contents of docs/a.txt" {
+		t.Errorf("Expected %q, got %q", "contents of docs/a.txt", out)
+	}
+}
+
+func TestStat(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"docs.zip", "archive"},
+		{"notes.gz", "file"},
+		{"docs.zip/docs", "directory"},
+		{"docs.zip/top.txt", "file"},
+	}
+	for _, test := range tests {
+		out := run(t, runStat, filepath.Join(tempdir, filepath.FromSlash(test.path)))
+		nodeType := ""
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, "Type:") {
+				nodeType = strings.TrimSpace(strings.TrimPrefix(line, "Type:"))
+			}
+		}
+		if nodeType != test.expected {
+			t.Errorf("%s: expected type %s, got %s", test.path, test.expected, nodeType)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	dest := filepath.Join(tempdir, "out")
+	run(t, runExtract, filepath.Join(tempdir, "docs.zip"), dest)
+	for _, name := range []string{"docs/a.txt", "top.txt"} {
+		contents, err := ioutil.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Couldn't read %s: %v", name, err)
+		} else if string(contents) != "contents of "+name {
+			t.Errorf("Expected %q, got %q", "contents of "+name, contents)
+		}
+	}
+}
+
+// Every output format can be read back with the same contents
+func TestConvert(t *testing.T) {
+	tempdir := testDir(t)
+	defer os.RemoveAll(tempdir)
+
+	for _, name := range []string{"out.zip", "out.tar", "out.tar.gz", "out.tar.xz", "out"} {
+		dest := filepath.Join(tempdir, name)
+		run(t, runConvert, filepath.Join(tempdir, "docs.zip"), dest)
+		out := run(t, runCat, filepath.Join(dest, "docs", "a.txt"))
+		if out != "contents of docs/a.txt" {
+			t.Errorf("%s: expected %q, got %q", name, "contents of docs/a.txt", out)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package arclight
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	slashpath "path"
+	"sort"
+	"time"
+)
+
+const (
+	DiffAdded       = "added"
+	DiffRemoved     = "removed"
+	DiffTypeChanged = "typechanged"
+	DiffModified    = "modified"
+)
+
+// Node types as seen by the differ.
+const (
+	DiffTypeDir         = "dir"
+	DiffTypeImplicitDir = "implicitdir"
+	DiffTypeFile        = "file"
+	DiffTypeArchive     = "archive"
+)
+
+// One difference between two trees.
+type DiffEntry struct {
+	Path   string `json:"path"`
+	Change string `json:"change"`
+	// For modified entries: "size", "mtime", "content", or "digest:<algorithm>".
+	Reason     string     `json:"reason,omitempty"`
+	OldType    string     `json:"oldtype,omitempty"`
+	NewType    string     `json:"newtype,omitempty"`
+	OldSize    int64      `json:"oldsize,omitempty"`
+	NewSize    int64      `json:"newsize,omitempty"`
+	OldModTime *time.Time `json:"oldmtime,omitempty"`
+	NewModTime *time.Time `json:"newmtime,omitempty"`
+}
+
+type DiffOptions struct {
+	// Don't use mtimes to decide whether files are modified.
+	IgnoreModTime bool
+	// Mtimes closer than this are equal. Zip stores mtimes with 2 second resolution.
+	ModTimeWindow time.Duration
+	// Treat directories implied by archive member paths like real directories.
+	MergeImplicitDirs bool
+}
+
+// Preferred digest algorithms when one side of a comparison only has digests.
+var diffDigestOrder = []string{"sha256", "sha1", "md5", "crc32"}
+
+func diffType(node VfsNode, opts *DiffOptions) string {
+	if implicit, ok := node.(VfsImplicit); ok && implicit.Implicit() && !opts.MergeImplicitDirs {
+		return DiffTypeImplicitDir
+	}
+	switch manifestType(node) {
+	case ManifestTypeArchive:
+		return DiffTypeArchive
+	case ManifestTypeDir:
+		return DiffTypeDir
+	default:
+		return DiffTypeFile
+	}
+}
+
+// Compare two trees. Entries are sorted by path.
+// Files are modified if their sizes differ. If sizes match,
+// matching mtimes mean the files are unchanged; otherwise digests or contents decide.
+// If neither digests nor contents are available, differing mtimes decide.
+func Diff(oldRoot, newRoot VfsDirNode, opts DiffOptions) ([]DiffEntry, error) {
+	var entries []DiffEntry
+	err := diffDirs(oldRoot, newRoot, "", &opts, &entries)
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func childMap(dir VfsDir, path string) (map[string]VfsNode, error) {
+	children, err := dir.Children()
+	if err != nil {
+		if path == "" {
+			path = "."
+		}
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	m := make(map[string]VfsNode, len(children))
+	for _, child := range children {
+		m[child.Name()] = child
+	}
+	return m, nil
+}
+
+func diffDirs(oldDir, newDir VfsDir, path string, opts *DiffOptions, entries *[]DiffEntry) error {
+	oldChildren, err := childMap(oldDir, path)
+	if err != nil {
+		return err
+	}
+	newChildren, err := childMap(newDir, path)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(oldChildren)+len(newChildren))
+	for name := range oldChildren {
+		names = append(names, name)
+	}
+	for name := range newChildren {
+		if _, ok := oldChildren[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childPath := slashpath.Join(path, name)
+		oldChild, inOld := oldChildren[name]
+		newChild, inNew := newChildren[name]
+		switch {
+		case !inOld:
+			*entries = append(*entries, newDiffEntry(childPath, DiffAdded, nil, newChild, opts))
+		case !inNew:
+			*entries = append(*entries, newDiffEntry(childPath, DiffRemoved, oldChild, nil, opts))
+		default:
+			if err := diffNodes(oldChild, newChild, childPath, opts, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func diffNodes(oldNode, newNode VfsNode, path string, opts *DiffOptions, entries *[]DiffEntry) error {
+	if diffType(oldNode, opts) != diffType(newNode, opts) {
+		*entries = append(*entries, newDiffEntry(path, DiffTypeChanged, oldNode, newNode, opts))
+		// a directory that became an archive or implicit directory can still be compared member by member
+		oldDir, oldIsDir := oldNode.(VfsDir)
+		newDir, newIsDir := newNode.(VfsDir)
+		if oldIsDir && newIsDir {
+			return diffDirs(oldDir, newDir, path, opts, entries)
+		}
+		return nil
+	}
+
+	if oldFile, ok := oldNode.(VfsFile); ok {
+		reason, err := diffFiles(oldFile, newNode.(VfsFile), oldNode.ModTime(), newNode.ModTime(), opts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if reason != "" {
+			entry := newDiffEntry(path, DiffModified, oldNode, newNode, opts)
+			entry.Reason = reason
+			*entries = append(*entries, entry)
+		}
+	}
+
+	if oldDir, ok := oldNode.(VfsDir); ok {
+		return diffDirs(oldDir, newNode.(VfsDir), path, opts, entries)
+	}
+	return nil
+}
+
+// Returns why two files differ, or "" if they don't.
+func diffFiles(oldFile, newFile VfsFile, oldModTime, newModTime time.Time, opts *DiffOptions) (string, error) {
+	if oldFile.Size() != newFile.Size() {
+		return "size", nil
+	}
+
+	mtimeDiffers := false
+	if !opts.IgnoreModTime {
+		delta := oldModTime.Sub(newModTime)
+		if delta < 0 {
+			delta = -delta
+		}
+		if delta <= opts.ModTimeWindow {
+			return "", nil
+		}
+		mtimeDiffers = true
+	}
+
+	same, reason, err := sameContent(oldFile, newFile)
+	if err == ErrNoContent {
+		if mtimeDiffers {
+			return "mtime", nil
+		}
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if same {
+		return "", nil
+	}
+	return reason, nil
+}
+
+// Compare by digest if either side only knows digests, otherwise by content.
+// Returns ErrNoContent if there's no way to compare them.
+func sameContent(oldFile, newFile VfsFile) (bool, string, error) {
+	oldDigester, oldHasDigests := oldFile.(VfsDigester)
+	newDigester, newHasDigests := newFile.(VfsDigester)
+	if !oldHasDigests && !newHasDigests {
+		same, err := sameBytes(oldFile, newFile)
+		return same, "content", err
+	}
+
+	for _, algorithm := range diffDigestOrder {
+		oldDigest, err := knownDigest(oldFile, oldDigester, oldHasDigests, algorithm)
+		if err == ErrNoContent {
+			continue
+		} else if err != nil {
+			return false, "", err
+		}
+		newDigest, err := knownDigest(newFile, newDigester, newHasDigests, algorithm)
+		if err == ErrNoContent {
+			continue
+		} else if err != nil {
+			return false, "", err
+		}
+		return oldDigest == newDigest, "digest:" + algorithm, nil
+	}
+	return false, "", ErrNoContent
+}
+
+func knownDigest(file VfsFile, digester VfsDigester, hasDigests bool, algorithm string) (string, error) {
+	if hasDigests {
+		if digest, ok := digester.Digest(algorithm); ok {
+			return digest, nil
+		}
+		return "", ErrNoContent
+	}
+	return FileDigest(file, algorithm)
+}
+
+func sameBytes(oldFile, newFile VfsFile) (bool, error) {
+	oldReader, err := oldFile.Open()
+	if err != nil {
+		return false, err
+	}
+	defer oldReader.Close()
+	newReader, err := newFile.Open()
+	if err != nil {
+		return false, err
+	}
+	defer newReader.Close()
+
+	oldChunk := make([]byte, 32*1024)
+	newChunk := make([]byte, len(oldChunk))
+	for {
+		n, oldErr := io.ReadFull(oldReader, oldChunk)
+		m, newErr := io.ReadFull(newReader, newChunk)
+		if !bytes.Equal(oldChunk[:n], newChunk[:m]) {
+			return false, nil
+		}
+		oldDone := oldErr == io.EOF || oldErr == io.ErrUnexpectedEOF
+		newDone := newErr == io.EOF || newErr == io.ErrUnexpectedEOF
+		if oldDone || newDone {
+			return oldDone && newDone, nil
+		}
+		if oldErr != nil {
+			return false, oldErr
+		}
+		if newErr != nil {
+			return false, newErr
+		}
+	}
+}
+
+// Nodes without mtimes, such as manifest entries that don't record them, have zero times.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func newDiffEntry(path, change string, oldNode, newNode VfsNode, opts *DiffOptions) DiffEntry {
+	entry := DiffEntry{
+		Path:   path,
+		Change: change,
+	}
+	if oldNode != nil {
+		entry.OldType = diffType(oldNode, opts)
+		entry.OldModTime = optionalTime(oldNode.ModTime())
+		if file, ok := oldNode.(VfsFile); ok {
+			entry.OldSize = file.Size()
+		}
+	}
+	if newNode != nil {
+		entry.NewType = diffType(newNode, opts)
+		entry.NewModTime = optionalTime(newNode.ModTime())
+		if file, ok := newNode.(VfsFile); ok {
+			entry.NewSize = file.Size()
+		}
+	}
+	return entry
+}
+
+// Write a report with one line per entry:
+// "+" for added, "-" for removed, "!" for type changes, and "M" for modifications.
+func WriteDiffText(w io.Writer, entries []DiffEntry) error {
+	for _, entry := range entries {
+		var err error
+		switch entry.Change {
+		case DiffAdded:
+			_, err = fmt.Fprintf(w, "+ %s (%s)\n", entry.Path, entry.NewType)
+		case DiffRemoved:
+			_, err = fmt.Fprintf(w, "- %s (%s)\n", entry.Path, entry.OldType)
+		case DiffTypeChanged:
+			_, err = fmt.Fprintf(w, "! %s (%s -> %s)\n", entry.Path, entry.OldType, entry.NewType)
+		case DiffModified:
+			switch entry.Reason {
+			case "size":
+				_, err = fmt.Fprintf(w, "M %s (size %d -> %d)\n", entry.Path, entry.OldSize, entry.NewSize)
+			case "mtime":
+				_, err = fmt.Fprintf(w, "M %s (mtime %s -> %s)\n", entry.Path,
+					formatDiffTime(entry.OldModTime), formatDiffTime(entry.NewModTime))
+			default:
+				_, err = fmt.Fprintf(w, "M %s (%s)\n", entry.Path, entry.Reason)
+			}
+		default:
+			err = fmt.Errorf("Unknown change %#v", entry.Change)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatDiffTime(t *time.Time) string {
+	if t == nil {
+		return "none"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Write entries as a JSON array.
+func WriteDiffJSON(w io.Writer, entries []DiffEntry) error {
+	if entries == nil {
+		entries = []DiffEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(entries)
+}
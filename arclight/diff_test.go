@@ -0,0 +1,179 @@
+package arclight
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mustReadManifest(t *testing.T, lines ...string) VfsDirNode {
+	root, err := ReadManifest(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("Couldn't read manifest: %v", err)
+	}
+	return root
+}
+
+func TestDiff(t *testing.T) {
+	oldRoot := mustReadManifest(t,
+		`{"path":"same.txt","type":"file","size":3,"mtime":"2015-01-01T00:00:00Z"}`,
+		`{"path":"gone.txt","type":"file","size":3}`,
+		`{"path":"grown.txt","type":"file","size":3}`,
+		`{"path":"touched.txt","type":"file","size":3,"mtime":"2015-01-01T00:00:00Z","digests":{"sha256":"aa"}}`,
+		`{"path":"edited.txt","type":"file","size":3,"mtime":"2015-01-01T00:00:00Z","digests":{"sha256":"aa"}}`,
+		`{"path":"swap","type":"dir"}`,
+	)
+	newRoot := mustReadManifest(t,
+		`{"path":"same.txt","type":"file","size":3,"mtime":"2015-01-01T00:00:00Z"}`,
+		`{"path":"new/file.txt","type":"file","size":3}`,
+		`{"path":"grown.txt","type":"file","size":4}`,
+		`{"path":"touched.txt","type":"file","size":3,"mtime":"2015-02-01T00:00:00Z","digests":{"sha256":"aa"}}`,
+		`{"path":"edited.txt","type":"file","size":3,"mtime":"2015-02-01T00:00:00Z","digests":{"sha256":"bb"}}`,
+		`{"path":"swap","type":"file"}`,
+	)
+
+	entries, err := Diff(oldRoot, newRoot, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteDiffText(buf, entries); err != nil {
+		t.Fatalf("Couldn't write report: %v", err)
+	}
+	expected := strings.Join([]string{
+		"M edited.txt (digest:sha256)",
+		"- gone.txt (file)",
+		"M grown.txt (size 3 -> 4)",
+		"+ new (implicitdir)",
+		"! swap (dir -> file)",
+		"",
+	}, "\n")
+	if buf.String() != expected {
+		t.Errorf("report %q != expected %q", buf.String(), expected)
+	}
+}
+
+// Directories whose type changes are still compared below
+func TestDiff_TypeChangedDir(t *testing.T) {
+	oldRoot := mustReadManifest(t,
+		`{"path":"x","type":"dir"}`,
+		`{"path":"x/a.txt","type":"file","size":3}`,
+	)
+	newRoot := mustReadManifest(t,
+		`{"path":"x","type":"archive"}`,
+		`{"path":"x/a.txt","type":"file","size":4}`,
+	)
+	entries, err := Diff(oldRoot, newRoot, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteDiffText(buf, entries); err != nil {
+		t.Fatalf("Couldn't write report: %v", err)
+	}
+	expected := "! x (dir -> archive)\nM x/a.txt (size 3 -> 4)\n"
+	if buf.String() != expected {
+		t.Errorf("report %q != expected %q", buf.String(), expected)
+	}
+}
+
+// Tar members' parents are implicit directories, like Zip's
+func TestDiff_ImplicitTarDir(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestDiff")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	src := filepath.Join(tempdir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "x", "a.txt"), []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{Name: "x/a.txt", Mode: 0644, Size: 4, Typeflag: tar.TypeReg})
+	tw.Write([]byte("abcd"))
+	tw.Close()
+	path := filepath.Join(tempdir, "out.tar")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := NewTarArchive(NewOsFile(path, fi))
+
+	for _, test := range []struct {
+		opts     DiffOptions
+		expected string
+	}{
+		{DiffOptions{}, "! x (dir -> implicitdir)\nM x/a.txt (size 3 -> 4)\n"},
+		{DiffOptions{MergeImplicitDirs: true}, "M x/a.txt (size 3 -> 4)\n"},
+	} {
+		entries, err := Diff(osDir(t, src), archive, test.opts)
+		if err != nil {
+			t.Fatalf("Diff failed: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		if err := WriteDiffText(buf, entries); err != nil {
+			t.Fatalf("Couldn't write report: %v", err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("report %q != expected %q", buf.String(), test.expected)
+		}
+	}
+}
+
+// Manifests remember which directories were implicit, and make up their own
+func TestDiff_ImplicitManifestDir(t *testing.T) {
+	oldRoot := mustReadManifest(t,
+		`{"path":"x","type":"dir","implicit":true}`,
+		`{"path":"y","type":"dir"}`,
+		`{"path":"z/a.txt","type":"file"}`,
+	)
+	newRoot := mustReadManifest(t,
+		`{"path":"x","type":"dir"}`,
+		`{"path":"y/a.txt","type":"file"}`,
+		`{"path":"z","type":"dir","implicit":true}`,
+	)
+	entries, err := Diff(oldRoot, newRoot, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteDiffText(buf, entries); err != nil {
+		t.Fatalf("Couldn't write report: %v", err)
+	}
+	expected := "! x (implicitdir -> dir)\n! y (dir -> implicitdir)\n+ y/a.txt (file)\n- z/a.txt (file)\n"
+	if buf.String() != expected {
+		t.Errorf("report %q != expected %q", buf.String(), expected)
+	}
+}
+
+// Zero mtimes are left out of JSON reports
+func TestWriteDiffJSON_NoModTime(t *testing.T) {
+	oldRoot := mustReadManifest(t, `{"path":"a.txt","type":"file","size":3}`)
+	newRoot := mustReadManifest(t, `{"path":"a.txt","type":"file","size":4,"mtime":"2015-01-01T00:00:00Z"}`)
+	entries, err := Diff(oldRoot, newRoot, DiffOptions{})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := WriteDiffJSON(buf, entries); err != nil {
+		t.Fatalf("Couldn't write report: %v", err)
+	}
+	if strings.Contains(buf.String(), "oldmtime") {
+		t.Errorf("Expected no oldmtime, got %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"newmtime": "2015-01-01T00:00:00Z"`) {
+		t.Errorf("Expected newmtime, got %s", buf.String())
+	}
+}
@@ -17,6 +17,9 @@ const (
 // Detect MIME type using file name extension.
 func MimeTypeByExt(path string) (string, map[string]string) {
 	mimetype := mime.TypeByExtension(slashpath.Ext(path))
+	if mimetype == "" {
+		return OctetStream, nil
+	}
 
 	mediatype, params, err := mime.ParseMediaType(mimetype)
 	if err != nil {
@@ -37,8 +40,9 @@ func MimeTypeByExt(path string) (string, map[string]string) {
 var MimeTypeFromFile func(path string) (string, map[string]string) = StubMimeTypeFromFile
 var MimeTypeFromReader func(open func() (io.ReadCloser, error)) (string, map[string]string) = StubMimeTypeFromReader
 
+// Without libmagic, the file name extension is the best we can do.
 func StubMimeTypeFromFile(path string) (string, map[string]string) {
-	return OctetStream, nil
+	return MimeTypeByExt(path)
 }
 
 func StubMimeTypeFromReader(open func() (io.ReadCloser, error)) (string, map[string]string) {
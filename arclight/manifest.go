@@ -0,0 +1,399 @@
+package arclight
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	slashpath "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestTypeDir     = "dir"
+	ManifestTypeFile    = "file"
+	ManifestTypeArchive = "archive"
+)
+
+// One line of a JSON Lines manifest.
+// Paths are slash-separated and relative to the manifest root,
+// which is recorded with the path ".".
+type ManifestRecord struct {
+	Path       string            `json:"path"`
+	Type       string            `json:"type"`
+	Size       int64             `json:"size"`
+	ModTime    time.Time         `json:"mtime"`
+	MimeType   string            `json:"mimetype"`
+	MimeParams map[string]string `json:"mimeparams,omitempty"`
+	Attrs      NodeAttrs         `json:"attrs,omitempty"`
+	Digests    map[string]string `json:"digests,omitempty"`
+	// Directories implied by other paths, in the manifest or the tree it was written from.
+	Implicit bool `json:"implicit,omitempty"`
+}
+
+// Hash constructors for the digest algorithms a manifest can record.
+var DigestAlgorithms = map[string]func() hash.Hash{
+	"crc32":  func() hash.Hash { return crc32.NewIEEE() },
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// Nodes that already know their content digests, such as manifest entries.
+type VfsDigester interface {
+	Digest(algorithm string) (string, bool)
+}
+
+// Compute a hex digest of a file's contents.
+func FileDigest(file VfsFile, algorithm string) (string, error) {
+	newHash, ok := DigestAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("Unknown digest algorithm %#v", algorithm)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	h := newHash()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func manifestType(node VfsNode) string {
+	_, isDir := node.(VfsDir)
+	_, isFile := node.(VfsFile)
+	switch {
+	case isDir && isFile:
+		return ManifestTypeArchive
+	case isDir:
+		return ManifestTypeDir
+	default:
+		return ManifestTypeFile
+	}
+}
+
+// Writes one ManifestRecord per node of a tree.
+type ManifestWriter struct {
+	enc *json.Encoder
+	// Names of DigestAlgorithms to compute for every file.
+	Digests []string
+}
+
+func NewManifestWriter(w io.Writer, digests ...string) *ManifestWriter {
+	mw := new(ManifestWriter)
+	mw.enc = json.NewEncoder(w)
+	mw.Digests = digests
+	return mw
+}
+
+// Write records for root and everything below it, in depth-first order
+// with siblings sorted by name.
+func (mw *ManifestWriter) Walk(root VfsDirNode) error {
+	return mw.walk(root, ".")
+}
+
+func (mw *ManifestWriter) walk(node VfsNode, path string) error {
+	if err := mw.WriteNode(node, path); err != nil {
+		return err
+	}
+
+	dir, ok := node.(VfsDir)
+	if !ok {
+		return nil
+	}
+	children, err := dir.Children()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	sort.Sort(byName(children))
+	for _, child := range children {
+		if err := mw.walk(child, slashpath.Join(path, child.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write a single record for node, which will be stored under path.
+func (mw *ManifestWriter) WriteNode(node VfsNode, path string) error {
+	record := ManifestRecord{
+		Path:    path,
+		Type:    manifestType(node),
+		ModTime: node.ModTime(),
+	}
+	record.MimeType, record.MimeParams = node.MimeType()
+	if len(record.MimeParams) == 0 {
+		record.MimeParams = nil
+	}
+	if len(node.Attrs()) > 0 {
+		record.Attrs = node.Attrs()
+	}
+	if implicit, ok := node.(VfsImplicit); ok {
+		record.Implicit = implicit.Implicit()
+	}
+
+	if file, ok := node.(VfsFile); ok {
+		record.Size = file.Size()
+		for _, algorithm := range mw.Digests {
+			digest, err := FileDigest(file, algorithm)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			if record.Digests == nil {
+				record.Digests = make(map[string]string)
+			}
+			record.Digests[algorithm] = digest
+		}
+	}
+
+	return mw.enc.Encode(&record)
+}
+
+type byName []VfsNode
+
+func (nodes byName) Len() int {
+	return len(nodes)
+}
+
+func (nodes byName) Swap(i, j int) {
+	nodes[i], nodes[j] = nodes[j], nodes[i]
+}
+
+func (nodes byName) Less(i, j int) bool {
+	return nodes[i].Name() < nodes[j].Name()
+}
+
+// Manifest entries describe content but don't have any.
+var ErrNoContent = errors.New("Manifest entries have no content")
+
+// Load a manifest written by ManifestWriter as a read-only tree.
+// Directories missing from the manifest are created implicitly.
+func ReadManifest(r io.Reader) (VfsDirNode, error) {
+	records := make(map[string]*ManifestRecord)
+	var paths []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		record := new(ManifestRecord)
+		if err := json.Unmarshal(line, record); err != nil {
+			return nil, fmt.Errorf("Manifest line %d: %v", lineNum, err)
+		}
+		record.Path = slashpath.Clean(record.Path)
+		if strings.HasPrefix(record.Path, "/") || record.Path == ".." || strings.HasPrefix(record.Path, "../") {
+			return nil, fmt.Errorf("Manifest line %d: path %#v escapes root", lineNum, record.Path)
+		}
+		if _, dup := records[record.Path]; dup {
+			return nil, fmt.Errorf("Manifest line %d: duplicate path %#v", lineNum, record.Path)
+		}
+		records[record.Path] = record
+		if record.Path != "." {
+			paths = append(paths, record.Path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	rootRecord, ok := records["."]
+	if !ok {
+		rootRecord = &ManifestRecord{Path: ".", Type: ManifestTypeDir}
+	}
+	if rootRecord.Type == ManifestTypeFile {
+		return nil, fmt.Errorf("Manifest root must be a directory")
+	}
+	root := newManifestNode(rootRecord)
+
+	// walk up from each path until reaching a directory that's already known
+	for _, path := range paths {
+		for dir := slashpath.Dir(path); dir != "."; dir = slashpath.Dir(dir) {
+			if _, ok := records[dir]; ok {
+				break
+			}
+			records[dir] = &ManifestRecord{
+				Path:     dir,
+				Type:     ManifestTypeDir,
+				ModTime:  rootRecord.ModTime,
+				MimeType: InodeDirectory,
+				Implicit: true,
+			}
+			paths = append(paths, dir)
+		}
+	}
+
+	// a path sorts after its parent, so parents come before their children
+	sort.Strings(paths)
+	nodes := map[string]manifestNode{".": root}
+	for _, path := range paths {
+		record := records[path]
+		parent, ok := nodes[slashpath.Dir(path)].(manifestParent)
+		if !ok {
+			return nil, fmt.Errorf("Manifest path %#v has a file as its parent", path)
+		}
+		node := newManifestNode(record)
+		parent.addChild(node)
+		nodes[path] = node
+	}
+
+	return root.(VfsDirNode), nil
+}
+
+type manifestNode interface {
+	VfsNode
+	Record() *ManifestRecord
+}
+
+type manifestParent interface {
+	addChild(child VfsNode)
+}
+
+func newManifestNode(record *ManifestRecord) manifestNode {
+	if record.Attrs == nil {
+		record.Attrs = make(NodeAttrs)
+	}
+	switch record.Type {
+	case ManifestTypeDir:
+		return &ManifestDir{record: record}
+	case ManifestTypeArchive:
+		return &ManifestArchive{ManifestDir{record: record}}
+	default:
+		return &ManifestFile{record: record}
+	}
+}
+
+// A file described by a manifest.
+type ManifestFile struct {
+	record *ManifestRecord
+}
+
+func (node *ManifestFile) Record() *ManifestRecord {
+	return node.record
+}
+
+func (node *ManifestFile) Name() string {
+	return slashpath.Base(node.record.Path)
+}
+
+func (node *ManifestFile) ModTime() time.Time {
+	return node.record.ModTime
+}
+
+func (node *ManifestFile) Attrs() NodeAttrs {
+	return node.record.Attrs
+}
+
+func (node *ManifestFile) MimeType() (string, map[string]string) {
+	return node.record.MimeType, node.record.MimeParams
+}
+
+func (node *ManifestFile) Size() int64 {
+	return node.record.Size
+}
+
+func (node *ManifestFile) Open() (io.ReadCloser, error) {
+	return nil, ErrNoContent
+}
+
+func (node *ManifestFile) Digest(algorithm string) (string, bool) {
+	digest, ok := node.record.Digests[algorithm]
+	return digest, ok
+}
+
+// A directory described by a manifest.
+type ManifestDir struct {
+	record   *ManifestRecord
+	children []VfsNode
+}
+
+func (node *ManifestDir) Record() *ManifestRecord {
+	return node.record
+}
+
+func (node *ManifestDir) Name() string {
+	return slashpath.Base(node.record.Path)
+}
+
+func (node *ManifestDir) ModTime() time.Time {
+	return node.record.ModTime
+}
+
+func (node *ManifestDir) Implicit() bool {
+	return node.record.Implicit
+}
+
+func (node *ManifestDir) Attrs() NodeAttrs {
+	return node.record.Attrs
+}
+
+func (node *ManifestDir) MimeType() (string, map[string]string) {
+	return node.record.MimeType, node.record.MimeParams
+}
+
+func (node *ManifestDir) addChild(child VfsNode) {
+	node.children = append(node.children, child)
+}
+
+func (node *ManifestDir) Children() ([]VfsNode, error) {
+	children := make([]VfsNode, len(node.children))
+	copy(children, node.children)
+	return children, nil
+}
+
+func (node *ManifestDir) Resolve(relpath string) (VfsNode, error) {
+	relpath = slashpath.Clean(relpath)
+	if relpath == "." {
+		return node, nil
+	}
+	first, rest := relpath, ""
+	if i := strings.Index(relpath, "/"); i >= 0 {
+		first, rest = relpath[:i], relpath[i+1:]
+	}
+	for _, child := range node.children {
+		if child.Name() != first {
+			continue
+		}
+		if rest == "" {
+			return child, nil
+		}
+		if dir, ok := child.(VfsDir); ok {
+			return dir.Resolve(rest)
+		}
+		break
+	}
+	return nil, fmt.Errorf("Manifest path not found: %s", slashpath.Join(node.record.Path, relpath))
+}
+
+// An archive described by a manifest: a file that also has children.
+type ManifestArchive struct {
+	ManifestDir
+}
+
+func (node *ManifestArchive) Size() int64 {
+	return node.record.Size
+}
+
+func (node *ManifestArchive) Open() (io.ReadCloser, error) {
+	return nil, ErrNoContent
+}
+
+func (node *ManifestArchive) Digest(algorithm string) (string, bool) {
+	digest, ok := node.record.Digests[algorithm]
+	return digest, ok
+}
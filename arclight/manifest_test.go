@@ -0,0 +1,100 @@
+package arclight
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManifest_RoundTrip(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestManifest")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	if err := os.MkdirAll(filepath.Join(tempdir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(tempdir, "sub", "hello.txt"), []byte("hello\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(tempdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := NewManifestWriter(buf, "sha256").Walk(NewOsDir(tempdir, fi)); err != nil {
+		t.Fatalf("Couldn't write manifest: %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Errorf("Manifest should have 3 lines, but actually has %d", lines)
+	}
+
+	root, err := ReadManifest(buf)
+	if err != nil {
+		t.Fatalf("Couldn't read manifest: %v", err)
+	}
+	node, err := root.Resolve("sub/hello.txt")
+	if err != nil {
+		t.Fatalf("Couldn't resolve file: %v", err)
+	}
+	file, ok := node.(*ManifestFile)
+	if !ok {
+		t.Fatalf("Expected *ManifestFile, got %T", node)
+	}
+	if file.Size() != 6 {
+		t.Errorf("Expected size 6, got %d", file.Size())
+	}
+	expected := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if digest, _ := file.Digest("sha256"); digest != expected {
+		t.Errorf("Expected digest %s, got %s", expected, digest)
+	}
+	if _, err := file.Open(); err != ErrNoContent {
+		t.Errorf("Expected ErrNoContent, got %v", err)
+	}
+}
+
+// Directories that only appear as prefixes of other paths
+func TestReadManifest_ImplicitDirs(t *testing.T) {
+	manifest := `{"path":"a/b/c.txt","type":"file","size":3}` + "\n"
+	root, err := ReadManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Couldn't read manifest: %v", err)
+	}
+	node, err := root.Resolve("a/b")
+	if err != nil {
+		t.Fatalf("Couldn't resolve implicit dir: %v", err)
+	}
+	if mediatype, _ := node.MimeType(); mediatype != InodeDirectory {
+		t.Errorf("Expected %s, got %s", InodeDirectory, mediatype)
+	}
+}
+
+// A sibling that sorts between a directory and its children
+func TestReadManifest_ImplicitDirsInterleaved(t *testing.T) {
+	manifest := `{"path":"a-x/c","type":"file"}` + "\n" + `{"path":"a/b","type":"file"}` + "\n"
+	root, err := ReadManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Couldn't read manifest: %v", err)
+	}
+	for _, path := range []string{"a/b", "a-x/c"} {
+		if _, err := root.Resolve(path); err != nil {
+			t.Errorf("Couldn't resolve %s: %v", path, err)
+		}
+	}
+}
+
+func TestReadManifest_EscapesRoot(t *testing.T) {
+	for _, path := range []string{"..", "../x", "/x", "a/../../x"} {
+		manifest := `{"path":"` + path + `","type":"file"}` + "\n"
+		if _, err := ReadManifest(strings.NewReader(manifest)); err == nil {
+			t.Errorf("Expected an error for path %s", path)
+		}
+	}
+}
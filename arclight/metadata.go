@@ -0,0 +1,53 @@
+package arclight
+
+import (
+	"os"
+)
+
+// NodeAttrs keys for comments, by archive format. Comment() checks them in this order.
+var CommentAttrs = []string{"zip.comment", "tar.comment"}
+
+// A node's comment from whichever archive format it came from, or "".
+func Comment(node VfsNode) string {
+	attrs := node.Attrs()
+	for _, key := range CommentAttrs {
+		if comment := attrs[key]; comment != "" {
+			return comment
+		}
+	}
+	return ""
+}
+
+// Nodes that can be symbolic links. Only nodes whose Mode() has os.ModeSymlink are links.
+type VfsLinker interface {
+	Readlink() (string, error)
+}
+
+// The target of a symbolic link. ok is false if node isn't a link.
+func LinkTarget(node VfsNode) (target string, ok bool, err error) {
+	moder, isModer := node.(VfsModer)
+	linker, isLinker := node.(VfsLinker)
+	if !isModer || !isLinker || moder.Mode()&os.ModeSymlink == 0 {
+		return "", false, nil
+	}
+	target, err = linker.Readlink()
+	return target, true, err
+}
+
+// Devices, pipes, and sockets have no contents worth copying.
+func IsSpecial(node VfsNode) bool {
+	moder, ok := node.(VfsModer)
+	return ok && moder.Mode()&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket) != 0
+}
+
+// Unix permissions to record for a node, with the setuid, setgid, and sticky bits.
+// Nodes that don't know their mode get defaultPerm.
+func NodePerm(node VfsNode, defaultPerm os.FileMode) os.FileMode {
+	const keep = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if moder, ok := node.(VfsModer); ok {
+		if mode := moder.Mode() & keep; mode.Perm() != 0 {
+			return mode
+		}
+	}
+	return defaultPerm
+}
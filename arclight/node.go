@@ -2,6 +2,7 @@ package arclight
 
 import (
 	"io"
+	"os"
 	"time"
 )
 
@@ -39,3 +40,14 @@ type VfsDirFileNode interface {
 	VfsDir
 	VfsFile
 }
+
+// Directories that aren't stored anywhere, but are implied by the paths of other nodes,
+// such as the parents of archive members that have no entries of their own.
+type VfsImplicit interface {
+	Implicit() bool
+}
+
+// Nodes that know their Unix mode, such as OS files and Zip entries with Unix attributes.
+type VfsModer interface {
+	Mode() os.FileMode
+}
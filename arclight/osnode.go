@@ -98,13 +98,34 @@ func (file *OsFile) Open() (io.ReadCloser, error) {
 	return os.Open(file.Path)
 }
 
+func (file *OsFile) Readlink() (string, error) {
+	return os.Readlink(file.Path)
+}
+
+func (file *OsFile) OpenSeekable() (SeekableReader, error) {
+	f, err := os.Open(file.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !file.Seekable() {
+		defer f.Close()
+		return spool(f, file.Size())
+	}
+	return f, nil
+}
+
+// Regular files can seek, but pipes and devices may not.
+func (file *OsFile) Seekable() bool {
+	return file.Mode().IsRegular()
+}
+
 func (file *OsFile) MimeType() (string, map[string]string) {
 	// special file types
 	if mediatype := file.inodeMediaType(); mediatype != OctetStream {
 		return mediatype, nil
 	}
 
-	mediatype, params := MagicMimeTypeFromFile(file.Path)
+	mediatype, params := MimeTypeFromFile(file.Path)
 	return mediatype, params
 }
 
@@ -5,23 +5,26 @@ import "sort"
 // Given a list of paths, return a list of paths that must
 // be created to form a complete directory tree.
 // Assumes the input list has been Clean()ed already,
-// and no paths start with /.
+// and no paths start with /. The result is sorted.
 func ImplicitDirs(paths []string) []string {
-    sort.Strings(paths)
+    present := make(map[string]bool, len(paths))
+    for _, path := range paths {
+        present[path] = true
+    }
     var out []string
-    prev := ""
     for _, path := range paths {
         for end := 0 ; end < len(path) ; end++ {
             if path[end] != '/' {
                 continue
             }
             ancestor := path[:end]
-            if ancestor <= prev {
+            if present[ancestor] {
                 continue
             }
+            present[ancestor] = true
             out = append(out, ancestor)
         }
-        prev = path
     }
+    sort.Strings(out)
     return out
 }
@@ -47,3 +47,19 @@ func TestImplicitDirs_Ancestor(t *testing.T) {
         t.Errorf("output %#v != expected %#v", output, expected)
     }
 }
+
+// Case where a sibling with a longer name sorts between a directory's descendants
+func TestImplicitDirs_Interleaved(t *testing.T) {
+    input := []string{
+        "a-x/c",
+        "a/b",
+    }
+    output := ImplicitDirs(input)
+    expected := []string{
+        "a",
+        "a-x",
+    }
+    if !strSlicesEqual(output, expected) {
+        t.Errorf("output %#v != expected %#v", output, expected)
+    }
+}
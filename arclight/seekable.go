@@ -0,0 +1,98 @@
+package arclight
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// A reader that supports random access, such as an *os.File.
+type SeekableReader interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// Files that know how to open a SeekableReader.
+type VfsSeekableFile interface {
+	OpenSeekable() (SeekableReader, error)
+	// Whether OpenSeekable() can avoid spooling.
+	Seekable() bool
+}
+
+// Whether OpenSeekable() can open file without spooling it.
+func IsSeekable(file VfsFile) bool {
+	if seekable, ok := file.(VfsSeekableFile); ok {
+		return seekable.Seekable()
+	}
+	return false
+}
+
+// Files up to this size are spooled in memory; larger ones go to a temp file.
+var SpoolMemoryLimit int64 = 8 * 1024 * 1024
+
+// Open a file for random access.
+// Files whose readers can't seek are copied to a spool first.
+func OpenSeekable(file VfsFile) (SeekableReader, error) {
+	if seekable, ok := file.(VfsSeekableFile); ok {
+		return seekable.OpenSeekable()
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	if seekableReader, ok := reader.(SeekableReader); ok {
+		return seekableReader, nil
+	}
+	defer reader.Close()
+
+	return spool(reader, file.Size())
+}
+
+func spool(reader io.Reader, size int64) (SeekableReader, error) {
+	if size <= SpoolMemoryLimit {
+		buf, err := ioutil.ReadAll(io.LimitReader(reader, SpoolMemoryLimit+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(buf)) <= SpoolMemoryLimit {
+			return &memSpool{bytes.NewReader(buf)}, nil
+		}
+		// size lied; keep what we have and continue on disk
+		reader = io.MultiReader(bytes.NewReader(buf), reader)
+	}
+
+	f, err := ioutil.TempFile("", "arclight-spool")
+	if err != nil {
+		return nil, err
+	}
+	// unlinking now means nothing is left behind, even if we crash
+	os.Remove(f.Name())
+	if _, err := io.Copy(f, reader); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+type memSpool struct {
+	*bytes.Reader
+}
+
+func (spool *memSpool) Close() error {
+	return nil
+}
+
+// Adds a Close() method to a SectionReader,
+// which closes the reader the section was taken from.
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
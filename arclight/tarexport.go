@@ -0,0 +1,140 @@
+package arclight
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	slashpath "path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Settings for ExportTar.
+type TarExportOptions struct {
+	// If not zero, every entry gets this modification time instead of its own.
+	FixedModTime time.Time
+}
+
+func (opts *TarExportOptions) modTime(node VfsNode) time.Time {
+	if !opts.FixedModTime.IsZero() {
+		return opts.FixedModTime
+	}
+	return node.ModTime()
+}
+
+// Write everything below root to w as a tar archive, streaming as it goes.
+// Archive paths are relative to root, and entries are sorted.
+// Unix modes, symbolic links, and "tar.*" ownership attrs are kept where nodes know them.
+// Comments become PAX comment records; tar has nowhere to put one for the archive itself.
+// Devices and pipes are skipped.
+func ExportTar(w io.Writer, root VfsDirNode, opts TarExportOptions) error {
+	tw := tar.NewWriter(w)
+	if err := exportTarDir(tw, root, "", &opts); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func newTarHeader(node VfsNode, name string, opts *TarExportOptions) *tar.Header {
+	hdr := &tar.Header{
+		Name:    name,
+		ModTime: opts.modTime(node),
+	}
+	attrs := node.Attrs()
+	hdr.Uname = attrs["tar.uname"]
+	hdr.Gname = attrs["tar.gname"]
+	hdr.Uid, _ = strconv.Atoi(attrs["tar.uid"])
+	hdr.Gid, _ = strconv.Atoi(attrs["tar.gid"])
+	if comment := Comment(node); comment != "" {
+		hdr.PAXRecords = map[string]string{"comment": comment}
+	}
+	return hdr
+}
+
+// tar.Header.Mode holds the permission bits plus the C setuid, setgid, and sticky bits.
+func tarMode(perm os.FileMode) int64 {
+	mode := int64(perm.Perm())
+	if perm&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if perm&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if perm&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return mode
+}
+
+func exportTarDir(tw *tar.Writer, dir VfsDir, path string, opts *TarExportOptions) error {
+	children, err := dir.Children()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	sort.Sort(byName(children))
+
+	for _, child := range children {
+		if IsSpecial(child) {
+			continue
+		}
+		childPath := slashpath.Join(path, child.Name())
+		if file, ok := child.(VfsFileNode); ok {
+			if err := exportTarFile(tw, file, childPath, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		childDir, ok := child.(VfsDir)
+		if !ok {
+			continue
+		}
+		hdr := newTarHeader(child, childPath+"/", opts)
+		hdr.Typeflag = tar.TypeDir
+		hdr.Mode = tarMode(NodePerm(child, 0755))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if err := exportTarDir(tw, childDir, childPath, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportTarFile(tw *tar.Writer, file VfsFileNode, path string, opts *TarExportOptions) error {
+	hdr := newTarHeader(file, path, opts)
+	target, isLink, err := LinkTarget(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if isLink {
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+		hdr.Mode = 0777
+		return tw.WriteHeader(hdr)
+	}
+
+	hdr.Typeflag = tar.TypeReg
+	hdr.Mode = tarMode(NodePerm(file, 0644))
+	hdr.Size = file.Size()
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	defer reader.Close()
+	// a file that changed size since Size() was called would corrupt the archive
+	n, err := io.Copy(tw, reader)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if n != hdr.Size {
+		return fmt.Errorf("%s: size changed from %d to %d while writing", path, hdr.Size, n)
+	}
+	return nil
+}
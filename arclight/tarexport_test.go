@@ -0,0 +1,105 @@
+package arclight
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Modes, symlinks, and comments survive a round trip through TarArchive
+func TestExportTar_RoundTrip(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestExportTar")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	src := filepath.Join(tempdir, "src")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(src, "bin", "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("bin/run.sh", filepath.Join(src, "run")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if err := ExportTar(gz, osDir(t, src), TarExportOptions{}); err != nil {
+		t.Fatalf("Couldn't export: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(tempdir, "out.tar.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := NewGzipTarArchive(NewOsFile(path, fi))
+	if archive == nil {
+		t.Fatalf("Expected a tar archive")
+	}
+
+	node, err := ResolvePath(archive, "bin/run.sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := node.(VfsModer).Mode(); mode.Perm() != 0755 {
+		t.Errorf("Expected run.sh to keep mode 0755, got %v", mode)
+	}
+	reader, err := node.(VfsFile).Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(content) != "#!/bin/sh\n" {
+		t.Errorf("Expected run.sh contents, got %q, %v", content, err)
+	}
+
+	node, err = ResolvePath(archive, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, ok, err := LinkTarget(node)
+	if !ok || err != nil || target != "bin/run.sh" {
+		t.Errorf("Expected a link to bin/run.sh, got %q, %v, %v", target, ok, err)
+	}
+}
+
+// Gzipped files that aren't tars aren't archives
+func TestNewGzipTarArchive_NotTar(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestNewGzipTarArchive")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	gz.Write(bytes.Repeat([]byte("not a tar\n"), 100))
+	gz.Close()
+	path := filepath.Join(tempdir, "notes.txt.gz")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive := NewGzipTarArchive(NewOsFile(path, fi)); archive != nil {
+		t.Errorf("Expected nil for a gzipped text file")
+	}
+}
@@ -0,0 +1,493 @@
+package arclight
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	slashpath "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/ulikunitz/xz"
+)
+
+// Tar archives can't be read without decompressing everything before the member we want,
+// so the headers are read once and kept, and members are found by counting entries.
+type TarArchive struct {
+	VfsFileNode
+	decompress func(io.Reader) (io.Reader, error)
+
+	mutex     sync.Mutex
+	scanned   bool
+	headers   []*tar.Header
+	scanErr   error
+	nodeCache []zipNode
+}
+
+func NewTarArchive(file VfsFileNode) VfsDirFileNode {
+	return newTarArchive(file, nil)
+}
+
+func NewGzipTarArchive(file VfsFileNode) VfsDirFileNode {
+	return newCompressedTarArchive(file, func(reader io.Reader) (io.Reader, error) {
+		return gzip.NewReader(reader)
+	})
+}
+
+func NewXzTarArchive(file VfsFileNode) VfsDirFileNode {
+	return newCompressedTarArchive(file, func(reader io.Reader) (io.Reader, error) {
+		return xz.NewReader(reader)
+	})
+}
+
+func newTarArchive(file VfsFileNode, decompress func(io.Reader) (io.Reader, error)) *TarArchive {
+	arc := new(TarArchive)
+	arc.VfsFileNode = file
+	arc.decompress = decompress
+	return arc
+}
+
+// A compressed file is only an archive if there's a tar inside.
+// Returns nil for compressed files that hold anything else.
+func newCompressedTarArchive(file VfsFileNode, decompress func(io.Reader) (io.Reader, error)) VfsDirFileNode {
+	arc := newTarArchive(file, decompress)
+	reader, err := arc.openTar()
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	block := make([]byte, 512)
+	if _, err := io.ReadFull(reader, block); err != nil {
+		return nil
+	}
+	// POSIX and GNU both start the magic with "ustar"
+	if !bytes.HasPrefix(block[257:], []byte("ustar")) {
+		return nil
+	}
+	return arc
+}
+
+// Open the archive's decompressed byte stream.
+func (arc *TarArchive) openTar() (io.ReadCloser, error) {
+	reader, err := arc.VfsFileNode.Open()
+	if err != nil {
+		return nil, err
+	}
+	if arc.decompress == nil {
+		return reader, nil
+	}
+	decompressed, err := arc.decompress(reader)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return &tarMemberReader{decompressed, reader}, nil
+}
+
+// Read every header in the archive, once.
+func (arc *TarArchive) scan() ([]*tar.Header, error) {
+	arc.mutex.Lock()
+	defer arc.mutex.Unlock()
+	if arc.scanned {
+		return arc.headers, arc.scanErr
+	}
+	arc.scanned = true
+
+	reader, err := arc.openTar()
+	if err != nil {
+		arc.scanErr = err
+		return nil, err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			arc.scanErr = err
+			return nil, err
+		}
+		arc.headers = append(arc.headers, hdr)
+	}
+	return arc.headers, nil
+}
+
+// Open the data of the entry at index in the archive.
+// The caller must close the returned reader.
+func (arc *TarArchive) openMember(index int, name string) (io.ReadCloser, error) {
+	reader, err := arc.openTar()
+	if err != nil {
+		return nil, err
+	}
+
+	tr := tar.NewReader(reader)
+	for i := 0; i <= index; i++ {
+		hdr, err := tr.Next()
+		if err != nil {
+			reader.Close()
+			if err == io.EOF {
+				err = fmt.Errorf("Archive member %#v has disappeared", name)
+			}
+			return nil, err
+		}
+		if i == index && hdr.Name != name {
+			reader.Close()
+			return nil, fmt.Errorf("Archive member %#v has disappeared", name)
+		}
+	}
+	return &tarMemberReader{tr, reader}, nil
+}
+
+// Archive paths are relative, even if the archive says otherwise.
+func tarPath(name string) string {
+	return strings.TrimPrefix(slashpath.Clean("/"+name), "/")
+}
+
+func (arc *TarArchive) nodes() ([]zipNode, error) {
+	headers, err := arc.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	arc.mutex.Lock()
+	defer arc.mutex.Unlock()
+	if arc.nodeCache != nil {
+		return arc.nodeCache, nil
+	}
+
+	// a later entry for the same path replaces an earlier one, as when extracting
+	last := make(map[string]int)
+	for i, hdr := range headers {
+		last[tarPath(hdr.Name)] = i
+	}
+
+	nodes := make([]zipNode, 0, len(headers))
+	paths := make([]string, 0, len(headers))
+	for i, hdr := range headers {
+		path := tarPath(hdr.Name)
+		if path == "" || last[path] != i {
+			continue
+		}
+		var node zipNode
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			node = NewTarDir(arc, path, hdr)
+		case tar.TypeReg, tar.TypeRegA, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			node = NewTarFile(arc, i, path, hdr, i)
+		case tar.TypeLink:
+			target, ok := last[tarPath(hdr.Linkname)]
+			if !ok || target >= i {
+				continue
+			}
+			node = NewTarFile(arc, i, path, hdr, target)
+		default:
+			continue
+		}
+		nodes = append(nodes, node)
+		paths = append(paths, path)
+	}
+
+	for _, path := range ImplicitDirs(paths) {
+		nodes = append(nodes, NewImplicitTarDir(arc, path))
+	}
+
+	arc.nodeCache = nodes
+	return nodes, nil
+}
+
+func (arc *TarArchive) Children() ([]VfsNode, error) {
+	nodes, err := arc.nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]VfsNode, 0)
+	for _, node := range nodes {
+		if depth(node) == 1 {
+			children = append(children, node)
+		}
+	}
+	return children, nil
+}
+
+func (arc *TarArchive) childrenOf(node zipNode) ([]VfsNode, error) {
+	nodes, err := arc.nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	targetDepth := 1 + depth(node)
+	pathPfx := node.arcPath() + "/"
+	children := make([]VfsNode, 0)
+
+	for _, node := range nodes {
+		if depth(node) == targetDepth && strings.HasPrefix(node.arcPath(), pathPfx) {
+			children = append(children, node)
+		}
+	}
+	return children, nil
+}
+
+func (arc *TarArchive) Resolve(relpath string) (VfsNode, error) {
+	nodes, err := arc.nodes()
+	if err != nil {
+		return nil, err
+	}
+
+	relpath = tarPath(relpath)
+	for _, node := range nodes {
+		if node.arcPath() == relpath {
+			return node, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Archive path not found: %s", relpath)
+}
+
+// Ownership is only kept as attrs, since it rarely means anything on another machine.
+// PAX comments become "tar.comment".
+func tarAttrs(hdr *tar.Header) NodeAttrs {
+	attrs := make(NodeAttrs)
+	if hdr.Uname != "" {
+		attrs["tar.uname"] = hdr.Uname
+	}
+	if hdr.Gname != "" {
+		attrs["tar.gname"] = hdr.Gname
+	}
+	if hdr.Uid != 0 {
+		attrs["tar.uid"] = strconv.Itoa(hdr.Uid)
+	}
+	if hdr.Gid != 0 {
+		attrs["tar.gid"] = strconv.Itoa(hdr.Gid)
+	}
+	if comment := hdr.PAXRecords["comment"]; comment != "" {
+		attrs["tar.comment"] = comment
+	}
+	return attrs
+}
+
+// A file inside the archive.
+// Symbolic links, devices, and pipes are files with no data.
+// Hard links read the data of the entry they link to.
+type TarFile struct {
+	attrs NodeAttrs
+	arc   *TarArchive
+	index int
+	path  string
+	hdr   *tar.Header
+	// entry that holds the data: index, or an earlier entry for hard links
+	dataIndex int
+
+	mimeOnce   sync.Once
+	mediatype  string
+	mimeParams map[string]string
+}
+
+func NewTarFile(arc *TarArchive, index int, path string, hdr *tar.Header, dataIndex int) *TarFile {
+	node := new(TarFile)
+	node.attrs = tarAttrs(hdr)
+	node.arc = arc
+	node.index = index
+	node.path = path
+	node.hdr = hdr
+	node.dataIndex = dataIndex
+	return node
+}
+
+func (node *TarFile) arcPath() string {
+	return node.path
+}
+
+func (node *TarFile) Attrs() NodeAttrs {
+	return node.attrs
+}
+
+func (node *TarFile) Name() string {
+	return slashpath.Base(node.path)
+}
+
+func (node *TarFile) dataHeader() *tar.Header {
+	headers, _ := node.arc.scan()
+	if node.dataIndex < len(headers) {
+		return headers[node.dataIndex]
+	}
+	return node.hdr
+}
+
+func (node *TarFile) Size() int64 {
+	switch node.hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return node.hdr.Size
+	case tar.TypeLink:
+		return node.dataHeader().Size
+	}
+	return 0
+}
+
+func (node *TarFile) ModTime() time.Time {
+	return node.hdr.ModTime
+}
+
+func (node *TarFile) Header() *tar.Header {
+	return node.hdr
+}
+
+func (node *TarFile) Mode() os.FileMode {
+	if node.hdr.Typeflag == tar.TypeLink {
+		return node.hdr.FileInfo().Mode().Perm() | node.dataHeader().FileInfo().Mode()&^os.ModePerm
+	}
+	return node.hdr.FileInfo().Mode()
+}
+
+func (node *TarFile) Readlink() (string, error) {
+	if node.hdr.Typeflag != tar.TypeSymlink {
+		return "", fmt.Errorf("Not a symbolic link: %s", node.path)
+	}
+	return node.hdr.Linkname, nil
+}
+
+// Sniffing means reading the archive up to the member, so it's only done once.
+func (node *TarFile) MimeType() (string, map[string]string) {
+	switch node.hdr.Typeflag {
+	case tar.TypeSymlink:
+		return "inode/symlink", nil
+	case tar.TypeChar:
+		return "inode/chardevice", nil
+	case tar.TypeBlock:
+		return "inode/blockdevice", nil
+	case tar.TypeFifo:
+		return "inode/fifo", nil
+	}
+	node.mimeOnce.Do(func() {
+		node.mediatype, node.mimeParams = MimeTypeFromReader(node.Open)
+		if node.mediatype == OctetStream {
+			node.mediatype, node.mimeParams = MimeTypeByExt(node.Name())
+		}
+	})
+	return node.mediatype, node.mimeParams
+}
+
+func (node *TarFile) Open() (io.ReadCloser, error) {
+	if node.Size() == 0 {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return node.arc.openMember(node.dataIndex, node.dataHeader().Name)
+}
+
+type tarMemberReader struct {
+	io.Reader
+	archive io.Closer
+}
+
+func (reader *tarMemberReader) Close() error {
+	return reader.archive.Close()
+}
+
+// A directory inside the archive
+type TarDir struct {
+	attrs NodeAttrs
+	arc   *TarArchive
+	path  string
+	hdr   *tar.Header
+}
+
+func NewTarDir(arc *TarArchive, path string, hdr *tar.Header) *TarDir {
+	node := new(TarDir)
+	node.attrs = tarAttrs(hdr)
+	node.arc = arc
+	node.path = path
+	node.hdr = hdr
+	return node
+}
+
+func (node *TarDir) arcPath() string {
+	return node.path
+}
+
+func (node *TarDir) Attrs() NodeAttrs {
+	return node.attrs
+}
+
+func (node *TarDir) Name() string {
+	return slashpath.Base(node.path)
+}
+
+func (node *TarDir) ModTime() time.Time {
+	return node.hdr.ModTime
+}
+
+func (node *TarDir) MimeType() (string, map[string]string) {
+	return InodeDirectory, nil
+}
+
+func (node *TarDir) Mode() os.FileMode {
+	return node.hdr.FileInfo().Mode()
+}
+
+func (node *TarDir) Children() ([]VfsNode, error) {
+	return node.arc.childrenOf(node)
+}
+
+func (node *TarDir) Resolve(relpath string) (VfsNode, error) {
+	return node.arc.Resolve(slashpath.Join(node.path, relpath))
+}
+
+// A directory implied by the paths of other entries,
+// like ImplicitZipDir.
+type ImplicitTarDir struct {
+	attrs NodeAttrs
+	arc   *TarArchive
+	path  string
+}
+
+func NewImplicitTarDir(arc *TarArchive, path string) *ImplicitTarDir {
+	node := new(ImplicitTarDir)
+	node.attrs = make(NodeAttrs)
+	node.arc = arc
+	node.path = path
+	return node
+}
+
+func (node *ImplicitTarDir) arcPath() string {
+	return node.path
+}
+
+func (node *ImplicitTarDir) Implicit() bool {
+	return true
+}
+
+func (node *ImplicitTarDir) Attrs() NodeAttrs {
+	return node.attrs
+}
+
+func (node *ImplicitTarDir) Name() string {
+	return slashpath.Base(node.path)
+}
+
+func (node *ImplicitTarDir) ModTime() time.Time {
+	return node.arc.ModTime()
+}
+
+func (node *ImplicitTarDir) MimeType() (string, map[string]string) {
+	return InodeDirectory, nil
+}
+
+func (node *ImplicitTarDir) Children() ([]VfsNode, error) {
+	return node.arc.childrenOf(node)
+}
+
+func (node *ImplicitTarDir) Resolve(relpath string) (VfsNode, error) {
+	return node.arc.Resolve(slashpath.Join(node.path, relpath))
+}
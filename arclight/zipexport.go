@@ -0,0 +1,170 @@
+package arclight
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	slashpath "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MIME types whose contents are already compressed,
+// so deflating them again would waste time for no gain.
+var PrecompressedTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-bzip2":          true,
+	"application/x-gzip":           true,
+	"application/x-rar":            true,
+	"application/x-rar-compressed": true,
+	"application/x-xz":             true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"image/gif":                    true,
+	"image/jpeg":                   true,
+	"image/png":                    true,
+	"image/webp":                   true,
+}
+
+// Is this file's content already compressed?
+// Audio and video formats all are, for practical purposes.
+func IsPrecompressed(file VfsNode) bool {
+	byExt, _ := MimeTypeByExt(file.Name())
+	if isPrecompressedType(byExt) {
+		return true
+	}
+	sniffed, _ := file.MimeType()
+	return isPrecompressedType(sniffed)
+}
+
+func isPrecompressedType(mediatype string) bool {
+	return PrecompressedTypes[mediatype] ||
+		strings.HasPrefix(mediatype, "audio/") ||
+		strings.HasPrefix(mediatype, "video/")
+}
+
+// Settings for ExportZip.
+type ZipExportOptions struct {
+	// Chooses the compression method for each file. Defaults to DefaultZipMethod.
+	Method func(file VfsFileNode) uint16
+	// If not zero, every entry gets this modification time instead of its own.
+	// Entries are always sorted, so this makes the output reproducible.
+	FixedModTime time.Time
+}
+
+// Store files whose contents are already compressed, and deflate everything else.
+func DefaultZipMethod(file VfsFileNode) uint16 {
+	if IsPrecompressed(file) {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// Write everything below root to w as a Zip archive, streaming as it goes.
+// Archive paths are relative to root. Archives inside the tree are written as files.
+// Unix modes and symbolic links are kept where nodes know them, and comments
+// become entry comments, or the archive comment for root. Devices and pipes are skipped.
+// archive/zip adds Zip64 records when sizes or the number of entries need them.
+func ExportZip(w io.Writer, root VfsDirNode, opts ZipExportOptions) error {
+	if opts.Method == nil {
+		opts.Method = DefaultZipMethod
+	}
+	z := zip.NewWriter(w)
+	if comment := Comment(root); comment != "" {
+		if err := z.SetComment(comment); err != nil {
+			return err
+		}
+	}
+	if err := exportZipDir(z, root, "", &opts); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func (opts *ZipExportOptions) modTime(node VfsNode) time.Time {
+	if !opts.FixedModTime.IsZero() {
+		return opts.FixedModTime
+	}
+	return node.ModTime()
+}
+
+func exportZipDir(z *zip.Writer, dir VfsDir, path string, opts *ZipExportOptions) error {
+	children, err := dir.Children()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	sort.Sort(byName(children))
+
+	for _, child := range children {
+		childPath := slashpath.Join(path, child.Name())
+		if IsSpecial(child) {
+			continue
+		}
+		if file, ok := child.(VfsFileNode); ok {
+			if err := exportZipFile(z, file, childPath, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		childDir, ok := child.(VfsDir)
+		if !ok {
+			continue
+		}
+		fh := &zip.FileHeader{
+			Name:     childPath + "/",
+			Method:   zip.Store,
+			Modified: opts.modTime(child),
+			Comment:  Comment(child),
+		}
+		fh.SetMode(os.ModeDir | NodePerm(child, 0755))
+		if _, err := z.CreateHeader(fh); err != nil {
+			return err
+		}
+		if err := exportZipDir(z, childDir, childPath, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportZipFile(z *zip.Writer, file VfsFileNode, path string, opts *ZipExportOptions) error {
+	fh := &zip.FileHeader{
+		Name:     path,
+		Method:   opts.Method(file),
+		Modified: opts.modTime(file),
+		Comment:  Comment(file),
+	}
+	fh.SetMode(NodePerm(file, 0644))
+	target, isLink, err := LinkTarget(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if isLink {
+		// Info-ZIP stores the link target as the entry's contents
+		fh.Method = zip.Store
+		fh.SetMode(os.ModeSymlink | 0777)
+		fw, err := z.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(fw, target)
+		return err
+	}
+	fw, err := z.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	defer reader.Close()
+	if _, err := io.Copy(fw, reader); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package arclight
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func exportZipBytes(t *testing.T, root VfsDirNode, opts ZipExportOptions) []byte {
+	buf := new(bytes.Buffer)
+	if err := ExportZip(buf, root, opts); err != nil {
+		t.Fatalf("Couldn't export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func osDir(t *testing.T, path string) *OsDir {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOsDir(path, fi)
+}
+
+// Fixed timestamps make the output depend only on names, contents, and modes
+func TestExportZip_Deterministic(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestExportZip")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	if err := os.Mkdir(filepath.Join(tempdir, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "README"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// umask may have dropped bits
+	if err := os.Chmod(filepath.Join(tempdir, "bin", "run.sh"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed := time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := ZipExportOptions{FixedModTime: fixed}
+	first := exportZipBytes(t, osDir(t, tempdir), opts)
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(tempdir, "README"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	second := exportZipBytes(t, osDir(t, tempdir), opts)
+	if !bytes.Equal(first, second) {
+		t.Errorf("Output changed with mtime")
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"README", "bin/", "bin/run.sh"}
+	if len(z.File) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d", len(expected), len(z.File))
+	}
+	for i, f := range z.File {
+		if f.Name != expected[i] {
+			t.Errorf("Expected entry %d to be %s, got %s", i, expected[i], f.Name)
+		}
+		if !f.Modified.Equal(fixed) {
+			t.Errorf("%s: expected mtime %v, got %v", f.Name, fixed, f.Modified)
+		}
+	}
+	if mode := z.File[2].Mode(); mode.Perm() != 0755 {
+		t.Errorf("Expected run.sh to keep mode 0755, got %v", mode)
+	}
+}
+
+// Comments survive a round trip through ZipArchive
+func TestExportZip_Comments(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "TestExportZip")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	if _, err := w.CreateHeader(&zip.FileHeader{Name: "a.txt", Comment: "entry comment"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetComment("archive comment"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(tempdir, "in.zip")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := NewZipArchive(NewOsFile(path, fi))
+	out := exportZipBytes(t, archive, ZipExportOptions{})
+
+	z, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Comment != "archive comment" {
+		t.Errorf("Expected archive comment %q, got %q", "archive comment", z.Comment)
+	}
+	if len(z.File) != 1 || z.File[0].Comment != "entry comment" {
+		t.Errorf("Expected one entry with comment %q", "entry comment")
+	}
+}
@@ -4,13 +4,25 @@ import (
 	"archive/zip"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
 	slashpath "path"
 	"strings"
+	"sync"
 	"time"
 )
 
+// The central directory is read once, and the archive stays open until Close(),
+// so archives nested in other archives are only spooled once.
 type ZipArchive struct {
 	VfsFileNode
+
+	mutex     sync.Mutex
+	opened    bool
+	z         *zip.Reader
+	reader    SeekableReader
+	openErr   error
+	nodeCache []zipNode
 }
 
 func NewZipArchive(file VfsFileNode) VfsDirFileNode {
@@ -18,48 +30,78 @@ func NewZipArchive(file VfsFileNode) VfsDirFileNode {
 	arc.VfsFileNode = file
 
 	// attempt to add Zip file comment to attrs
-	reader, err := arc.Open()
-	if err != nil {
-		defer reader.Close()
-
-		readerat, ok := reader.(io.ReaderAt)
-		if ok {
-			z, err := zip.NewReader(readerat, arc.Size())
-			if err == nil && z.Comment != "" {
-				arc.Attrs()["zip.comment"] = z.Comment
-			}
-		}
+	if z, err := arc.openZip(); err == nil && z.Comment != "" {
+		arc.Attrs()["zip.comment"] = z.Comment
 	}
 
 	return arc
 }
 
-func (arc *ZipArchive) nodes() ([]zipNode, error) {
-	reader, err := arc.Open()
+// Read the archive's central directory, once.
+// Archives nested in other archives are spooled, since zip.Reader needs random access.
+func (arc *ZipArchive) openZip() (*zip.Reader, error) {
+	arc.mutex.Lock()
+	defer arc.mutex.Unlock()
+	if arc.opened {
+		return arc.z, arc.openErr
+	}
+	arc.opened = true
+
+	reader, err := OpenSeekable(arc.VfsFileNode)
 	if err != nil {
+		arc.openErr = err
 		return nil, err
 	}
-	defer reader.Close()
 
-	readerat, ok := reader.(io.ReaderAt)
-	if !ok {
-		err := fmt.Errorf("%T's Reader() doesn't implement readat()",
-			arc.VfsFileNode)
+	z, err := zip.NewReader(reader, arc.Size())
+	if err != nil {
+		reader.Close()
+		arc.openErr = err
 		return nil, err
 	}
 
-	z, err := zip.NewReader(readerat, arc.Size())
+	arc.z = z
+	arc.reader = reader
+	return z, nil
+}
+
+// Close the archive's file or spool. Nodes from the archive can't be read after this.
+func (arc *ZipArchive) Close() error {
+	arc.mutex.Lock()
+	defer arc.mutex.Unlock()
+	arc.opened = true
+	if arc.openErr == nil {
+		arc.openErr = fmt.Errorf("Archive is closed: %s", arc.Name())
+	}
+	arc.z = nil
+	arc.nodeCache = nil
+	if arc.reader == nil {
+		return nil
+	}
+	reader := arc.reader
+	arc.reader = nil
+	return reader.Close()
+}
+
+func (arc *ZipArchive) nodes() ([]zipNode, error) {
+	z, err := arc.openZip()
 	if err != nil {
 		return nil, err
 	}
 
+	arc.mutex.Lock()
+	defer arc.mutex.Unlock()
+	if arc.nodeCache != nil {
+		return arc.nodeCache, nil
+	}
+
 	nodes := make([]zipNode, len(z.File))
 	paths := make([]string, len(z.File))
 	for i, f := range z.File {
 		if f.FileInfo().IsDir() {
 			nodes[i] = NewZipDir(arc, &f.FileHeader)
 		} else {
-			nodes[i] = NewZipFile(f)
+			nodes[i] = NewZipFile(arc, i, f)
 		}
 		paths[i] = nodes[i].arcPath()
 	}
@@ -68,6 +110,7 @@ func (arc *ZipArchive) nodes() ([]zipNode, error) {
 		nodes = append(nodes, NewImplicitZipDir(arc, path))
 	}
 
+	arc.nodeCache = nodes
 	return nodes, nil
 }
 
@@ -116,7 +159,7 @@ func (arc *ZipArchive) Resolve(relpath string) (VfsNode, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("Archive path not found", relpath)
+	return nil, fmt.Errorf("Archive path not found: %s", relpath)
 }
 
 // All nodes inside the Zip archive have an internal path
@@ -136,15 +179,23 @@ func depth(zn zipNode) int {
 // A file inside the archive
 type ZipFile struct {
 	attrs NodeAttrs
+	arc   *ZipArchive
+	index int
 	f     *zip.File
+
+	mimeOnce   sync.Once
+	mediatype  string
+	mimeParams map[string]string
 }
 
-func NewZipFile(f *zip.File) *ZipFile {
+func NewZipFile(arc *ZipArchive, index int, f *zip.File) *ZipFile {
 	node := new(ZipFile)
 	node.attrs = make(NodeAttrs)
 	if f.Comment != "" {
 		node.attrs["zip.comment"] = f.Comment
 	}
+	node.arc = arc
+	node.index = index
 	node.f = f
 	return node
 }
@@ -169,14 +220,79 @@ func (node *ZipFile) ModTime() time.Time {
 	return node.f.FileInfo().ModTime()
 }
 
+func (node *ZipFile) Header() *zip.FileHeader {
+	return &node.f.FileHeader
+}
+
+func (node *ZipFile) Mode() os.FileMode {
+	return node.f.Mode()
+}
+
+// Symbolic links store their target as the entry's contents.
+func (node *ZipFile) Readlink() (string, error) {
+	if node.Mode()&os.ModeSymlink == 0 {
+		return "", fmt.Errorf("Not a symbolic link: %s", node.f.Name)
+	}
+	reader, err := node.Open()
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	target, err := ioutil.ReadAll(io.LimitReader(reader, 4096))
+	return string(target), err
+}
+
+// Sniffing means decompressing the start of the member, so it's only done once.
 func (node *ZipFile) MimeType() (string, map[string]string) {
-	return OctetStream, nil // TODO
+	node.mimeOnce.Do(func() {
+		node.mediatype, node.mimeParams = MimeTypeFromReader(node.Open)
+		if node.mediatype == OctetStream {
+			node.mediatype, node.mimeParams = MimeTypeByExt(node.Name())
+		}
+	})
+	return node.mediatype, node.mimeParams
 }
 
+// The archive that node.f came from stays open, so members can be read from it directly.
 func (node *ZipFile) Open() (io.ReadCloser, error) {
 	return node.f.Open()
 }
 
+// Stored members can be read in place if the archive itself can.
+func (node *ZipFile) Seekable() bool {
+	return node.f.Method == zip.Store && IsSeekable(node.arc.VfsFileNode)
+}
+
+func (node *ZipFile) CRC32() uint32 {
+	return node.f.CRC32
+}
+
+// Stored members can be read in place. Compressed members are spooled.
+func (node *ZipFile) OpenSeekable() (SeekableReader, error) {
+	if node.f.Method != zip.Store {
+		reader, err := node.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return spool(reader, node.Size())
+	}
+
+	offset, err := node.f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	node.arc.mutex.Lock()
+	reader := node.arc.reader
+	node.arc.mutex.Unlock()
+	if reader == nil {
+		return nil, fmt.Errorf("Archive is closed: %s", node.arc.Name())
+	}
+	section := io.NewSectionReader(reader, offset, int64(node.f.UncompressedSize64))
+	// closing the member leaves the archive open for its other members
+	return &sectionReadCloser{section, ioutil.NopCloser(nil)}, nil
+}
+
 // A directory inside the archive
 type ZipDir struct {
 	attrs NodeAttrs
@@ -215,6 +331,10 @@ func (node *ZipDir) MimeType() (string, map[string]string) {
 	return InodeDirectory, nil
 }
 
+func (node *ZipDir) Mode() os.FileMode {
+	return node.fh.Mode()
+}
+
 func (node *ZipDir) Children() ([]VfsNode, error) {
 	return node.arc.childrenOf(node)
 }
@@ -245,6 +365,10 @@ func (node *ImplicitZipDir) arcPath() string {
 	return node.path
 }
 
+func (node *ImplicitZipDir) Implicit() bool {
+	return true
+}
+
 func (node *ImplicitZipDir) Attrs() NodeAttrs {
 	return node.attrs
 }
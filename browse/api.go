@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// JSON API, version 1. Paths after the endpoint name are browse paths
+// without a leading slash: /api!/v1/stat/media/photos.zip/archive!/2014
+const apiPrefix = "/api!/v1/"
+
+const (
+	defaultListLimit    = 100
+	maxListLimit        = 1000
+	defaultPreviewBytes = 4096
+	maxPreviewBytes     = 1024 * 1024
+)
+
+type apiEndpoint func(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error
+
+var apiEndpoints = map[string]apiEndpoint{
+	"list":    apiList,
+	"stat":    apiStat,
+	"preview": apiPreview,
+	"content": apiContent,
+}
+
+// A node as seen by API clients.
+type apiNode struct {
+	Name       string             `json:"name"`
+	Path       string             `json:"path"`
+	URL        string             `json:"url"`
+	Type       string             `json:"type"`
+	MimeType   string             `json:"mimetype"`
+	MimeParams map[string]string  `json:"mimeparams,omitempty"`
+	Size       int64              `json:"size"`
+	ModTime    time.Time          `json:"mtime"`
+	Attrs      arclight.NodeAttrs `json:"attrs,omitempty"`
+	// Present for archives that can be listed by appending "/archive!" to the path.
+	ArchivePath string `json:"archivepath,omitempty"`
+}
+
+func newAPINode(node arclight.VfsNode, path, nodeURL string) *apiNode {
+	n := &apiNode{
+		Name:    node.Name(),
+		Path:    path,
+		URL:     nodeURL,
+		ModTime: node.ModTime(),
+	}
+	n.MimeType, n.MimeParams = node.MimeType()
+	if len(node.Attrs()) > 0 {
+		n.Attrs = node.Attrs()
+	}
+	_, isDir := node.(arclight.VfsDir)
+	file, isFile := node.(arclight.VfsFile)
+	switch {
+	case isDir:
+		n.Type = "dir"
+	case isFile:
+		n.Type = "file"
+		n.Size = file.Size()
+		if isArchive(node) {
+			n.ArchivePath = path + "/" + archiveSegment
+		}
+	}
+	return n
+}
+
+type apiError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type apiErrorBody struct {
+	Error apiError `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(data)
+}
+
+// Like server.handler(), but reports errors as JSON.
+func (srv *server) apiHandler(serve func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := serve(w, r); err != nil {
+			status := errorStatus(err)
+			log.Printf("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+			body := apiErrorBody{apiError{status, err.Error()}}
+			if err := writeJSON(w, status, body); err != nil {
+				log.Printf("Couldn't write API error: %v", err)
+			}
+		}
+	})
+}
+
+func (srv *server) serveAPI(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return errorf(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+	}
+
+	rest := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	segments := strings.Split(strings.Trim(rest, "/"), "/")
+	if segments[0] == "roots" && len(segments) == 1 {
+		return srv.apiRoots(w, r)
+	}
+	if segments[0] == "search" && len(segments) == 1 {
+		return srv.apiSearch(w, r)
+	}
+	endpoint, ok := apiEndpoints[segments[0]]
+	if !ok {
+		return errorf(http.StatusNotFound, "Unknown API endpoint %#v", segments[0])
+	}
+	if len(segments) < 2 || segments[1] == "" {
+		return errorf(http.StatusBadRequest, "API endpoint %s needs a path", segments[0])
+	}
+
+	target, err := srv.resolveSegments(r, segments[1:])
+	if err != nil {
+		return err
+	}
+	return endpoint(srv, w, r, target)
+}
+
+func (srv *server) apiRoots(w http.ResponseWriter, r *http.Request) error {
+	roots := []*apiNode{}
+	for _, name := range srv.visibleRoots(requestUser(r)) {
+		root := newAPINode(srv.roots[name].node, name, "/"+url.PathEscape(name))
+		root.Name = name
+		roots = append(roots, root)
+	}
+	return writeJSON(w, http.StatusOK, roots)
+}
+
+type apiListing struct {
+	Dir      *apiNode   `json:"dir"`
+	Total    int        `json:"total"`
+	Offset   int        `json:"offset"`
+	Limit    int        `json:"limit"`
+	Children []*apiNode `json:"children"`
+}
+
+// Parse an integer query parameter, clamped to [min, max].
+func intParam(r *http.Request, name string, defaultValue, min, max int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errorf(http.StatusBadRequest, "Parameter %s must be an integer", name)
+	}
+	if value < min {
+		value = min
+	}
+	if value > max {
+		value = max
+	}
+	return value, nil
+}
+
+var apiSortKeys = map[string]func(a, b *apiNode) bool{
+	"name": func(a, b *apiNode) bool {
+		return a.Name < b.Name
+	},
+	"size": func(a, b *apiNode) bool {
+		return a.Size < b.Size
+	},
+	"mtime": func(a, b *apiNode) bool {
+		return a.ModTime.Before(b.ModTime)
+	},
+	"type": func(a, b *apiNode) bool {
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.MimeType < b.MimeType
+	},
+}
+
+type apiNodeSorter struct {
+	nodes []*apiNode
+	less  func(a, b *apiNode) bool
+}
+
+func (s apiNodeSorter) Len() int {
+	return len(s.nodes)
+}
+
+func (s apiNodeSorter) Swap(i, j int) {
+	s.nodes[i], s.nodes[j] = s.nodes[j], s.nodes[i]
+}
+
+func (s apiNodeSorter) Less(i, j int) bool {
+	return s.less(s.nodes[i], s.nodes[j])
+}
+
+// List a directory or archive directory.
+// Query parameters: offset, limit, sort (name, size, mtime, type), order (asc, desc).
+func apiList(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	dir, ok := target.node.(arclight.VfsDir)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a directory: %s", target.Path)
+	}
+
+	offset, err := intParam(r, "offset", 0, 0, int(^uint(0)>>1))
+	if err != nil {
+		return err
+	}
+	limit, err := intParam(r, "limit", defaultListLimit, 1, maxListLimit)
+	if err != nil {
+		return err
+	}
+	sortKey := r.URL.Query().Get("sort")
+	if sortKey == "" {
+		sortKey = "name"
+	}
+	less, ok := apiSortKeys[sortKey]
+	if !ok {
+		return errorf(http.StatusBadRequest, "Unknown sort key %#v", sortKey)
+	}
+	switch order := r.URL.Query().Get("order"); order {
+	case "", "asc":
+	case "desc":
+		ascending := less
+		less = func(a, b *apiNode) bool {
+			return ascending(b, a)
+		}
+	default:
+		return errorf(http.StatusBadRequest, "Unknown sort order %#v", order)
+	}
+
+	children, err := dir.Children()
+	if err != nil {
+		return err
+	}
+	nodes := make([]*apiNode, len(children))
+	for i, child := range children {
+		nodes[i] = newAPINode(child, target.Path+"/"+escapeName(child.Name()), childURL(target, child))
+	}
+	// stable, with names breaking ties
+	sort.Sort(apiNodeSorter{nodes, apiSortKeys["name"]})
+	sort.Stable(apiNodeSorter{nodes, less})
+
+	listing := apiListing{
+		Dir:      newAPINode(target.node, target.Path, target.URL),
+		Total:    len(nodes),
+		Offset:   offset,
+		Limit:    limit,
+		Children: []*apiNode{},
+	}
+	if offset < len(nodes) {
+		end := offset + limit
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		listing.Children = nodes[offset:end]
+	}
+	return writeJSON(w, http.StatusOK, listing)
+}
+
+func apiStat(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	return writeJSON(w, http.StatusOK, newAPINode(target.node, target.Path, target.URL))
+}
+
+type apiPreviewBody struct {
+	Node      *apiNode `json:"node"`
+	Bytes     int      `json:"bytes"`
+	Truncated bool     `json:"truncated"`
+	// Invalid UTF-8 sequences are replaced with U+FFFD.
+	Text string `json:"text"`
+}
+
+// The first N bytes of a file as text. Query parameter: bytes.
+func apiPreview(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	file, ok := target.node.(arclight.VfsFile)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a file: %s", target.Path)
+	}
+	n, err := intParam(r, "bytes", defaultPreviewBytes, 0, maxPreviewBytes)
+	if err != nil {
+		return err
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	buf := make([]byte, n+1)
+	read, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	body := apiPreviewBody{
+		Node:      newAPINode(target.node, target.Path, target.URL),
+		Truncated: read > n,
+	}
+	if body.Truncated {
+		read = n
+		// don't cut a multibyte character in half
+		for read > 0 && read > n-utf8.UTFMax && !utf8.RuneStart(buf[read]) {
+			read--
+		}
+	}
+	body.Bytes = read
+	body.Text = strings.ToValidUTF8(string(buf[:read]), "�")
+	return writeJSON(w, http.StatusOK, body)
+}
+
+// Raw file contents, like the download! action but displayed inline.
+func apiContent(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	return srv.serveContent(w, r, target, "inline")
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+const authRealm = "Mighty Browse"
+
+// Checks one kind of credentials.
+type authenticator interface {
+	// Name of the user whose credentials are on the request, or "" if it doesn't have any
+	// this authenticator understands. Wrong credentials are an error.
+	authenticate(r *http.Request) (string, error)
+	// Value for a WWW-Authenticate header asking for credentials.
+	challenge() string
+}
+
+// How long a checked password is remembered, so clients that send Basic credentials
+// with every request don't pay for bcrypt on each one.
+const passwordCacheTTL = 5 * time.Minute
+
+// Users who get a password wrong this many times are refused until failureWindow has passed
+// since the first failure, without checking any more passwords.
+// Checks still running count against the limit, so a burst of guesses can't get past it.
+const (
+	maxPasswordFailures = 5
+	failureWindow       = time.Minute
+)
+
+// HTTP Basic authentication against an htpasswd file.
+// Only bcrypt hashes are supported, as created by htpasswd -B.
+type htpasswdAuth struct {
+	hashes map[string][]byte
+	mutex  sync.Mutex
+	// Expiry times of user, password, and hash combinations that bcrypt accepted,
+	// keyed by a SHA-256 of all three so the passwords themselves aren't kept.
+	verified map[[sha256.Size]byte]time.Time
+	failures map[string]*passwordFailures
+	// checked for unknown users, so they take as long to turn away as wrong passwords
+	unknownUserHash []byte
+}
+
+type passwordFailures struct {
+	count    int
+	inFlight int
+	since    time.Time
+}
+
+func loadHtpasswd(path string) (*htpasswdAuth, error) {
+	auth := &htpasswdAuth{
+		hashes:   make(map[string][]byte),
+		verified: make(map[[sha256.Size]byte]time.Time),
+		failures: make(map[string]*passwordFailures),
+	}
+	err := readConfigLines(path, func(line string) error {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return fmt.Errorf("Expected user:hash")
+		}
+		user, hash := line[:i], line[i+1:]
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("User %s doesn't have a bcrypt hash", user)
+		}
+		auth.hashes[user] = []byte(hash)
+		if auth.unknownUserHash == nil {
+			auth.unknownUserHash = []byte(hash)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func (auth *htpasswdAuth) authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", nil
+	}
+	hash, ok := auth.hashes[user]
+	if !ok {
+		bcrypt.CompareHashAndPassword(auth.unknownUserHash, []byte(password))
+		return "", errorf(http.StatusUnauthorized, "Wrong user name or password")
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + password + "\x00" + string(hash)))
+	now := time.Now()
+	auth.mutex.Lock()
+	if expires, cached := auth.verified[key]; cached && now.Before(expires) {
+		auth.mutex.Unlock()
+		return user, nil
+	}
+	failures := auth.failures[user]
+	if failures == nil {
+		failures = new(passwordFailures)
+		auth.failures[user] = failures
+	}
+	if failures.count > 0 && now.Sub(failures.since) >= failureWindow {
+		failures.count = 0
+	}
+	if failures.count+failures.inFlight >= maxPasswordFailures {
+		auth.mutex.Unlock()
+		return "", errorf(http.StatusTooManyRequests, "Too many wrong passwords for %s; try again later", user)
+	}
+	failures.inFlight++
+	auth.mutex.Unlock()
+
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+	failures.inFlight--
+	if err != nil {
+		if failures.count == 0 {
+			failures.since = now
+		}
+		failures.count++
+		return "", errorf(http.StatusUnauthorized, "Wrong user name or password")
+	}
+	for oldKey, oldExpires := range auth.verified {
+		if !now.Before(oldExpires) {
+			delete(auth.verified, oldKey)
+		}
+	}
+	auth.verified[key] = now.Add(passwordCacheTTL)
+	failures.count = 0
+	if failures.inFlight == 0 {
+		delete(auth.failures, user)
+	}
+	return user, nil
+}
+
+func (auth *htpasswdAuth) challenge() string {
+	return fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, authRealm)
+}
+
+// Static bearer tokens, from a file with a token and a user name on each line.
+// Tokens are kept hashed so looking one up doesn't leak timing information about the others.
+type tokenAuth struct {
+	users map[[sha256.Size]byte]string
+}
+
+func loadTokens(path string) (*tokenAuth, error) {
+	auth := &tokenAuth{users: make(map[[sha256.Size]byte]string)}
+	err := readConfigLines(path, func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("Expected token and user name")
+		}
+		auth.users[sha256.Sum256([]byte(fields[0]))] = fields[1]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func (auth *tokenAuth) authenticate(r *http.Request) (string, error) {
+	header := r.Header.Get("Authorization")
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", nil
+	}
+	user, ok := auth.users[sha256.Sum256([]byte(strings.TrimSpace(header[len(prefix):])))]
+	if !ok {
+		return "", errorf(http.StatusUnauthorized, "Invalid bearer token")
+	}
+	return user, nil
+}
+
+func (auth *tokenAuth) challenge() string {
+	return fmt.Sprintf(`Bearer realm="%s"`, authRealm)
+}
+
+// Call parse for each line of a file that isn't blank or a # comment.
+func readConfigLines(path string, parse func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := parse(line); err != nil {
+			return fmt.Errorf("%s:%d: %v", path, lineNum, err)
+		}
+	}
+	return scanner.Err()
+}
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	archivesKey
+)
+
+// Authenticated user name for a request, or "" if authentication is off.
+func requestUser(r *http.Request) string {
+	user, _ := r.Context().Value(userKey).(string)
+	return user
+}
+
+// Who a request is from. With no authenticators configured, everyone is anonymous.
+func (srv *server) authenticate(r *http.Request) (string, error) {
+	if len(srv.auth) == 0 {
+		return "", nil
+	}
+	for _, auth := range srv.auth {
+		user, err := auth.authenticate(r)
+		if err != nil || user != "" {
+			return user, err
+		}
+	}
+	return "", errorf(http.StatusUnauthorized, "Authentication required")
+}
+
+// Can this user see this root? Roots without an allow list are open to anyone who can log in.
+// Allow lists name users, groups as @group, or * for any user.
+func (srv *server) allowed(user string, root *browseRoot) bool {
+	return len(root.Allow) == 0 || srv.inList(user, root.Allow)
+}
+
+// Can this user change files in this root? Writing needs an authenticated user
+// named by the root's write list, so every root is read-only without authentication.
+func (srv *server) canWrite(user string, root *browseRoot) bool {
+	return user != "" && srv.inList(user, root.Write)
+}
+
+func (srv *server) inList(user string, list []string) bool {
+	for _, entry := range list {
+		switch {
+		case entry == "*" || entry == user:
+			return true
+		case strings.HasPrefix(entry, "@"):
+			for _, member := range srv.opts.Groups[entry[1:]] {
+				if member == user {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Names of the roots a user can see, sorted.
+func (srv *server) visibleRoots(user string) []string {
+	var names []string
+	for _, name := range srv.rootNames {
+		if srv.allowed(user, srv.roots[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Names of the roots a user can write to, sorted.
+func (srv *server) writableRoots(user string) []string {
+	var names []string
+	for _, name := range srv.rootNames {
+		if srv.allowed(user, srv.roots[name]) && srv.canWrite(user, srv.roots[name]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Records status and size for the access log.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (lw *loggingResponseWriter) WriteHeader(status int) {
+	if lw.status == 0 {
+		lw.status = status
+	}
+	lw.ResponseWriter.WriteHeader(status)
+}
+
+func (lw *loggingResponseWriter) Write(p []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+	n, err := lw.ResponseWriter.Write(p)
+	lw.size += int64(n)
+	return n, err
+}
+
+// Streaming responses need to flush through the wrapper.
+func (lw *loggingResponseWriter) Flush() {
+	if flusher, ok := lw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Open the access log: a file path, - for stderr, or "" for none.
+func openAccessLog(path string) (*log.Logger, error) {
+	var w io.Writer
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		w = os.Stderr
+	default:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w = f
+	}
+	return log.New(w, "", 0), nil
+}
+
+// Write a Common Log Format line: host ident authuser [date] "request" status bytes
+func (srv *server) logAccess(r *http.Request, user string, lw *loggingResponseWriter, start time.Time) {
+	if srv.accessLog == nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if user == "" {
+		user = "-"
+	}
+	status := lw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	size := "-"
+	if lw.size > 0 {
+		size = fmt.Sprintf("%d", lw.size)
+	}
+	srv.accessLog.Printf(`%s - %s [%s] "%s %s %s" %d %s`,
+		host, user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.RequestURI, r.Proto, status, size)
+}
+
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	lw := &loggingResponseWriter{ResponseWriter: w}
+	user, err := srv.authenticate(r)
+	if err != nil {
+		for _, auth := range srv.auth {
+			lw.Header().Add("WWW-Authenticate", auth.challenge())
+		}
+		fail := func(w http.ResponseWriter, r *http.Request) error {
+			return err
+		}
+		if strings.HasPrefix(r.URL.Path, apiPrefix) {
+			srv.apiHandler(fail).ServeHTTP(lw, r)
+		} else {
+			srv.handler(fail).ServeHTTP(lw, r)
+		}
+	} else {
+		archives := new(arclight.Archives)
+		ctx := context.WithValue(r.Context(), userKey, user)
+		ctx = context.WithValue(ctx, archivesKey, archives)
+		srv.mux.ServeHTTP(lw, r.WithContext(ctx))
+		archives.Close()
+	}
+	srv.logAccess(r, user, lw, start)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testToken = "0123456789abcdef"
+
+// alice can log in with a password or a token, and is the only one who can see "private"
+// or write to "uploads". bob can log in but not see "private".
+func newAuthTestServer(t *testing.T) *testServer {
+	return newTestServer(t, serverOptions{}, func(tempdir string, opts *serverOptions, roots map[string]*browseRoot) {
+		var htpasswd []byte
+		for _, user := range []string{"alice", "bob"} {
+			hash, err := bcrypt.GenerateFromPassword([]byte(user+"-password"), bcrypt.MinCost)
+			if err != nil {
+				t.Fatal(err)
+			}
+			htpasswd = append(htpasswd, user+":"+string(hash)+"\n"...)
+		}
+		opts.Htpasswd = filepath.Join(tempdir, "htpasswd")
+		if err := ioutil.WriteFile(opts.Htpasswd, htpasswd, 0600); err != nil {
+			t.Fatal(err)
+		}
+		opts.Tokens = filepath.Join(tempdir, "tokens")
+		if err := ioutil.WriteFile(opts.Tokens, []byte("# token user\n"+testToken+" alice\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		roots["files"].Allow = []string{"alice"}
+		roots["uploads"].Write = []string{"alice"}
+	})
+}
+
+func basicAuth(user, password string) http.Header {
+	return basicAuthRequest(user, password).Header
+}
+
+func TestAuth(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{"no credentials", "/files/hello.txt/download!", nil, http.StatusUnauthorized},
+		{"wrong password", "/files/hello.txt/download!", basicAuth("alice", "bob-password"), http.StatusUnauthorized},
+		{"unknown user", "/files/hello.txt/download!", basicAuth("carol", "carol-password"), http.StatusUnauthorized},
+		{"wrong token", "/files/hello.txt/download!", http.Header{"Authorization": {"Bearer nope"}}, http.StatusUnauthorized},
+		{"password", "/files/hello.txt/download!", basicAuth("alice", "alice-password"), http.StatusOK},
+		{"token", "/files/hello.txt/download!", http.Header{"Authorization": {"Bearer " + testToken}}, http.StatusOK},
+		{"not on the allow list", "/files/hello.txt/download!", basicAuth("bob", "bob-password"), http.StatusForbidden},
+		{"no allow list", "/uploads", basicAuth("bob", "bob-password"), http.StatusOK},
+		{"API without credentials", apiPrefix + "roots", nil, http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		resp, body := ts.get(t, test.path, test.header)
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.name, test.status, resp.StatusCode, body)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && len(resp.Header["Www-Authenticate"]) != 2 {
+			t.Errorf("%s: expected Basic and Bearer challenges, got %v", test.name, resp.Header["Www-Authenticate"])
+		}
+	}
+}
+
+// Roots that aren't allowed are left out of listings too
+func TestAuth_VisibleRoots(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		user     string
+		expected string
+	}{
+		{"alice", "files,uploads"},
+		{"bob", "uploads"},
+	}
+	for _, test := range tests {
+		_, body := ts.get(t, apiPrefix+"roots", basicAuth(test.user, test.user+"-password"))
+		var roots []apiNode
+		if err := json.Unmarshal(body, &roots); err != nil {
+			t.Fatalf("Couldn't parse %s: %v", body, err)
+		}
+		var names []string
+		for _, root := range roots {
+			names = append(names, root.Name)
+		}
+		if strings.Join(names, ",") != test.expected {
+			t.Errorf("%s: expected %s, got %v", test.user, test.expected, names)
+		}
+	}
+}
+
+func basicAuthRequest(user, password string) *http.Request {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.SetBasicAuth(user, password)
+	return req
+}
+
+// Once a password has been checked, it's remembered even while wrong passwords are being refused,
+// and a different right password has to wait.
+func TestHtpasswd_CacheAndRateLimit(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+	auth, err := loadHtpasswd(ts.srv.opts.Htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user, err := auth.authenticate(basicAuthRequest("alice", "alice-password")); user != "alice" || err != nil {
+		t.Fatalf("Expected alice, got %#v, %v", user, err)
+	}
+	if len(auth.verified) != 1 {
+		t.Errorf("Expected one remembered password, got %d", len(auth.verified))
+	}
+	for i := 0; i < maxPasswordFailures; i++ {
+		_, err := auth.authenticate(basicAuthRequest("alice", "guess"))
+		if errorStatus(err) != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for wrong password %d, got %v", i, err)
+		}
+	}
+	_, err = auth.authenticate(basicAuthRequest("alice", "guess"))
+	if errorStatus(err) != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after %d wrong passwords, got %v", maxPasswordFailures, err)
+	}
+	if user, err := auth.authenticate(basicAuthRequest("alice", "alice-password")); user != "alice" || err != nil {
+		t.Errorf("Expected the remembered password to work, got %#v, %v", user, err)
+	}
+	if user, err := auth.authenticate(basicAuthRequest("bob", "bob-password")); user != "bob" || err != nil {
+		t.Errorf("Expected other users to be unaffected, got %#v, %v", user, err)
+	}
+
+	auth.verified = make(map[[sha256.Size]byte]time.Time)
+	_, err = auth.authenticate(basicAuthRequest("alice", "alice-password"))
+	if errorStatus(err) != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for an unremembered password, got %v", err)
+	}
+	auth.failures["alice"].since = time.Now().Add(-failureWindow)
+	if user, err := auth.authenticate(basicAuthRequest("alice", "alice-password")); user != "alice" || err != nil {
+		t.Errorf("Expected alice after the failure window, got %#v, %v", user, err)
+	}
+}
+
+// Guesses made at the same time can't get more than maxPasswordFailures checked between them.
+func TestHtpasswd_ParallelGuesses(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+	auth, err := loadHtpasswd(ts.srv.opts.Htpasswd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const guesses = 4 * maxPasswordFailures
+	statuses := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := auth.authenticate(basicAuthRequest("bob", "guess"))
+			statuses <- errorStatus(err)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] != maxPasswordFailures {
+		t.Errorf("Expected %d wrong passwords checked, got %d", maxPasswordFailures, counts[http.StatusUnauthorized])
+	}
+	if counts[http.StatusTooManyRequests] != guesses-maxPasswordFailures {
+		t.Errorf("Expected %d guesses refused, got %d", guesses-maxPasswordFailures, counts[http.StatusTooManyRequests])
+	}
+}
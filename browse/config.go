@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Settings read from a -config file. Flags given on the command line override them.
+//
+//	{
+//	    "listen": ":5000",
+//	    "tls_cert": "/etc/browse/cert.pem",
+//	    "tls_key": "/etc/browse/key.pem",
+//	    "htpasswd": "/etc/browse/htpasswd",
+//	    "tokens": "/etc/browse/tokens",
+//	    "access_log": "/var/log/browse/access.log",
+//	    "groups": {"family": ["alice", "bob"]},
+//	    "roots": [
+//	        {"name": "photos", "path": "/srv/photos", "allow": ["@family"], "write": ["alice"]},
+//	        {"name": "public", "path": "/srv/public"}
+//	    ]
+//	}
+type browseConfig struct {
+	Listen    string              `json:"listen"`
+	TLSCert   string              `json:"tls_cert"`
+	TLSKey    string              `json:"tls_key"`
+	Htpasswd  string              `json:"htpasswd"`
+	Tokens    string              `json:"tokens"`
+	AccessLog string              `json:"access_log"`
+	Groups    map[string][]string `json:"groups"`
+	Roots     []rootConfig        `json:"roots"`
+}
+
+type rootConfig struct {
+	Name  string   `json:"name"`
+	Path  string   `json:"path"`
+	Allow []string `json:"allow"`
+	Write []string `json:"write"`
+}
+
+func loadConfig(path string) (*browseConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := new(browseConfig)
+	dec := json.NewDecoder(f)
+	// catch typos in setting names
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// Roots declared by the config file, with their allow lists.
+func (config *browseConfig) browseRoots() ([]*browseRoot, error) {
+	var roots []*browseRoot
+	for _, rc := range config.Roots {
+		root, err := newBrowseRoot(rc.Name, rc.Path)
+		if err != nil {
+			return nil, err
+		}
+		root.Allow = rc.Allow
+		root.Write = rc.Write
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+func downloadNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	return srv.serveContent(w, r, target, "attachment")
+}
+
+// Files that know the CRC-32 of their contents, such as Zip members.
+type crcFile interface {
+	CRC32() uint32
+}
+
+// Strong validator built from size, mtime, and CRC-32 if we have it.
+func etag(node arclight.VfsNode, file arclight.VfsFile) string {
+	tag := fmt.Sprintf("%x-%x", file.Size(), node.ModTime().UnixNano())
+	if crc, ok := node.(crcFile); ok {
+		tag += fmt.Sprintf("-%08x", crc.CRC32())
+	}
+	return `"` + tag + `"`
+}
+
+// Serve a file's contents with conditional GET and Range support.
+// Files that can't seek without spooling only honor Range requests if they're small enough to spool.
+func (srv *server) serveContent(w http.ResponseWriter, r *http.Request, target *browseTarget, disposition string) error {
+	file, ok := target.node.(arclight.VfsFile)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a file: %s", target.Path)
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", formatMimeType(target.node))
+	header.Set("ETag", etag(target.node, file))
+	header.Set("Content-Disposition",
+		mime.FormatMediaType(disposition, map[string]string{"filename": target.node.Name()}))
+
+	if !arclight.IsSeekable(file) && file.Size() > srv.opts.MaxSpool {
+		// RFC 7233 lets us ignore Range and send the whole thing
+		r.Header.Del("Range")
+	}
+
+	content := &lazySeeker{file: file}
+	defer func() {
+		if err := content.Close(); err != nil {
+			// too late to send an error page
+			log.Printf("%s %s: download interrupted: %v", r.Method, r.URL.Path, err)
+		}
+	}()
+	http.ServeContent(w, r, target.node.Name(), target.node.ModTime(), content)
+	return nil
+}
+
+// Feeds a file to http.ServeContent(). Requests for the whole file stream from Open(),
+// and only seeking to the middle of the file opens a SeekableReader.
+type lazySeeker struct {
+	file     arclight.VfsFile
+	pos      int64
+	stream   io.ReadCloser
+	seekable arclight.SeekableReader
+	// first error, reported by Close() since ServeContent() ignores them
+	err error
+}
+
+func (ls *lazySeeker) fail(err error) error {
+	if ls.err == nil && err != io.EOF {
+		ls.err = err
+	}
+	return err
+}
+
+func (ls *lazySeeker) Read(p []byte) (int, error) {
+	if ls.seekable == nil && ls.stream == nil {
+		if ls.pos >= ls.file.Size() {
+			return 0, io.EOF
+		}
+		var err error
+		if ls.pos == 0 {
+			ls.stream, err = ls.file.Open()
+		} else {
+			err = ls.openSeekable()
+		}
+		if err != nil {
+			return 0, ls.fail(err)
+		}
+	}
+
+	var n int
+	var err error
+	if ls.seekable != nil {
+		n, err = ls.seekable.Read(p)
+	} else {
+		n, err = ls.stream.Read(p)
+	}
+	ls.pos += int64(n)
+	if err != nil {
+		ls.fail(err)
+	}
+	return n, err
+}
+
+func (ls *lazySeeker) openSeekable() error {
+	seekable, err := arclight.OpenSeekable(ls.file)
+	if err != nil {
+		return err
+	}
+	if _, err := seekable.Seek(ls.pos, io.SeekStart); err != nil {
+		seekable.Close()
+		return err
+	}
+	ls.seekable = seekable
+	return nil
+}
+
+func (ls *lazySeeker) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = ls.pos + offset
+	case io.SeekEnd:
+		abs = ls.file.Size() + offset
+	default:
+		return 0, ls.fail(errors.New("lazySeeker.Seek: invalid whence"))
+	}
+	if abs < 0 {
+		return 0, ls.fail(errors.New("lazySeeker.Seek: negative position"))
+	}
+	if abs == ls.pos {
+		return abs, nil
+	}
+
+	if ls.seekable == nil && ls.stream != nil {
+		// can't rewind a stream
+		ls.stream.Close()
+		ls.stream = nil
+	}
+	ls.pos = abs
+	if ls.seekable != nil {
+		if _, err := ls.seekable.Seek(abs, io.SeekStart); err != nil {
+			return 0, ls.fail(err)
+		}
+	}
+	return abs, nil
+}
+
+func (ls *lazySeeker) Close() error {
+	if ls.stream != nil {
+		ls.stream.Close()
+	}
+	if ls.seekable != nil {
+		ls.seekable.Close()
+	}
+	return ls.err
+}
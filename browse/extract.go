@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// Progress of running jobs is streamed as Server-Sent Events from /jobs!/<id>
+const jobsPrefix = "/jobs!/"
+
+// How long finished jobs can still be watched.
+const jobRetention = 10 * time.Minute
+
+// Report progress at least this often while copying a large file.
+const progressBytes = 1024 * 1024
+
+// Snapshot of an extraction, sent as the data of each event.
+type extractProgress struct {
+	Files   int    `json:"files"`
+	Bytes   int64  `json:"bytes"`
+	Current string `json:"current,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// A background extraction that clients can watch.
+type extractJob struct {
+	ID   string
+	User string
+	// Where the files are going, as a browse URL
+	DestURL  string
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	progress extractProgress
+	version  int
+	done     bool
+}
+
+func (job *extractJob) update(progress extractProgress) {
+	job.mutex.Lock()
+	job.progress = progress
+	job.version++
+	job.mutex.Unlock()
+	job.cond.Broadcast()
+}
+
+func (job *extractJob) finish(err error) {
+	job.mutex.Lock()
+	if err != nil {
+		job.progress.Error = err.Error()
+	}
+	job.progress.Current = ""
+	job.version++
+	job.done = true
+	job.mutex.Unlock()
+	job.cond.Broadcast()
+}
+
+// Wait for progress newer than version.
+func (job *extractJob) wait(version int) (extractProgress, int, bool) {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	for job.version == version && !job.done {
+		job.cond.Wait()
+	}
+	return job.progress, job.version, job.done
+}
+
+type jobRegistry struct {
+	mutex sync.Mutex
+	jobs  map[string]*extractJob
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*extractJob)}
+}
+
+func (reg *jobRegistry) start(user, destURL string, run func(job *extractJob) error) (*extractJob, error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, err
+	}
+	job := &extractJob{
+		ID:      hex.EncodeToString(idBytes),
+		User:    user,
+		DestURL: destURL,
+	}
+	job.cond = sync.NewCond(&job.mutex)
+
+	reg.mutex.Lock()
+	reg.jobs[job.ID] = job
+	reg.mutex.Unlock()
+
+	go func() {
+		job.finish(run(job))
+		time.AfterFunc(jobRetention, func() {
+			reg.mutex.Lock()
+			delete(reg.jobs, job.ID)
+			reg.mutex.Unlock()
+		})
+	}()
+	return job, nil
+}
+
+func (reg *jobRegistry) get(id string) *extractJob {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	return reg.jobs[id]
+}
+
+type extractStarted struct {
+	Job     string `json:"job"`
+	Events  string `json:"events"`
+	DestURL string `json:"dest"`
+}
+
+// Unpack an archive into a directory on disk named by the dest param, a browse path.
+// Extraction runs in the background; the response says where to watch it.
+func extractNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	if r.Method != "POST" {
+		return errorf(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+	}
+	file, ok := target.node.(arclight.VfsFile)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a file: %s", target.Path)
+	}
+	archive, ok := requestArchives(r).Specialize(target.node).(arclight.VfsDirNode)
+	if !ok {
+		return errorf(http.StatusUnsupportedMediaType, "Not an archive: %s", target.node.Name())
+	}
+
+	dest := strings.Trim(r.FormValue("dest"), "/")
+	if dest == "" {
+		return errorf(http.StatusBadRequest, "Extraction needs a dest directory")
+	}
+	user := requestUser(r)
+	destTarget, err := srv.resolveSegments(r, strings.Split(dest, "/"))
+	if err != nil {
+		return err
+	}
+	destPath, err := srv.writableDir(r, destTarget)
+	if err != nil {
+		return err
+	}
+
+	// 0 turns off a limit; the extraction takes -1 for none
+	limit := int64(-1)
+	if srv.opts.MaxExtractBytes > 0 {
+		limit = srv.opts.MaxExtractBytes
+	}
+	if srv.opts.MaxExtractRatio > 0 && (limit < 0 || file.Size()*srv.opts.MaxExtractRatio < limit) {
+		limit = file.Size() * srv.opts.MaxExtractRatio
+	}
+	// the job reads the archive after the request is done
+	archives := requestArchives(r).Take()
+	job, err := srv.jobs.start(user, destTarget.URL, func(job *extractJob) error {
+		defer archives.Close()
+		ex := &extraction{
+			job:      job,
+			maxBytes: limit,
+			maxFiles: srv.opts.MaxExtractFiles,
+		}
+		return ex.run(archive, destPath)
+	})
+	if err != nil {
+		archives.Close()
+		return err
+	}
+
+	w.Header().Set("Location", jobsPrefix+job.ID)
+	return writeJSON(w, http.StatusAccepted, extractStarted{job.ID, jobsPrefix + job.ID, job.DestURL})
+}
+
+// Writes an archive's contents to disk, within limits.
+// Nested archives are written as files, so a bomb can't hide inside another archive.
+type extraction struct {
+	job *extractJob
+	// -1 for no limit
+	maxBytes int64
+	maxFiles int
+	progress extractProgress
+	reported int64
+	// everything written so far, removed if extraction fails
+	created []string
+}
+
+func (ex *extraction) run(archive arclight.VfsDir, destPath string) error {
+	err := ex.extractDir(archive, destPath, "")
+	ex.report()
+	if err != nil {
+		for i := len(ex.created) - 1; i >= 0; i-- {
+			os.Remove(ex.created[i])
+		}
+	}
+	return err
+}
+
+func (ex *extraction) extractDir(dir arclight.VfsDir, path, relPath string) error {
+	children, err := dir.Children()
+	if err != nil {
+		return fmt.Errorf("%s: %v", relPath, err)
+	}
+	for _, child := range children {
+		name := child.Name()
+		if err := checkFileName(name); err != nil {
+			return fmt.Errorf("Unsafe entry in archive: %v", err)
+		}
+		childPath := filepath.Join(path, name)
+		childRelPath := strings.TrimPrefix(relPath+"/"+name, "/")
+		ex.progress.Files++
+		if ex.maxFiles > 0 && ex.progress.Files > ex.maxFiles {
+			return fmt.Errorf("Archive has more than %d entries", ex.maxFiles)
+		}
+
+		if file, ok := child.(arclight.VfsFile); ok {
+			if err := ex.extractFile(file, childPath, childRelPath); err != nil {
+				return err
+			}
+			os.Chtimes(childPath, child.ModTime(), child.ModTime())
+			continue
+		}
+		childDir, ok := child.(arclight.VfsDir)
+		if !ok {
+			continue
+		}
+		if err := ex.mkdir(childPath); err != nil {
+			return err
+		}
+		if err := ex.extractDir(childDir, childPath, childRelPath); err != nil {
+			return err
+		}
+		os.Chtimes(childPath, child.ModTime(), child.ModTime())
+	}
+	return nil
+}
+
+// Directories may already exist, but they have to be real directories, not symlinks out of the tree.
+func (ex *extraction) mkdir(path string) error {
+	err := os.Mkdir(path, 0755)
+	if err == nil {
+		ex.created = append(ex.created, path)
+		return nil
+	}
+	fi, statErr := os.Lstat(path)
+	if statErr != nil || !fi.IsDir() {
+		return err
+	}
+	return nil
+}
+
+func (ex *extraction) extractFile(file arclight.VfsFile, path, relPath string) error {
+	ex.progress.Current = relPath
+	ex.report()
+
+	// O_EXCL won't follow a symlink or replace an existing file
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	ex.created = append(ex.created, path)
+	reader, err := file.Open()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %v", relPath, err)
+	}
+	defer reader.Close()
+
+	// don't trust the sizes archives claim; count what actually comes out
+	var src io.Reader = &progressReader{reader, ex}
+	remaining := ex.maxBytes - ex.progress.Bytes
+	if ex.maxBytes >= 0 {
+		src = io.LimitReader(src, remaining+1)
+	}
+	n, err := io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", relPath, err)
+	}
+	if ex.maxBytes >= 0 && n > remaining {
+		return fmt.Errorf("Archive expands to more than %d bytes", ex.maxBytes)
+	}
+	return nil
+}
+
+func (ex *extraction) report() {
+	ex.reported = ex.progress.Bytes
+	ex.job.update(ex.progress)
+}
+
+type progressReader struct {
+	io.Reader
+	ex *extraction
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.Reader.Read(p)
+	pr.ex.progress.Bytes += int64(n)
+	if pr.ex.progress.Bytes-pr.ex.reported >= progressBytes {
+		pr.ex.report()
+	}
+	return n, err
+}
+
+// Stream a job's progress as Server-Sent Events, ending with a done or failed event.
+// (EventSource uses "error" for its own connection errors.)
+func (srv *server) serveJob(w http.ResponseWriter, r *http.Request) error {
+	job := srv.jobs.get(strings.TrimPrefix(r.URL.Path, jobsPrefix))
+	if job == nil || job.User != requestUser(r) {
+		return errorf(http.StatusNotFound, "No such job")
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errorf(http.StatusInternalServerError, "Streaming not supported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	version := -1
+	for {
+		progress, newVersion, done := job.wait(version)
+		event := "progress"
+		if done {
+			event = "done"
+			if progress.Error != "" {
+				event = "failed"
+			}
+		}
+		data, err := json.Marshal(progress)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			// client went away
+			return nil
+		}
+		flusher.Flush()
+		if done || r.Context().Err() != nil {
+			return nil
+		}
+		version = newVersion
+	}
+}
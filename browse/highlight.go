@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Just enough of a language's lexical structure to color comments, strings, numbers, and keywords.
+type syntax struct {
+	LineComment  string
+	BlockComment [2]string
+	Quotes       string
+	Keywords     map[string]bool
+}
+
+func keywords(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+var cSyntax = &syntax{
+	LineComment:  "//",
+	BlockComment: [2]string{"/*", "*/"},
+	Quotes:       `"'`,
+	Keywords: keywords(`auto break case char const continue default do double else enum extern
+		float for goto if inline int long register return short signed sizeof static struct
+		switch typedef union unsigned void volatile while
+		class delete namespace new private protected public template this throw try catch virtual`),
+}
+
+var goSyntax = &syntax{
+	LineComment:  "//",
+	BlockComment: [2]string{"/*", "*/"},
+	Quotes:       "\"'`",
+	Keywords: keywords(`break case chan const continue default defer else fallthrough for func go goto
+		if import interface map package range return select struct switch type var
+		nil true false iota`),
+}
+
+var javaSyntax = &syntax{
+	LineComment:  "//",
+	BlockComment: [2]string{"/*", "*/"},
+	Quotes:       `"'`,
+	Keywords: keywords(`abstract boolean break byte case catch char class const continue default do
+		double else enum extends final finally float for if implements import instanceof int
+		interface long native new package private protected public return short static super
+		switch synchronized this throw throws try void volatile while null true false`),
+}
+
+var jsSyntax = &syntax{
+	LineComment:  "//",
+	BlockComment: [2]string{"/*", "*/"},
+	Quotes:       "\"'`",
+	Keywords: keywords(`async await break case catch class const continue default delete do else
+		export extends finally for function if import in instanceof let new of return super
+		switch this throw try typeof var void while yield null undefined true false`),
+}
+
+var pythonSyntax = &syntax{
+	LineComment: "#",
+	Quotes:      `"'`,
+	Keywords: keywords(`and as assert async await break class continue def del elif else except
+		finally for from global if import in is lambda nonlocal not or pass raise return try
+		while with yield None True False`),
+}
+
+var shellSyntax = &syntax{
+	LineComment: "#",
+	Quotes:      `"'`,
+	Keywords: keywords(`case do done elif else esac fi for function if in local return select then
+		until while export readonly set unset`),
+}
+
+// Highlighters by MIME subtype, covering what both libmagic and mime.types call things.
+var syntaxes = map[string]*syntax{
+	"x-c":             cSyntax,
+	"x-c++":           cSyntax,
+	"x-chdr":          cSyntax,
+	"x-csrc":          cSyntax,
+	"x-go":            goSyntax,
+	"x-java":          javaSyntax,
+	"x-java-source":   javaSyntax,
+	"javascript":      jsSyntax,
+	"x-javascript":    jsSyntax,
+	"x-python":        pythonSyntax,
+	"x-script.python": pythonSyntax,
+	"x-sh":            shellSyntax,
+	"x-shellscript":   shellSyntax,
+}
+
+// Split text into tokens and pass each one to emit with its CSS class, or "" for plain text.
+func (syn *syntax) tokenize(text string, emit func(class, text string)) {
+	plain := 0
+	flush := func(i int) {
+		if i > plain {
+			emit("", text[plain:i])
+		}
+	}
+	for i := 0; i < len(text); {
+		class, n := syn.token(text[i:], i == 0 || !isIdentChar(lastRune(text[:i])))
+		if n == 0 {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			continue
+		}
+		flush(i)
+		emit(class, text[i:i+n])
+		i += n
+		plain = i
+	}
+	flush(len(text))
+}
+
+// Class and length of the token at the start of text, or 0 if it's plain text.
+// Words and numbers only start at a word boundary.
+func (syn *syntax) token(text string, boundary bool) (string, int) {
+	switch {
+	case syn.LineComment != "" && strings.HasPrefix(text, syn.LineComment):
+		end := strings.IndexByte(text, '\n')
+		if end < 0 {
+			end = len(text)
+		}
+		return "comment", end
+
+	case syn.BlockComment[0] != "" && strings.HasPrefix(text, syn.BlockComment[0]):
+		open, close := syn.BlockComment[0], syn.BlockComment[1]
+		end := strings.Index(text[len(open):], close)
+		if end < 0 {
+			return "comment", len(text)
+		}
+		return "comment", len(open) + end + len(close)
+
+	case strings.IndexByte(syn.Quotes, text[0]) >= 0:
+		return "string", quotedLength(text)
+
+	case boundary && text[0] >= '0' && text[0] <= '9':
+		n := 1
+		for n < len(text) && (isIdentChar(rune(text[n])) || text[n] == '.') {
+			n++
+		}
+		return "number", n
+
+	case boundary && isIdentChar(firstRune(text)):
+		n := 0
+		for n < len(text) {
+			r, size := utf8.DecodeRuneInString(text[n:])
+			if !isIdentChar(r) {
+				break
+			}
+			n += size
+		}
+		if syn.Keywords[text[:n]] {
+			return "keyword", n
+		}
+		return "", n
+	}
+	return "", 0
+}
+
+// Length of a quoted string, including both quotes and any backslash escapes.
+// Unterminated strings end at the end of the line, except for backquoted raw strings.
+func quotedLength(text string) int {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case text[i] == quote:
+			return i + 1
+		case text[i] == '\\' && quote != '`':
+			i++
+		case text[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(text)
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(text string) rune {
+	r, _ := utf8.DecodeRuneInString(text)
+	return r
+}
+
+func lastRune(text string) rune {
+	r, _ := utf8.DecodeLastRuneInString(text)
+	return r
+}
@@ -0,0 +1,126 @@
+// Web browser for directories and archives, built on arclight.
+// Each root is served under its name: /media/photos.zip/archive!/2014/beach.jpg
+// Segments ending in "!" are actions, so names ending in "!" get another one: /media/wow!!
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Collects repeated -root name=path flags.
+type rootFlags []*browseRoot
+
+func (roots *rootFlags) String() string {
+	names := make([]string, len(*roots))
+	for i, root := range *roots {
+		names[i] = root.Name + "=" + root.Path
+	}
+	return strings.Join(names, ",")
+}
+
+func (roots *rootFlags) Set(value string) error {
+	name, path := "", value
+	if i := strings.Index(value, "="); i >= 0 {
+		name, path = value[:i], value[i+1:]
+	} else {
+		name = filepath.Base(path)
+	}
+	root, err := newBrowseRoot(name, path)
+	if err != nil {
+		return err
+	}
+	*roots = append(*roots, root)
+	return nil
+}
+
+func main() {
+	var roots rootFlags
+	flag.Var(&roots, "root", "root to serve as name=path; may be repeated")
+	listen := flag.String("listen", ":5000", "address to listen on")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate file for serving HTTPS, with -tls-key")
+	tlsKey := flag.String("tls-key", "", "PEM private key file for serving HTTPS, with -tls-cert")
+	configPath := flag.String("config", "", "JSON config file declaring roots, permissions, and other settings")
+	var opts serverOptions
+	flag.Int64Var(&opts.MaxSpool, "max-spool", 256*1024*1024,
+		"largest compressed archive member to spool for Range requests, in bytes")
+	flag.IntVar(&opts.ThumbSize, "thumb-size", 160, "thumbnail box size, in pixels")
+	flag.StringVar(&opts.ThumbCache, "thumb-cache", "", "DBM file for caching thumbnails")
+	flag.Int64Var(&opts.MaxPreview, "max-preview", 256*1024, "largest text preview, in bytes")
+	flag.BoolVar(&opts.Highlight, "highlight", false, "syntax highlighting for source code previews")
+	flag.StringVar(&opts.SearchIndex, "search-index", "", "directory for persisted search indexes")
+	flag.DurationVar(&opts.Reindex, "reindex", 10*time.Minute, "how often to rebuild search indexes")
+	flag.StringVar(&opts.Htpasswd, "htpasswd", "", "htpasswd file of bcrypt hashes for Basic authentication")
+	flag.StringVar(&opts.Tokens, "tokens", "", "file of bearer tokens and user names")
+	flag.Int64Var(&opts.MaxExtractBytes, "max-extract-bytes", 16*1024*1024*1024,
+		"most bytes one extract! can write, or 0 for no limit")
+	flag.IntVar(&opts.MaxExtractFiles, "max-extract-files", 100000,
+		"most entries one extract! can write, or 0 for no limit")
+	flag.Int64Var(&opts.MaxExtractRatio, "max-extract-ratio", 200,
+		"most bytes extract! can write per byte of archive, or 0 for no limit")
+	flag.StringVar(&opts.AccessLog, "access-log", "", "Common Log Format access log file, or - for stderr")
+	flag.Parse()
+
+	if *configPath != "" {
+		config, err := loadConfig(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		configRoots, err := config.browseRoots()
+		if err != nil {
+			log.Fatal(err)
+		}
+		roots = append(roots, configRoots...)
+		opts.Groups = config.Groups
+
+		set := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		override := func(name string, value *string, configValue string) {
+			if !set[name] && configValue != "" {
+				*value = configValue
+			}
+		}
+		override("listen", listen, config.Listen)
+		override("tls-cert", tlsCert, config.TLSCert)
+		override("tls-key", tlsKey, config.TLSKey)
+		override("htpasswd", &opts.Htpasswd, config.Htpasswd)
+		override("tokens", &opts.Tokens, config.Tokens)
+		override("access-log", &opts.AccessLog, config.AccessLog)
+	}
+
+	if len(roots) == 0 {
+		fmt.Fprintln(os.Stderr, "At least one root is required, from -root or -config")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		fmt.Fprintln(os.Stderr, "HTTPS needs both -tls-cert and -tls-key")
+		os.Exit(2)
+	}
+	useTLS := *tlsCert != ""
+
+	srv, err := newServer(roots, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !useTLS && (opts.Htpasswd != "" || opts.Tokens != "") {
+		log.Printf("WARNING: authentication is on, but without -tls-cert and -tls-key " +
+			"passwords and tokens will be sent in cleartext. " +
+			"Use HTTPS, or only listen behind a proxy that terminates TLS.")
+	}
+	log.Printf("Serving %s on %s", roots.String(), *listen)
+	if useTLS {
+		log.Fatal(http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, srv))
+	}
+	log.Fatal(http.ListenAndServe(*listen, srv))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// Decoders for the charset param, by lowercased charset name.
+// Text without a charset param is assumed to be UTF-8.
+var previewCharsets = map[string]encoding.Encoding{
+	"us-ascii":    unicode.UTF8,
+	"utf-8":       unicode.UTF8,
+	"utf-16":      unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM),
+	"utf-16be":    unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"utf-16le":    unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"iso-8859-1":  charmap.ISO8859_1,
+	"latin1":      charmap.ISO8859_1,
+	"shift_jis":   japanese.ShiftJIS,
+	"shift-jis":   japanese.ShiftJIS,
+	"sjis":        japanese.ShiftJIS,
+	"x-sjis":      japanese.ShiftJIS,
+	"windows-31j": japanese.ShiftJIS,
+}
+
+func rawNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	return srv.serveContent(w, r, target, "inline")
+}
+
+// Can we show this file as text?
+func canPreview(mediatype string, params map[string]string) bool {
+	if !strings.HasPrefix(mediatype, "text/") {
+		return false
+	}
+	charset, ok := params["charset"]
+	if !ok {
+		return true
+	}
+	_, ok = previewCharsets[strings.ToLower(charset)]
+	return ok
+}
+
+// Decoded beginning of a text file, split into lines.
+type textPreview struct {
+	Lines     []previewLine
+	Charset   string
+	Truncated bool
+}
+
+type previewLine struct {
+	Number int
+	HTML   template.HTML
+}
+
+// Read up to limit bytes of a text file and decode them to UTF-8.
+// A BOM overrides the charset param, since libmagic doesn't always get UTF-16 byte order right.
+func newTextPreview(file arclight.VfsFile, params map[string]string, limit int64, highlight bool, subtype string) (*textPreview, error) {
+	charset := strings.ToLower(params["charset"])
+	enc, ok := previewCharsets[charset]
+	if !ok {
+		charset, enc = "utf-8", unicode.UTF8
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	raw, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	preview := &textPreview{Charset: charset}
+	if int64(len(raw)) > limit {
+		raw = raw[:limit]
+		preview.Truncated = true
+	}
+
+	decoded, _, err := transform.Bytes(unicode.BOMOverride(enc.NewDecoder()), raw)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ToValidUTF8(string(decoded), "�")
+	if preview.Truncated {
+		// the cut probably landed in the middle of a character
+		if r, size := utf8.DecodeLastRuneInString(text); r == utf8.RuneError {
+			text = text[:len(text)-size]
+		}
+	}
+
+	lw := &lineWriter{}
+	if syn, ok := syntaxes[subtype]; ok && highlight {
+		syn.tokenize(text, lw.write)
+	} else {
+		lw.write("", text)
+	}
+	for i, line := range lw.finish() {
+		preview.Lines = append(preview.Lines, previewLine{Number: i + 1, HTML: line})
+	}
+	return preview, nil
+}
+
+// Collects escaped HTML for highlighted tokens, one string per line.
+// Tokens that span lines, like block comments, get a span on each line.
+type lineWriter struct {
+	lines []template.HTML
+	line  strings.Builder
+}
+
+func (lw *lineWriter) write(class, text string) {
+	for {
+		part, more := text, false
+		i := strings.IndexByte(text, '\n')
+		if i >= 0 {
+			part, more = strings.TrimSuffix(text[:i], "\r"), true
+		}
+		if part != "" {
+			if class != "" {
+				lw.line.WriteString(`<span class="` + class + `">`)
+			}
+			lw.line.WriteString(template.HTMLEscapeString(part))
+			if class != "" {
+				lw.line.WriteString(`</span>`)
+			}
+		}
+		if !more {
+			return
+		}
+		lw.lines = append(lw.lines, template.HTML(lw.line.String()))
+		lw.line.Reset()
+		text = text[i+1:]
+	}
+}
+
+// A trailing newline doesn't start another line.
+func (lw *lineWriter) finish() []template.HTML {
+	if lw.line.Len() > 0 {
+		lw.lines = append(lw.lines, template.HTML(lw.line.String()))
+		lw.line.Reset()
+	}
+	return lw.lines
+}
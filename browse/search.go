@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+const searchPath = "/search!"
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+)
+
+// Index of every node below the roots, for searching by name and path.
+// Each root's index is a manifest whose paths are browse paths relative to the root,
+// so archive contents appear under "archive!" segments and names are escaped just like in URLs.
+// Indexes are rebuilt in the background, and persisted to dir if it's set.
+type searchIndex struct {
+	dir     string
+	mutex   sync.RWMutex
+	records map[string][]arclight.ManifestRecord
+	built   map[string]time.Time
+}
+
+func newSearchIndex(dir string) *searchIndex {
+	index := new(searchIndex)
+	index.dir = dir
+	index.records = make(map[string][]arclight.ManifestRecord)
+	index.built = make(map[string]time.Time)
+	return index
+}
+
+func (index *searchIndex) manifestPath(rootName string) string {
+	return filepath.Join(index.dir, url.PathEscape(rootName)+".jsonl")
+}
+
+// Load persisted indexes so searches work before the first rebuild finishes.
+func (index *searchIndex) load(roots []*browseRoot) {
+	if index.dir == "" {
+		return
+	}
+	for _, root := range roots {
+		path := index.manifestPath(root.Name)
+		f, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Couldn't open search index %s: %v", path, err)
+			continue
+		}
+		records, err := readManifestRecords(f)
+		fi, statErr := f.Stat()
+		f.Close()
+		if err != nil || statErr != nil {
+			log.Printf("Couldn't read search index %s: %v", path, err)
+			continue
+		}
+		index.records[root.Name] = records
+		index.built[root.Name] = fi.ModTime()
+	}
+}
+
+func readManifestRecords(r io.Reader) ([]arclight.ManifestRecord, error) {
+	var records []arclight.ManifestRecord
+	dec := json.NewDecoder(r)
+	for {
+		var record arclight.ManifestRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+func (index *searchIndex) save(rootName string, records []arclight.ManifestRecord) error {
+	if err := os.MkdirAll(index.dir, 0755); err != nil {
+		return err
+	}
+	path := index.manifestPath(rootName)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for i := range records {
+		if err := enc.Encode(&records[i]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// replace the old index atomically
+	return os.Rename(path+".tmp", path)
+}
+
+// Rebuild every root's index, then do it again every interval.
+func (index *searchIndex) refresh(roots []*browseRoot, interval time.Duration) {
+	for {
+		for _, root := range roots {
+			index.rebuild(root)
+		}
+		if interval <= 0 {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (index *searchIndex) rebuild(root *browseRoot) {
+	start := time.Now()
+	index.mutex.RLock()
+	// never modified once built, only replaced
+	old := index.records[root.Name]
+	index.mutex.RUnlock()
+
+	builder := &indexBuilder{
+		old:       old,
+		oldByPath: make(map[string]int, len(old)),
+	}
+	for i, record := range old {
+		builder.oldByPath[record.Path] = i
+	}
+	builder.walk(root.node, ".")
+	log.Printf("Indexed %s: %d nodes in %v", root.Name, len(builder.records), time.Since(start))
+
+	index.mutex.Lock()
+	index.records[root.Name] = builder.records
+	index.built[root.Name] = time.Now()
+	index.mutex.Unlock()
+
+	if index.dir != "" {
+		if err := index.save(root.Name, builder.records); err != nil {
+			log.Printf("Couldn't save search index for %s: %v", root.Name, err)
+		}
+	}
+}
+
+// Walks a root, reusing records from the previous index for anything
+// whose size and mtime haven't changed, so unchanged files aren't sniffed again
+// and unchanged archives aren't opened at all.
+type indexBuilder struct {
+	old       []arclight.ManifestRecord
+	oldByPath map[string]int
+	records   []arclight.ManifestRecord
+}
+
+// Index of the previous record for path, or -1 if it's new or has changed.
+func (builder *indexBuilder) unchanged(node arclight.VfsNode, file arclight.VfsFile, path string) int {
+	i, ok := builder.oldByPath[path]
+	if !ok {
+		return -1
+	}
+	prev := &builder.old[i]
+	if prev.Size != file.Size() || !prev.ModTime.Equal(node.ModTime()) {
+		return -1
+	}
+	return i
+}
+
+func (builder *indexBuilder) walk(node arclight.VfsNode, path string) {
+	file, isFile := node.(arclight.VfsFile)
+	// archives that are already open, like a root that's an archive, are browsed without archive!
+	_, isDir := node.(arclight.VfsDir)
+	if !isFile || isDir {
+		builder.add(node, path)
+		builder.walkChildren(node, path)
+		return
+	}
+
+	if i := builder.unchanged(node, file, path); i >= 0 {
+		builder.records = append(builder.records, builder.old[i])
+		// walk order puts an archive's contents right after it
+		prefix := path + "/" + archiveSegment + "/"
+		for i++; i < len(builder.old) && strings.HasPrefix(builder.old[i].Path, prefix); i++ {
+			builder.records = append(builder.records, builder.old[i])
+		}
+		return
+	}
+
+	record := builder.add(node, path)
+	if isArchiveType(record.MimeType) {
+		// a broken archive is still a file worth finding
+		archives := new(arclight.Archives)
+		archive := archives.Specialize(node)
+		if _, ok := archive.(arclight.VfsDir); ok {
+			builder.walkChildren(archive, path+"/"+archiveSegment)
+		}
+		archives.Close()
+	}
+}
+
+func (builder *indexBuilder) walkChildren(node arclight.VfsNode, path string) {
+	dir, ok := node.(arclight.VfsDir)
+	if !ok {
+		return
+	}
+	children, err := dir.Children()
+	if err != nil {
+		log.Printf("Couldn't index %s: %v", path, err)
+		return
+	}
+	for _, child := range children {
+		builder.walk(child, slashpath.Join(path, escapeName(child.Name())))
+	}
+}
+
+func (builder *indexBuilder) add(node arclight.VfsNode, path string) *arclight.ManifestRecord {
+	record := arclight.ManifestRecord{
+		Path:    path,
+		Type:    arclight.ManifestTypeDir,
+		ModTime: node.ModTime(),
+	}
+	record.MimeType, record.MimeParams = node.MimeType()
+	if file, ok := node.(arclight.VfsFile); ok {
+		record.Type = arclight.ManifestTypeFile
+		record.Size = file.Size()
+	}
+	builder.records = append(builder.records, record)
+	return &builder.records[len(builder.records)-1]
+}
+
+// A search result, as shown on the search page and returned by the API.
+type searchHit struct {
+	Root     string    `json:"root"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	URL      string    `json:"url"`
+	Type     string    `json:"type"`
+	MimeType string    `json:"mimetype"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	nameHit  bool
+}
+
+// Find nodes whose paths contain every word of the query, ignoring case.
+// Hits where the last word is in the node's name come first.
+func (index *searchIndex) search(rootNames []string, query string, limit int) ([]*searchHit, bool) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, false
+	}
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	var hits []*searchHit
+	for _, rootName := range rootNames {
+		for i := range index.records[rootName] {
+			record := &index.records[rootName][i]
+			if record.Path == "." {
+				continue
+			}
+			displayPath := searchDisplayPath(record.Path)
+			lowerPath := strings.ToLower(displayPath)
+			matched := true
+			for _, word := range words {
+				if !strings.Contains(lowerPath, word) {
+					matched = false
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			name := slashpath.Base(displayPath)
+			hits = append(hits, &searchHit{
+				Root:     rootName,
+				Name:     name,
+				Path:     rootName + "/" + displayPath,
+				URL:      browseURL(rootName, record.Path),
+				Type:     record.Type,
+				MimeType: record.MimeType,
+				Size:     record.Size,
+				ModTime:  record.ModTime,
+				nameHit:  strings.Contains(strings.ToLower(name), words[len(words)-1]),
+			})
+		}
+	}
+	sort.Sort(byNameHitThenPath(hits))
+	if len(hits) > limit {
+		return hits[:limit], true
+	}
+	return hits, false
+}
+
+// A path as people would write it, without archive! segments or escaped names.
+func searchDisplayPath(path string) string {
+	names := []string{}
+	for _, segment := range strings.Split(path, "/") {
+		if segment != archiveSegment {
+			name, _ := unescapeName(segment)
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+// URL for a path relative to a root, leaving "archive!" segments unescaped.
+func browseURL(rootName, path string) string {
+	u := "/" + url.PathEscape(rootName)
+	for _, segment := range strings.Split(path, "/") {
+		if segment == archiveSegment {
+			u += "/" + segment
+		} else {
+			u += "/" + url.PathEscape(segment)
+		}
+	}
+	return u
+}
+
+type byNameHitThenPath []*searchHit
+
+func (hits byNameHitThenPath) Len() int {
+	return len(hits)
+}
+
+func (hits byNameHitThenPath) Swap(i, j int) {
+	hits[i], hits[j] = hits[j], hits[i]
+}
+
+func (hits byNameHitThenPath) Less(i, j int) bool {
+	if hits[i].nameHit != hits[j].nameHit {
+		return hits[i].nameHit
+	}
+	return hits[i].Path < hits[j].Path
+}
+
+// Roots that haven't been indexed yet.
+func (index *searchIndex) pending(rootNames []string) []string {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	var pending []string
+	for _, name := range rootNames {
+		if _, ok := index.built[name]; !ok {
+			pending = append(pending, name)
+		}
+	}
+	return pending
+}
+
+type searchPage struct {
+	Title     string
+	Crumbs    []crumb
+	Query     string
+	Hits      []*searchHit
+	Truncated bool
+	Pending   []string
+}
+
+// Search all roots the user can see, or just the ones named by root params.
+func (srv *server) searchParams(r *http.Request) (string, []string, int, error) {
+	query := r.URL.Query().Get("q")
+	limit, err := intParam(r, "limit", defaultSearchLimit, 1, maxSearchLimit)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	user := requestUser(r)
+	rootNames := r.URL.Query()["root"]
+	for _, name := range rootNames {
+		root, ok := srv.roots[name]
+		if !ok {
+			return "", nil, 0, errorf(http.StatusNotFound, "Unknown root %#v", name)
+		}
+		if !srv.allowed(user, root) {
+			return "", nil, 0, errorf(http.StatusForbidden, "Not allowed to search %s", name)
+		}
+	}
+	if len(rootNames) == 0 {
+		rootNames = srv.visibleRoots(user)
+	}
+	return query, rootNames, limit, nil
+}
+
+func (srv *server) serveSearch(w http.ResponseWriter, r *http.Request) error {
+	query, rootNames, limit, err := srv.searchParams(r)
+	if err != nil {
+		return err
+	}
+	page := searchPage{
+		Title: "Search",
+		Query: query,
+	}
+	page.Hits, page.Truncated = srv.index.search(rootNames, query, limit)
+	page.Pending = srv.index.pending(rootNames)
+	return renderHTML(w, "search", page)
+}
+
+type apiSearchBody struct {
+	Query     string       `json:"query"`
+	Hits      []*searchHit `json:"hits"`
+	Truncated bool         `json:"truncated"`
+	// Roots that haven't been indexed yet, so their hits are missing.
+	Pending []string `json:"pending,omitempty"`
+}
+
+func (srv *server) apiSearch(w http.ResponseWriter, r *http.Request) error {
+	query, rootNames, limit, err := srv.searchParams(r)
+	if err != nil {
+		return err
+	}
+	body := apiSearchBody{
+		Query: query,
+		Hits:  []*searchHit{},
+	}
+	if hits, truncated := srv.index.search(rootNames, query, limit); hits != nil {
+		body.Hits, body.Truncated = hits, truncated
+	}
+	body.Pending = srv.index.pending(rootNames)
+	return writeJSON(w, http.StatusOK, body)
+}
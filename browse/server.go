@@ -0,0 +1,545 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// URL segment that descends into an archive.
+const archiveSegment = "archive!"
+
+// Segments that end in a single "!" are actions or archive!,
+// so names that end in "!" get another one in browse paths and URLs: "wow!" is "wow!!".
+func escapeName(name string) string {
+	if strings.HasSuffix(name, "!") {
+		return name + "!"
+	}
+	return name
+}
+
+// The name a path segment stands for, or false if the segment is an action or archive!.
+func unescapeName(segment string) (string, bool) {
+	if strings.HasSuffix(segment, "!!") {
+		return segment[:len(segment)-1], true
+	}
+	return segment, !strings.HasSuffix(segment, "!")
+}
+
+type browseRoot struct {
+	Name string
+	Path string
+	// Users, @groups, or * for anyone. Empty to allow anyone.
+	Allow []string
+	// Users and @groups who can upload and extract into this root. Empty for read-only.
+	Write []string
+	node  arclight.VfsDirNode
+}
+
+func newBrowseRoot(name, path string) (*browseRoot, error) {
+	if name == "" || strings.HasSuffix(name, "!") || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("Invalid root name %#v", name)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	node, ok := arclight.Specialize(arclight.NewOsNode(path, fi)).(arclight.VfsDirNode)
+	if !ok {
+		return nil, fmt.Errorf("Root %#v is not a directory or archive: %s", name, path)
+	}
+	root := &browseRoot{
+		Name: name,
+		Path: path,
+		node: node,
+	}
+	return root, nil
+}
+
+// Errors that know which HTTP status they should be reported with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (err *httpError) Error() string {
+	return err.msg
+}
+
+func errorf(status int, format string, args ...interface{}) error {
+	return &httpError{status, fmt.Sprintf(format, args...)}
+}
+
+func errorStatus(err error) int {
+	switch {
+	case os.IsNotExist(err):
+		return http.StatusNotFound
+	case os.IsPermission(err):
+		return http.StatusForbidden
+	}
+	if httpErr, ok := err.(*httpError); ok {
+		return httpErr.status
+	}
+	return http.StatusInternalServerError
+}
+
+// A node named by a browse URL.
+type browseTarget struct {
+	root *browseRoot
+	node arclight.VfsNode
+	// Unescaped path of the node: root/dir/file.zip/archive!/member
+	Path string
+	// URL of the node, without any action
+	URL string
+	// Links to each ancestor, starting with the root
+	Crumbs []crumb
+	Action string
+}
+
+type crumb struct {
+	Name string
+	URL  string
+}
+
+// Handles one action on a node. The empty action browses it.
+type actionFunc func(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error
+
+var actions = map[string]actionFunc{
+	"":          browseNode,
+	"download!": downloadNode,
+	"zip!":      zipNode,
+	"thumb!":    thumbNode,
+	"raw!":      rawNode,
+	"upload!":   uploadNode,
+	"extract!":  extractNode,
+}
+
+// Server settings other than roots.
+type serverOptions struct {
+	// Largest file that will be spooled to serve a Range request if it can't seek.
+	MaxSpool int64
+	// Thumbnails fit in a square this many pixels on a side.
+	ThumbSize int
+	// DBM file for caching thumbnails. Empty to disable caching.
+	ThumbCache string
+	// Text previews show at most this many bytes.
+	MaxPreview int64
+	// Color source code in text previews.
+	Highlight bool
+	// Directory for persisted search indexes. Empty to keep them in memory only.
+	SearchIndex string
+	// How often to rebuild search indexes. Zero to build them only at startup.
+	Reindex time.Duration
+	// htpasswd file with bcrypt hashes for Basic authentication.
+	Htpasswd string
+	// File of bearer tokens and the users they belong to.
+	Tokens string
+	// Members of each group that can be named in root allow lists.
+	Groups map[string][]string
+	// Common Log Format access log: a file path, - for stderr, or empty for none.
+	AccessLog string
+	// Limits on what one extract! can write, to defuse zip bombs. 0 for no limit.
+	MaxExtractBytes int64
+	MaxExtractFiles int
+	// Largest ratio of extracted bytes to archive size.
+	MaxExtractRatio int64
+}
+
+type server struct {
+	roots     map[string]*browseRoot
+	rootNames []string
+	opts      serverOptions
+	thumbs    *thumbCache
+	index     *searchIndex
+	auth      []authenticator
+	accessLog *log.Logger
+	jobs      *jobRegistry
+	mux       *http.ServeMux
+}
+
+func newServer(roots []*browseRoot, opts serverOptions) (*server, error) {
+	srv := &server{
+		roots: make(map[string]*browseRoot),
+		opts:  opts,
+		mux:   http.NewServeMux(),
+	}
+	for _, root := range roots {
+		if _, dup := srv.roots[root.Name]; dup {
+			return nil, fmt.Errorf("Duplicate root name %#v", root.Name)
+		}
+		srv.roots[root.Name] = root
+		srv.rootNames = append(srv.rootNames, root.Name)
+	}
+	sort.Strings(srv.rootNames)
+
+	if opts.ThumbSize < 1 || opts.ThumbSize > maxThumbSize {
+		return nil, fmt.Errorf("Thumbnail size must be between 1 and %d pixels, not %d", maxThumbSize, opts.ThumbSize)
+	}
+	if opts.ThumbCache != "" {
+		thumbs, err := openThumbCache(opts.ThumbCache)
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't open thumbnail cache: %v", err)
+		}
+		srv.thumbs = thumbs
+	}
+
+	if opts.Htpasswd != "" {
+		auth, err := loadHtpasswd(opts.Htpasswd)
+		if err != nil {
+			return nil, err
+		}
+		srv.auth = append(srv.auth, auth)
+	}
+	if opts.Tokens != "" {
+		auth, err := loadTokens(opts.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		srv.auth = append(srv.auth, auth)
+	}
+	accessLog, err := openAccessLog(opts.AccessLog)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't open access log: %v", err)
+	}
+	srv.accessLog = accessLog
+
+	srv.jobs = newJobRegistry()
+	srv.index = newSearchIndex(opts.SearchIndex)
+	srv.index.load(roots)
+	go srv.index.refresh(roots, opts.Reindex)
+
+	srv.mux.Handle("/", srv.handler(srv.serveBrowse))
+	srv.mux.Handle(searchPath, srv.handler(srv.serveSearch))
+	srv.mux.Handle(jobsPrefix, srv.handler(srv.serveJob))
+	srv.mux.Handle(apiPrefix, srv.apiHandler(srv.serveAPI))
+	return srv, nil
+}
+
+// Adapt a handler that returns errors to an http.Handler.
+func (srv *server) handler(serve func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := serve(w, r); err != nil {
+			status := errorStatus(err)
+			log.Printf("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+			srv.writeError(w, r, status, err)
+		}
+	})
+}
+
+func (srv *server) writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page := errorPage{
+		Status:     status,
+		StatusText: http.StatusText(status),
+		Message:    err.Error(),
+	}
+	if err := templates.ExecuteTemplate(w, "error", page); err != nil {
+		log.Printf("Couldn't render error template: %v", err)
+	}
+}
+
+func (srv *server) serveBrowse(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/" {
+		return srv.browseRoots(w, r)
+	}
+	target, err := srv.resolve(r, r.URL.Path)
+	if err != nil {
+		return err
+	}
+	return actions[target.Action](srv, w, r, target)
+}
+
+// Archives opened while serving a request, closed when the request is done.
+func requestArchives(r *http.Request) *arclight.Archives {
+	archives, ok := r.Context().Value(archivesKey).(*arclight.Archives)
+	if !ok {
+		return new(arclight.Archives)
+	}
+	return archives
+}
+
+// Find the node for a browse URL path: /root/dir/file.zip/archive!/member/action!
+func (srv *server) resolve(r *http.Request, urlPath string) (*browseTarget, error) {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+
+	action := ""
+	last := segments[len(segments)-1]
+	if _, isName := unescapeName(last); !isName && last != archiveSegment {
+		if _, ok := actions[last]; !ok {
+			return nil, errorf(http.StatusNotFound, "Unknown action %s", last)
+		}
+		action = last
+		segments = segments[:len(segments)-1]
+	}
+	if len(segments) == 0 {
+		return nil, errorf(http.StatusBadRequest, "Action %s needs a root", action)
+	}
+
+	target, err := srv.resolveSegments(r, segments)
+	if err != nil {
+		return nil, err
+	}
+	target.Action = action
+	return target, nil
+}
+
+// Find the node for a path that has already been split into segments,
+// starting with the root name. The user must be allowed to see the root.
+// Archives opened along the way are closed at the end of the request.
+func (srv *server) resolveSegments(r *http.Request, segments []string) (*browseTarget, error) {
+	root, ok := srv.roots[segments[0]]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "No such root: %s", segments[0])
+	}
+	if !srv.allowed(requestUser(r), root) {
+		return nil, errorf(http.StatusForbidden, "Not allowed to browse %s", root.Name)
+	}
+	target := new(browseTarget)
+	target.root = root
+	target.node = root.node
+	target.Path = root.Name
+	target.URL = "/" + url.PathEscape(root.Name)
+	target.Crumbs = []crumb{{root.Name, target.URL}}
+
+	for _, segment := range segments[1:] {
+		switch segment {
+		case "", ".", "..":
+			return nil, errorf(http.StatusBadRequest, "Invalid path segment %#v", segment)
+		case archiveSegment:
+			// directories, including archives that have already been opened, have nothing to open
+			if _, isDir := target.node.(arclight.VfsDir); isDir {
+				return nil, errorf(http.StatusUnsupportedMediaType,
+					"Not an archive: %s", target.node.Name())
+			}
+			archive, ok := requestArchives(r).Specialize(target.node).(arclight.VfsDirNode)
+			if !ok {
+				return nil, errorf(http.StatusUnsupportedMediaType,
+					"Not an archive: %s", target.node.Name())
+			}
+			target.node = archive
+		default:
+			name, isName := unescapeName(segment)
+			if !isName {
+				return nil, errorf(http.StatusBadRequest, "Invalid path segment %#v", segment)
+			}
+			dir, ok := target.node.(arclight.VfsDir)
+			if !ok {
+				return nil, errorf(http.StatusNotFound,
+					"Not a directory: %s", target.node.Name())
+			}
+			child, err := dir.Resolve(name)
+			if err != nil {
+				if _, isOsErr := err.(*os.PathError); isOsErr {
+					return nil, err
+				}
+				// archives only fail to resolve paths that aren't there
+				return nil, errorf(http.StatusNotFound, "%v", err)
+			}
+			target.node = child
+		}
+		target.Path += "/" + segment
+		if segment == archiveSegment {
+			target.URL += "/" + archiveSegment
+		} else {
+			target.URL += "/" + url.PathEscape(segment)
+			target.Crumbs = append(target.Crumbs, crumb{target.node.Name(), target.URL})
+		}
+	}
+
+	return target, nil
+}
+
+func (srv *server) browseRoots(w http.ResponseWriter, r *http.Request) error {
+	listing := dirListing{Title: "Roots"}
+	for _, name := range srv.visibleRoots(requestUser(r)) {
+		entry := newListingEntry(srv.roots[name].node, "/"+url.PathEscape(name))
+		entry.Name = name
+		listing.Children = append(listing.Children, entry)
+	}
+	return renderHTML(w, "dir", listing)
+}
+
+func renderHTML(w http.ResponseWriter, name string, data interface{}) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return templates.ExecuteTemplate(w, name, data)
+}
+
+// One row in a directory listing.
+type listingEntry struct {
+	Name       string
+	URL        string
+	IsDir      bool
+	IsArchive  bool
+	MimeType   string
+	Size       int64
+	ModTime    time.Time
+	ArchiveURL string
+	ThumbURL   string
+}
+
+func childURL(target *browseTarget, child arclight.VfsNode) string {
+	return target.URL + "/" + url.PathEscape(escapeName(child.Name()))
+}
+
+func isArchiveType(mediatype string) bool {
+	_, ok := arclight.ArchiveTypes[mediatype]
+	return ok
+}
+
+// Can a file be opened with archive!? Compressed files are only archives if there's a tar inside.
+func isArchive(node arclight.VfsNode) bool {
+	if _, isDir := node.(arclight.VfsDir); isDir {
+		return false
+	}
+	archive := arclight.Specialize(node)
+	if closer, ok := archive.(io.Closer); ok {
+		closer.Close()
+	}
+	_, ok := archive.(arclight.VfsDir)
+	return ok
+}
+
+func formatMimeType(node arclight.VfsNode) string {
+	mediatype, params := node.MimeType()
+	return mime.FormatMediaType(mediatype, params)
+}
+
+func newListingEntry(node arclight.VfsNode, nodeURL string) listingEntry {
+	mediatype, params := node.MimeType()
+	entry := listingEntry{
+		Name:     node.Name(),
+		URL:      nodeURL,
+		MimeType: mime.FormatMediaType(mediatype, params),
+		ModTime:  node.ModTime(),
+	}
+	_, entry.IsDir = node.(arclight.VfsDir)
+	if file, ok := node.(arclight.VfsFile); ok {
+		entry.Size = file.Size()
+		if !entry.IsDir && isArchive(node) {
+			entry.IsArchive = true
+			entry.ArchiveURL = nodeURL + "/" + archiveSegment
+		}
+		if !entry.IsDir && canThumbnail(mediatype) {
+			entry.ThumbURL = nodeURL + "/thumb!"
+		}
+	}
+	return entry
+}
+
+type dirListing struct {
+	Title     string
+	Crumbs    []crumb
+	URL       string
+	ZipURL    string
+	UploadURL string
+	Children  []listingEntry
+}
+
+// Directories first, then by name.
+type byDirThenName []listingEntry
+
+func (entries byDirThenName) Len() int {
+	return len(entries)
+}
+
+func (entries byDirThenName) Swap(i, j int) {
+	entries[i], entries[j] = entries[j], entries[i]
+}
+
+func (entries byDirThenName) Less(i, j int) bool {
+	if entries[i].IsDir != entries[j].IsDir {
+		return entries[i].IsDir
+	}
+	return entries[i].Name < entries[j].Name
+}
+
+type filePage struct {
+	Title     string
+	Crumbs    []crumb
+	URL       string
+	MimeType  string
+	Size      int64
+	ModTime   time.Time
+	Attrs     arclight.NodeAttrs
+	IsArchive bool
+	Preview   *textPreview
+	// Roots the user could extract this archive into
+	ExtractDests []string
+}
+
+type errorPage struct {
+	Status     int
+	StatusText string
+	Message    string
+}
+
+func browseNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	if dir, ok := target.node.(arclight.VfsDir); ok {
+		return browseDir(srv, w, r, target, dir)
+	}
+	return browseFile(srv, w, r, target)
+}
+
+// Render a directory as a table, or as a grid of thumbnails.
+func browseDir(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget, dir arclight.VfsDir) error {
+	children, err := dir.Children()
+	if err != nil {
+		return err
+	}
+
+	listing := dirListing{
+		Title:  target.node.Name(),
+		Crumbs: target.Crumbs,
+		URL:    target.URL,
+		ZipURL: target.URL + "/zip!",
+	}
+	if _, isOsDir := target.node.(*arclight.OsDir); isOsDir && srv.canWrite(requestUser(r), target.root) {
+		listing.UploadURL = target.URL + "/upload!"
+	}
+	for _, child := range children {
+		listing.Children = append(listing.Children, newListingEntry(child, childURL(target, child)))
+	}
+	sort.Sort(byDirThenName(listing.Children))
+
+	return renderHTML(w, listingView(r), listing)
+}
+
+func browseFile(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	mediatype, params := target.node.MimeType()
+	page := filePage{
+		Title:     target.node.Name(),
+		Crumbs:    target.Crumbs,
+		URL:       target.URL,
+		MimeType:  mime.FormatMediaType(mediatype, params),
+		ModTime:   target.node.ModTime(),
+		Attrs:     target.node.Attrs(),
+		IsArchive: isArchive(target.node),
+	}
+	if page.IsArchive {
+		page.ExtractDests = srv.writableRoots(requestUser(r))
+	}
+	if file, ok := target.node.(arclight.VfsFile); ok {
+		page.Size = file.Size()
+		if canPreview(mediatype, params) {
+			subtype := mediatype[strings.Index(mediatype, "/")+1:]
+			preview, err := newTextPreview(file, params, srv.opts.MaxPreview, srv.opts.Highlight, subtype)
+			if err != nil {
+				return err
+			}
+			page.Preview = preview
+		}
+	}
+	return renderHTML(w, "file", page)
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Files for a test server's "files" root, which also has a Zip archive, docs.zip.
+var testFiles = map[string]string{
+	"hello.txt": "hello, world\n",
+	"wow!":      "exclaimed",
+	"archive!":  "tricky",
+	"sub/a.txt": "in a directory",
+}
+
+var testZipFiles = map[string]string{
+	"docs/a.txt": "zipped a",
+	"docs/b.txt": "zipped b",
+	"top.txt":    "zipped top",
+}
+
+func zipBytes(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(contents))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// A server with a "files" root of testFiles and docs.zip, and an empty "uploads" root.
+// configure can change the options and roots, and write config files to the tempdir.
+type testServer struct {
+	*httptest.Server
+	srv     *server
+	tempdir string
+}
+
+func newTestServer(t *testing.T, opts serverOptions, configure func(tempdir string, opts *serverOptions, roots map[string]*browseRoot)) *testServer {
+	tempdir, err := ioutil.TempDir("", "TestBrowse")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	writeFiles(t, filepath.Join(tempdir, "files"), testFiles)
+	err = ioutil.WriteFile(filepath.Join(tempdir, "files", "docs.zip"), zipBytes(t, testZipFiles), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tempdir, "uploads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	roots := map[string]*browseRoot{}
+	var rootList []*browseRoot
+	for _, name := range []string{"files", "uploads"} {
+		root, err := newBrowseRoot(name, filepath.Join(tempdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots[name] = root
+		rootList = append(rootList, root)
+	}
+	if configure != nil {
+		configure(tempdir, &opts, roots)
+	}
+	if opts.MaxSpool == 0 {
+		opts.MaxSpool = 1024 * 1024
+	}
+	if opts.ThumbSize == 0 {
+		opts.ThumbSize = 16
+	}
+	if opts.MaxExtractBytes == 0 {
+		opts.MaxExtractBytes = 1024 * 1024
+	}
+	srv, err := newServer(rootList, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{httptest.NewServer(srv), srv, tempdir}
+}
+
+func (ts *testServer) Close() {
+	ts.Server.Close()
+	os.RemoveAll(ts.tempdir)
+}
+
+func (ts *testServer) do(t *testing.T, method, path string, header http.Header, body []byte) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, respBody
+}
+
+func (ts *testServer) get(t *testing.T, path string, header http.Header) (*http.Response, []byte) {
+	return ts.do(t, "GET", path, header, nil)
+}
+
+func TestResolve(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/files/hello.txt/download!", http.StatusOK, "hello, world\n"},
+		{"/files/sub/a.txt/download!", http.StatusOK, "in a directory"},
+		{"/files/docs.zip/archive!/docs/a.txt/download!", http.StatusOK, "zipped a"},
+		{"/files/docs.zip/archive!/top.txt/raw!", http.StatusOK, "zipped top"},
+		// names that end in ! have another one
+		{"/files/wow!!/download!", http.StatusOK, "exclaimed"},
+		{"/files/archive!!/download!", http.StatusOK, "tricky"},
+		{"/files/wow!", http.StatusNotFound, ""},
+		{"/files/sub!/a.txt", http.StatusBadRequest, ""},
+		{"/files/hello.txt/archive!", http.StatusUnsupportedMediaType, ""},
+		{"/files/sub/archive!", http.StatusUnsupportedMediaType, ""},
+		{"/files/docs.zip/archive!/archive!", http.StatusUnsupportedMediaType, ""},
+		{"/files/docs.zip/archive!/nope.txt", http.StatusNotFound, ""},
+		{"/files/nope.txt", http.StatusNotFound, ""},
+		{"/files/hello.txt/nope.txt", http.StatusNotFound, ""},
+		{"/nope/hello.txt", http.StatusNotFound, ""},
+		{"/files/hello.txt/nope!", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		resp, body := ts.get(t, test.path, nil)
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.path, test.status, resp.StatusCode, body)
+		} else if test.body != "" && string(body) != test.body {
+			t.Errorf("%s: expected %q, got %q", test.path, test.body, body)
+		}
+	}
+}
+
+// Listings link to names that end in ! with the extra !
+// A root that's an archive is browsed without archive!, so its search hits are too.
+func TestSearch_ArchiveRoot(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+	root, err := newBrowseRoot("z", filepath.Join(ts.tempdir, "files", "docs.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.srv.roots["z"] = root
+
+	index := newSearchIndex("")
+	index.rebuild(root)
+	hits, _ := index.search([]string{"z"}, "a.txt", 10)
+	if len(hits) != 1 {
+		t.Fatalf("Expected 1 hit, got %d", len(hits))
+	}
+	if hits[0].URL != "/z/docs/a.txt" {
+		t.Errorf("Expected URL %q, got %q", "/z/docs/a.txt", hits[0].URL)
+	}
+	if hits[0].Path != "z/docs/a.txt" {
+		t.Errorf("Expected path %q, got %q", "z/docs/a.txt", hits[0].Path)
+	}
+	resp, _ := ts.get(t, hits[0].URL, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected %d for %s, got %d", http.StatusOK, hits[0].URL, resp.StatusCode)
+	}
+}
+
+func TestBrowseDir_EscapedLinks(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	resp, body := ts.get(t, "/files", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	for _, expected := range []string{`href="/files/wow%21%21"`, `href="/files/docs.zip/archive!/"`} {
+		if !bytes.Contains(body, []byte(expected)) {
+			t.Errorf("Expected %s in listing", expected)
+		}
+	}
+}
+
+func TestAPI_List(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"", []string{"archive!", "docs.zip", "hello.txt", "sub", "wow!"}},
+		{"?offset=1&limit=2", []string{"docs.zip", "hello.txt"}},
+		{"?sort=size&order=desc&limit=3", []string{"docs.zip", "hello.txt", "wow!"}},
+		{"?order=desc", []string{"wow!", "sub", "hello.txt", "docs.zip", "archive!"}},
+		{"?offset=10", []string{}},
+	}
+	for _, test := range tests {
+		resp, body := ts.get(t, apiPrefix+"list/files"+test.query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", test.query, resp.StatusCode, body)
+			continue
+		}
+		var listing apiListing
+		if err := json.Unmarshal(body, &listing); err != nil {
+			t.Fatal(err)
+		}
+		if listing.Total != 5 {
+			t.Errorf("%s: expected 5 children in total, got %d", test.query, listing.Total)
+		}
+		names := []string{}
+		for _, child := range listing.Children {
+			names = append(names, child.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, names)
+		}
+	}
+
+	resp, body := ts.get(t, apiPrefix+"stat/files/wow!!", nil)
+	var node apiNode
+	if err := json.Unmarshal(body, &node); err != nil {
+		t.Fatalf("Couldn't parse %s: %v", body, err)
+	}
+	if node.Name != "wow!" || node.Path != "files/wow!!" {
+		t.Errorf("Expected wow! at files/wow!!, got %s at %s", node.Name, node.Path)
+	}
+
+	for _, path := range []string{"list/files?sort=color", "list/files?order=up", "list/files?limit=x", "list/files/hello.txt"} {
+		if resp, _ = ts.get(t, apiPrefix+path, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, resp.StatusCode)
+		}
+	}
+	if resp, _ = ts.get(t, apiPrefix+"list/files/docs.zip/archive!/nope", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing archive member, got %d", resp.StatusCode)
+	}
+}
+
+func TestDownload_Range(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/files/hello.txt/download!", "lo, w"},
+		// compressed members are spooled to seek
+		{"/files/docs.zip/archive!/top.txt/download!", "ped t"},
+	}
+	for _, test := range tests {
+		resp, body := ts.get(t, test.path, http.Header{"Range": {"bytes=3-7"}})
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Errorf("%s: expected 206, got %d", test.path, resp.StatusCode)
+		}
+		if string(body) != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, body)
+		}
+	}
+
+	// too big to spool, so the whole file comes back
+	ts.srv.opts.MaxSpool = 1
+	resp, body := ts.get(t, "/files/docs.zip/archive!/top.txt/download!", http.Header{"Range": {"bytes=3-7"}})
+	if resp.StatusCode != http.StatusOK || string(body) != "zipped top" {
+		t.Errorf("Expected the whole file, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestDownload_ETag(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	for _, path := range []string{"/files/hello.txt/download!", "/files/docs.zip/archive!/top.txt/download!"} {
+		resp, _ := ts.get(t, path, nil)
+		tag := resp.Header.Get("ETag")
+		if tag == "" {
+			t.Errorf("%s: expected an ETag", path)
+			continue
+		}
+		resp, body := ts.get(t, path, http.Header{"If-None-Match": {tag}})
+		if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+			t.Errorf("%s: expected an empty 304, got %d %q", path, resp.StatusCode, body)
+		}
+		resp, _ = ts.get(t, path, http.Header{"If-None-Match": {`"other"`}})
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200 for another ETag, got %d", path, resp.StatusCode)
+		}
+	}
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Couldn't read Zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range z.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		reader, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(contents)
+	}
+	return files
+}
+
+func TestZipDownload(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	tests := []struct {
+		path     string
+		filename string
+		expected map[string]string
+	}{
+		{"/files/sub/zip!", "sub.zip", map[string]string{"a.txt": "in a directory"}},
+		{"/files/docs.zip/archive!/docs/zip!", "docs.zip", map[string]string{"a.txt": "zipped a", "b.txt": "zipped b"}},
+		{"/files/docs.zip/archive!/zip!", "docs.zip", testZipFiles},
+	}
+	for _, test := range tests {
+		resp, body := ts.get(t, test.path, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", test.path, resp.StatusCode)
+			continue
+		}
+		_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+		} else if params["filename"] != test.filename {
+			t.Errorf("%s: expected file name %s, got %s", test.path, test.filename, params["filename"])
+		}
+		files := readZip(t, body)
+		if len(files) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.path, test.expected, files)
+		}
+		for name, contents := range test.expected {
+			if files[name] != contents {
+				t.Errorf("%s: expected %s to be %q, got %q", test.path, name, contents, files[name])
+			}
+		}
+	}
+	if resp, _ := ts.get(t, "/files/hello.txt/zip!", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a file, got %d", resp.StatusCode)
+	}
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Compressed files are only offered as archives if they can be opened as one
+func TestArchiveLinks_Compressed(t *testing.T) {
+	ts := newTestServer(t, serverOptions{}, nil)
+	defer ts.Close()
+
+	tarBuf := new(bytes.Buffer)
+	tw := tar.NewWriter(tarBuf)
+	tw.WriteHeader(&tar.Header{Name: "inner.txt", Mode: 0644, Size: 5})
+	tw.Write([]byte("inner"))
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"bundle.tar.gz": gzipBytes(t, tarBuf.Bytes()),
+		"notes.txt.gz":  gzipBytes(t, []byte("just some notes")),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(ts.tempdir, "files", name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		isArchive bool
+	}{
+		{"bundle.tar.gz", true},
+		{"notes.txt.gz", false},
+		{"docs.zip", true},
+		{"hello.txt", false},
+	}
+	_, listing := ts.get(t, "/files", nil)
+	for _, test := range tests {
+		_, body := ts.get(t, apiPrefix+"stat/files/"+test.name, nil)
+		var node apiNode
+		if err := json.Unmarshal(body, &node); err != nil {
+			t.Fatalf("Couldn't parse %s: %v", body, err)
+		}
+		if (node.ArchivePath != "") != test.isArchive {
+			t.Errorf("%s: expected archive %v, got archive path %#v", test.name, test.isArchive, node.ArchivePath)
+		}
+		link := []byte(`href="/files/` + test.name + `/archive!/"`)
+		if bytes.Contains(listing, link) != test.isArchive {
+			t.Errorf("%s: expected archive link %v in listing", test.name, test.isArchive)
+		}
+		resp, _ := ts.get(t, "/files/"+test.name+"/archive!", nil)
+		if (resp.StatusCode == http.StatusOK) != test.isArchive {
+			t.Errorf("%s: expected archive %v, got %d", test.name, test.isArchive, resp.StatusCode)
+		}
+	}
+}
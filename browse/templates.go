@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+)
+
+var templateFuncs = template.FuncMap{
+	"size":  formatSize,
+	"mtime": formatModTime,
+}
+
+var templates = template.Must(template.New("browse").Funcs(templateFuncs).Parse(
+	headerHtml + dirHtml + gridHtml + fileHtml + searchHtml + errorHtml))
+
+// Human-readable size with binary prefixes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatModTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+const headerHtml = `
+{{ define "header" }}<!DOCTYPE html>
+<html>
+    <head>
+        <meta charset="utf-8">
+        <title>Mighty Browse: {{ .Title }}</title>
+    </head>
+    <body>
+        <nav>
+            <a href="/">Roots</a>
+            {{ range .Crumbs }}
+                / <a href="{{ .URL }}">{{ .Name }}</a>
+            {{ end }}
+            <form style="display: inline; float: right" action="/search!">
+                <input type="search" name="q" placeholder="Search names and paths">
+            </form>
+        </nav>
+{{ end }}
+`
+
+const dirHtml = `
+{{ define "dir" }}{{ template "header" . }}
+        {{ if .ZipURL }}
+            <p>
+                <a title="download as Zip" href="{{ .ZipURL }}">🗜⬇︎ Download all</a>
+                <a title="show thumbnails" href="{{ .URL }}?view=grid">▦ Grid view</a>
+            </p>
+        {{ end }}
+        {{ if .UploadURL }}
+            <form method="post" enctype="multipart/form-data" action="{{ .UploadURL }}">
+                <input type="file" name="file" multiple>
+                <input type="submit" value="⬆︎ Upload">
+            </form>
+        {{ end }}
+        <table>
+            <thead>
+                <tr>
+                    <th>Type</th>
+                    <th>Name</th>
+                    <th>MIME type</th>
+                    <th>Size</th>
+                    <th>Modified</th>
+                    <th>Download</th>
+                </tr>
+            </thead>
+            <tbody>
+                {{ range .Children }}
+                    <tr>
+                        <td>
+                            {{ if .IsDir }}
+                                📁
+                            {{ else if .IsArchive }}
+                                <a title="browse archive" href="{{ .ArchiveURL }}/">🗜</a>
+                            {{ else }}
+                                📄
+                            {{ end }}
+                        </td>
+                        <td>
+                            <a title="browse" href="{{ .URL }}">{{ .Name }}</a>
+                        </td>
+                        <td>{{ .MimeType }}</td>
+                        <td>{{ if not .IsDir }}{{ size .Size }}{{ end }}</td>
+                        <td>{{ mtime .ModTime }}</td>
+                        <td>
+                            {{ if .IsDir }}
+                                <a title="download as Zip" href="{{ .URL }}/zip!">🗜⬇︎</a>
+                            {{ else }}
+                                <a title="download" href="{{ .URL }}/download!">⬇︎</a>
+                            {{ end }}
+                        </td>
+                    </tr>
+                {{ end }}
+            </tbody>
+        </table>
+    </body>
+</html>
+{{ end }}
+`
+
+const gridHtml = `
+{{ define "grid" }}{{ template "header" . }}
+        <style>
+            .grid { display: flex; flex-wrap: wrap; }
+            .cell { width: 180px; height: 200px; margin: 4px; text-align: center; overflow: hidden; }
+            .thumb { height: 160px; display: flex; align-items: center; justify-content: center; font-size: 64px; }
+            .thumb img { max-width: 160px; max-height: 160px; }
+        </style>
+        <p>
+            <a title="download as Zip" href="{{ .ZipURL }}">🗜⬇︎ Download all</a>
+            <a title="show details" href="{{ .URL }}">☰ List view</a>
+        </p>
+        <div class="grid">
+            {{ range .Children }}
+                <div class="cell">
+                    <a title="{{ .Name }}" href="{{ if .IsArchive }}{{ .ArchiveURL }}/?view=grid{{ else if .IsDir }}{{ .URL }}?view=grid{{ else }}{{ .URL }}{{ end }}">
+                        <div class="thumb">
+                            {{ if .ThumbURL }}
+                                <img loading="lazy" alt="{{ .Name }}" src="{{ .ThumbURL }}">
+                            {{ else if .IsDir }}
+                                📁
+                            {{ else if .IsArchive }}
+                                🗜
+                            {{ else }}
+                                📄
+                            {{ end }}
+                        </div>
+                        {{ .Name }}
+                    </a>
+                </div>
+            {{ end }}
+        </div>
+    </body>
+</html>
+{{ end }}
+`
+
+const fileHtml = `
+{{ define "file" }}{{ template "header" . }}
+        <h1>{{ .Title }}</h1>
+        <p>
+            <a title="download" href="{{ .URL }}/download!">⬇︎ Download</a>
+            {{ if .IsArchive }}
+                <a title="browse archive" href="{{ .URL }}/archive!/">🗜 Browse contents</a>
+            {{ end }}
+            {{ if .Preview }}
+                <a title="view as plain text" href="{{ .URL }}/raw!">📄 Raw</a>
+            {{ end }}
+        </p>
+        {{ if .ExtractDests }}
+            <form id="extract" method="post" action="{{ .URL }}/extract!">
+                Extract into
+                <input name="dest" list="extract-roots" placeholder="root/dir" required>
+                <datalist id="extract-roots">
+                    {{ range .ExtractDests }}<option value="{{ . }}">{{ end }}
+                </datalist>
+                <input type="submit" value="📦 Extract">
+                <span id="extract-progress"></span>
+            </form>
+            <script>
+                document.getElementById("extract").addEventListener("submit", async (event) => {
+                    event.preventDefault();
+                    const form = event.target;
+                    const status = document.getElementById("extract-progress");
+                    const response = await fetch(form.action, {method: "POST", body: new FormData(form)});
+                    const body = await response.json();
+                    if (!response.ok) {
+                        status.textContent = body.error.message;
+                        return;
+                    }
+                    const events = new EventSource(body.events);
+                    const show = (e) => {
+                        const p = JSON.parse(e.data);
+                        status.textContent = p.files + " files, " + p.bytes + " bytes " + (p.current || "");
+                        return p;
+                    };
+                    events.addEventListener("progress", show);
+                    events.addEventListener("done", (e) => {
+                        show(e);
+                        events.close();
+                        status.innerHTML += ' <a href="' + body.dest + '">done</a>';
+                    });
+                    events.addEventListener("failed", (e) => {
+                        events.close();
+                        status.textContent = "Failed: " + JSON.parse(e.data).error;
+                    });
+                });
+            </script>
+        {{ end }}
+        <table>
+            <tr><th>MIME type</th><td>{{ .MimeType }}</td></tr>
+            <tr><th>Size</th><td>{{ size .Size }} ({{ .Size }} bytes)</td></tr>
+            <tr><th>Modified</th><td>{{ mtime .ModTime }}</td></tr>
+        </table>
+        {{ if .Attrs }}
+            <h2>Attributes</h2>
+            <table>
+                {{ range $key, $value := .Attrs }}
+                    <tr><th>{{ $key }}</th><td>{{ $value }}</td></tr>
+                {{ end }}
+            </table>
+        {{ end }}
+        {{ with .Preview }}
+            <h2>Preview</h2>
+            <style>
+                .preview { border-collapse: collapse; font-family: monospace; }
+                .preview td { padding: 0 0.5em; white-space: pre; vertical-align: top; }
+                .preview .ln { color: #888; text-align: right; user-select: none; }
+                .preview .comment { color: #080; }
+                .preview .string { color: #a11; }
+                .preview .number { color: #905; }
+                .preview .keyword { color: #00a; font-weight: bold; }
+            </style>
+            <table class="preview">
+                {{ range .Lines }}
+                    <tr><td class="ln">{{ .Number }}</td><td>{{ .HTML }}</td></tr>
+                {{ end }}
+            </table>
+            {{ if .Truncated }}
+                <p>Preview truncated. Use the raw link to see the whole file.</p>
+            {{ end }}
+        {{ end }}
+    </body>
+</html>
+{{ end }}
+`
+
+const searchHtml = `
+{{ define "search" }}{{ template "header" . }}
+        <form action="/search!">
+            <input type="search" name="q" value="{{ .Query }}" autofocus>
+            <input type="submit" value="Search">
+        </form>
+        {{ if .Pending }}
+            <p>Still indexing {{ range $i, $name := .Pending }}{{ if $i }}, {{ end }}{{ $name }}{{ end }}, so some results may be missing.</p>
+        {{ end }}
+        {{ if .Query }}
+            {{ if .Hits }}
+                <table>
+                    <thead>
+                        <tr>
+                            <th>Type</th>
+                            <th>Path</th>
+                            <th>MIME type</th>
+                            <th>Size</th>
+                            <th>Modified</th>
+                        </tr>
+                    </thead>
+                    <tbody>
+                        {{ range .Hits }}
+                            <tr>
+                                <td>{{ if eq .Type "dir" }}📁{{ else }}📄{{ end }}</td>
+                                <td><a title="browse" href="{{ .URL }}">{{ .Path }}</a></td>
+                                <td>{{ .MimeType }}</td>
+                                <td>{{ if ne .Type "dir" }}{{ size .Size }}{{ end }}</td>
+                                <td>{{ mtime .ModTime }}</td>
+                            </tr>
+                        {{ end }}
+                    </tbody>
+                </table>
+                {{ if .Truncated }}
+                    <p>Only the first {{ len .Hits }} results are shown.</p>
+                {{ end }}
+            {{ else }}
+                <p>Nothing found.</p>
+            {{ end }}
+        {{ end }}
+    </body>
+</html>
+{{ end }}
+`
+
+const errorHtml = `
+{{ define "error" }}<!DOCTYPE html>
+<html>
+    <head>
+        <meta charset="utf-8">
+        <title>Mighty Browse: {{ .Status }} {{ .StatusText }}</title>
+    </head>
+    <body>
+        <h1>{{ .Status }} {{ .StatusText }}</h1>
+        <p>{{ .Message }}</p>
+        <p><a href="/">Roots</a></p>
+    </body>
+</html>
+{{ end }}
+`
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+	"github.com/SteelPangolin/gotoys/dbm"
+)
+
+// Refuse to decode images bigger than this, since they're decoded entirely in memory.
+const maxThumbSourcePixels = 64 * 1024 * 1024
+
+// Largest thumbnail box allowed by -thumb-size.
+const maxThumbSize = 2048
+
+var thumbDecoders = map[string]func(io.Reader) (image.Image, error){
+	"image/gif":  gif.Decode, // first frame only
+	"image/jpeg": jpeg.Decode,
+	"image/png":  png.Decode,
+}
+
+var thumbConfigDecoders = map[string]func(io.Reader) (image.Config, error){
+	"image/gif":  gif.DecodeConfig,
+	"image/jpeg": jpeg.DecodeConfig,
+	"image/png":  png.DecodeConfig,
+}
+
+func canThumbnail(mediatype string) bool {
+	_, ok := thumbDecoders[mediatype]
+	return ok
+}
+
+// Thumbnails stored in a DBM file.
+// ndbm isn't safe for concurrent use, so all access goes through the mutex.
+type thumbCache struct {
+	mutex sync.Mutex
+	db    *dbm.DBM
+}
+
+func openThumbCache(path string) (*thumbCache, error) {
+	db, err := dbm.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &thumbCache{db: db}, nil
+}
+
+// Cached thumbnails are stored as a content type, a newline, and the image data.
+func (cache *thumbCache) get(key string) (string, []byte) {
+	cache.mutex.Lock()
+	value, err := cache.db.Fetch([]byte(key))
+	cache.mutex.Unlock()
+	if err != nil || value == nil {
+		return "", nil
+	}
+	i := bytes.IndexByte(value, '\n')
+	if i < 0 {
+		return "", nil
+	}
+	return string(value[:i]), value[i+1:]
+}
+
+// Some ndbm implementations limit item sizes, so failing to store is only worth a log message.
+func (cache *thumbCache) put(key, contentType string, data []byte) {
+	value := make([]byte, 0, len(contentType)+1+len(data))
+	value = append(value, contentType...)
+	value = append(value, '\n')
+	value = append(value, data...)
+	cache.mutex.Lock()
+	err := cache.db.Replace([]byte(key), value)
+	cache.mutex.Unlock()
+	if err != nil {
+		log.Printf("Couldn't cache thumbnail %s: %v", key, err)
+	}
+}
+
+// The key changes whenever the file or the thumbnail size does.
+func thumbKey(target *browseTarget, file arclight.VfsFile, box int) string {
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%d",
+		target.Path, file.Size(), target.node.ModTime().UnixNano(), box)
+}
+
+func thumbNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	file, ok := target.node.(arclight.VfsFile)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a file: %s", target.Path)
+	}
+	mediatype, _ := target.node.MimeType()
+	if !canThumbnail(mediatype) {
+		return errorf(http.StatusUnsupportedMediaType, "Can't make thumbnails of %s", mediatype)
+	}
+
+	box := srv.opts.ThumbSize
+	key := thumbKey(target, file, box)
+	tag := fmt.Sprintf(`"%x"`, []byte(key))
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Header().Set("ETag", tag)
+	if etagMatches(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	contentType, data := "", []byte(nil)
+	if srv.thumbs != nil {
+		contentType, data = srv.thumbs.get(key)
+	}
+	if data == nil {
+		var err error
+		contentType, data, err = makeThumbnail(file, mediatype, box)
+		if err != nil {
+			return err
+		}
+		if srv.thumbs != nil {
+			srv.thumbs.put(key, contentType, data)
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	_, err := w.Write(data)
+	return err
+}
+
+// Does an If-None-Match header list this ETag? Weak tags match their strong equivalents.
+func etagMatches(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode an image and scale it to fit in a box×box square.
+// Photos are encoded as JPEG; everything else as PNG to keep transparency.
+func makeThumbnail(file arclight.VfsFile, mediatype string, box int) (string, []byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	config, err := thumbConfigDecoders[mediatype](reader)
+	reader.Close()
+	if err != nil {
+		return "", nil, errorf(http.StatusUnsupportedMediaType, "Couldn't decode image: %v", err)
+	}
+	if int64(config.Width)*int64(config.Height) > maxThumbSourcePixels {
+		return "", nil, errorf(http.StatusRequestEntityTooLarge,
+			"Image too large for a thumbnail: %d×%d", config.Width, config.Height)
+	}
+
+	reader, err = file.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	src, err := thumbDecoders[mediatype](reader)
+	reader.Close()
+	if err != nil {
+		return "", nil, errorf(http.StatusUnsupportedMediaType, "Couldn't decode image: %v", err)
+	}
+
+	dst := image.NewRGBA(fitBox(src.Bounds(), box))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	buf := new(bytes.Buffer)
+	if mediatype == "image/jpeg" {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 85})
+		return "image/jpeg", buf.Bytes(), err
+	}
+	err = png.Encode(buf, dst)
+	return "image/png", buf.Bytes(), err
+}
+
+// Scale bounds down to fit in a box×box square, keeping the aspect ratio.
+// Images that already fit aren't scaled up.
+func fitBox(bounds image.Rectangle, box int) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= box && h <= box {
+		return image.Rect(0, 0, w, h)
+	}
+	if w >= h {
+		w, h = box, h*box/w
+	} else {
+		w, h = w*box/h, box
+	}
+	// very thin images shouldn't vanish entirely
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return image.Rect(0, 0, w, h)
+}
+
+// Listing views other than the default table.
+func listingView(r *http.Request) string {
+	if strings.ToLower(r.URL.Query().Get("view")) == "grid" {
+		return "grid"
+	}
+	return "dir"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	ts := newTestServer(t, serverOptions{ThumbSize: 8}, nil)
+	defer ts.Close()
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 32, 16))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(ts.tempdir, "files", "wide.png"), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := ts.get(t, "/files/wide.png/thumb!", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	thumb, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := thumb.Bounds().Size(); size != image.Pt(8, 4) {
+		t.Errorf("Expected an 8×4 thumbnail, got %v", size)
+	}
+
+	tag := resp.Header.Get("ETag")
+	for _, header := range []string{tag, `"other", ` + tag, "W/" + tag, "*"} {
+		resp, body = ts.get(t, "/files/wide.png/thumb!", http.Header{"If-None-Match": {header}})
+		if resp.StatusCode != http.StatusNotModified || len(body) != 0 {
+			t.Errorf("%s: expected an empty 304, got %d", header, resp.StatusCode)
+		}
+	}
+	resp, _ = ts.get(t, "/files/wide.png/thumb!", http.Header{"If-None-Match": {`"other"`}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 for another ETag, got %d", resp.StatusCode)
+	}
+}
+
+func TestNewServer_ThumbSize(t *testing.T) {
+	for _, size := range []int{0, -1, maxThumbSize + 1} {
+		if _, err := newServer(nil, serverOptions{ThumbSize: size}); err == nil {
+			t.Errorf("Expected an error for thumbnail size %d", size)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// Uploads go into a directory on disk with POST to its upload! action:
+//
+// - multipart/form-data: every part with a file name becomes a file.
+// - Anything else: the body is a file named by the name param.
+//   Large files can be sent in pieces with Content-Range: bytes first-last/total,
+//   which are appended to a hidden partial file until it reaches the total.
+//   Every chunk has to give the same total as the first.
+//   GET on upload!?name=... reports how much has arrived, so interrupted uploads can resume.
+//
+// Existing files are never replaced.
+
+// Prefix and suffix for partial uploads, which live next to the file they'll become.
+const (
+	partialPrefix = ".upload-"
+	partialSuffix = ".part"
+)
+
+// Progress of one uploaded file.
+type uploadStatus struct {
+	Name     string `json:"name"`
+	Received int64  `json:"received"`
+	// Expected size, if known
+	Size     int64 `json:"size,omitempty"`
+	Complete bool  `json:"complete"`
+}
+
+// Check that a request may change the target directory, and find it on disk.
+func (srv *server) writableDir(r *http.Request, target *browseTarget) (string, error) {
+	// browsers send credentials along with forms posted from other sites
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return "", errorf(http.StatusForbidden, "Cross-origin writes aren't allowed")
+		}
+	}
+	if !srv.canWrite(requestUser(r), target.root) {
+		return "", errorf(http.StatusForbidden, "Not allowed to write to %s", target.root.Name)
+	}
+	dir, ok := target.node.(*arclight.OsDir)
+	if !ok {
+		return "", errorf(http.StatusBadRequest, "Not a directory on disk: %s", target.Path)
+	}
+	return dir.Path, nil
+}
+
+// Names from clients and archives can't point anywhere but the directory they're written to.
+func checkFileName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return errorf(http.StatusBadRequest, "Invalid file name %#v", name)
+	}
+	if strings.HasPrefix(name, partialPrefix) && strings.HasSuffix(name, partialSuffix) {
+		return errorf(http.StatusBadRequest, "Reserved file name %#v", name)
+	}
+	return nil
+}
+
+func uploadNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	dirPath, err := srv.writableDir(r, target)
+	if err != nil {
+		return err
+	}
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case r.Method == "GET" || r.Method == "HEAD":
+		return srv.uploadStatus(w, r, dirPath)
+	case r.Method == "POST" && mediatype == "multipart/form-data":
+		return srv.uploadMultipart(w, r, target, dirPath)
+	case r.Method == "POST" || r.Method == "PUT":
+		return srv.uploadBody(w, r, dirPath)
+	}
+	return errorf(http.StatusMethodNotAllowed, "Method %s not allowed", r.Method)
+}
+
+func (srv *server) uploadStatus(w http.ResponseWriter, r *http.Request, dirPath string) error {
+	name := r.URL.Query().Get("name")
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+	status := uploadStatus{Name: name}
+	if fi, err := os.Stat(filepath.Join(dirPath, name)); err == nil {
+		status.Received, status.Size, status.Complete = fi.Size(), fi.Size(), true
+	} else if fi, err := os.Stat(partialPath(dirPath, name)); err == nil {
+		status.Received = fi.Size()
+	}
+	return writeJSON(w, http.StatusOK, status)
+}
+
+func (srv *server) uploadMultipart(w http.ResponseWriter, r *http.Request, target *browseTarget, dirPath string) error {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return errorf(http.StatusBadRequest, "%v", err)
+	}
+	statuses := []uploadStatus{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errorf(http.StatusBadRequest, "%v", err)
+		}
+		name := part.FileName()
+		if name == "" {
+			// not a file field
+			continue
+		}
+		if err := checkFileName(name); err != nil {
+			return err
+		}
+		n, err := writeNewFile(filepath.Join(dirPath, name), part)
+		if err != nil {
+			return err
+		}
+		statuses = append(statuses, uploadStatus{Name: name, Received: n, Size: n, Complete: true})
+	}
+
+	// forms from the directory page go back to it
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, target.URL, http.StatusSeeOther)
+		return nil
+	}
+	return writeJSON(w, http.StatusCreated, statuses)
+}
+
+// Write a file that must not already exist. It appears all at once, or not at all.
+func writeNewFile(path string, content io.Reader) (int64, error) {
+	if _, err := os.Lstat(path); err == nil {
+		return 0, errorf(http.StatusConflict, "%s already exists", filepath.Base(path))
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), partialPrefix)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, content)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, publish(tmp.Name(), path)
+}
+
+// Give a finished file its real name without replacing anything already there.
+func publish(tmpPath, path string) error {
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	// unlike rename, link fails if the destination exists
+	if err := os.Link(tmpPath, path); err != nil {
+		if os.IsExist(err) {
+			return errorf(http.StatusConflict, "%s already exists", filepath.Base(path))
+		}
+		return err
+	}
+	return os.Remove(tmpPath)
+}
+
+func partialPath(dirPath, name string) string {
+	return filepath.Join(dirPath, partialPrefix+name+partialSuffix)
+}
+
+// Partial uploads nobody has sent a chunk for in this long are forgotten,
+// though their partial files stay on disk to be resumed.
+const partialExpiry = 24 * time.Hour
+
+// A partial upload in progress. Chunks for the same partial file are appended one at a time.
+type partialUpload struct {
+	sync.Mutex
+	path string
+	// Total size given by the first chunk
+	total int64
+	// Requests holding or waiting for the lock
+	waiting int
+	touched time.Time
+}
+
+var partialUploads = struct {
+	sync.Mutex
+	uploads map[string]*partialUpload
+}{uploads: make(map[string]*partialUpload)}
+
+func lockPartial(path string) *partialUpload {
+	partialUploads.Lock()
+	now := time.Now()
+	for oldPath, upload := range partialUploads.uploads {
+		if upload.waiting == 0 && now.Sub(upload.touched) >= partialExpiry {
+			delete(partialUploads.uploads, oldPath)
+		}
+	}
+	upload, ok := partialUploads.uploads[path]
+	if !ok {
+		upload = &partialUpload{path: path}
+		partialUploads.uploads[path] = upload
+	}
+	upload.waiting++
+	upload.touched = now
+	partialUploads.Unlock()
+	upload.Lock()
+	return upload
+}
+
+// Release a partial upload, forgetting it once it's complete.
+func (upload *partialUpload) unlock(complete bool) {
+	partialUploads.Lock()
+	upload.waiting--
+	if complete && partialUploads.uploads[upload.path] == upload {
+		delete(partialUploads.uploads, upload.path)
+	}
+	partialUploads.Unlock()
+	upload.Unlock()
+}
+
+// Parse a request's Content-Range: bytes first-last/total
+func parseContentRange(header string) (first, last, total int64, err error) {
+	bad := errorf(http.StatusBadRequest, "Invalid Content-Range %#v", header)
+	spec := strings.TrimPrefix(header, "bytes ")
+	slash := strings.Index(spec, "/")
+	dash := strings.Index(spec, "-")
+	if spec == header || slash < 0 || dash < 0 || dash > slash {
+		return 0, 0, 0, bad
+	}
+	if first, err = strconv.ParseInt(spec[:dash], 10, 64); err != nil {
+		return 0, 0, 0, bad
+	}
+	if last, err = strconv.ParseInt(spec[dash+1:slash], 10, 64); err != nil {
+		return 0, 0, 0, bad
+	}
+	if total, err = strconv.ParseInt(spec[slash+1:], 10, 64); err != nil {
+		return 0, 0, 0, errorf(http.StatusBadRequest, "Content-Range needs a total size")
+	}
+	if first < 0 || last < first || last >= total {
+		return 0, 0, 0, bad
+	}
+	return first, last, total, nil
+}
+
+func (srv *server) uploadBody(w http.ResponseWriter, r *http.Request, dirPath string) error {
+	name := r.URL.Query().Get("name")
+	if err := checkFileName(name); err != nil {
+		return err
+	}
+	path := filepath.Join(dirPath, name)
+
+	header := r.Header.Get("Content-Range")
+	if header == "" {
+		n, err := writeNewFile(path, r.Body)
+		if err != nil {
+			return err
+		}
+		return writeJSON(w, http.StatusCreated, uploadStatus{Name: name, Received: n, Size: n, Complete: true})
+	}
+
+	first, last, total, err := parseContentRange(header)
+	if err != nil {
+		return err
+	}
+	partial := partialPath(dirPath, name)
+	upload := lockPartial(partial)
+	complete := false
+	defer func() {
+		upload.unlock(complete)
+	}()
+
+	if _, err := os.Lstat(path); err == nil {
+		complete = true
+		return errorf(http.StatusConflict, "%s already exists", name)
+	}
+	f, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	status := uploadStatus{Name: name, Received: fi.Size(), Size: total}
+	if fi.Size() == 0 || upload.total == 0 {
+		upload.total = total
+	}
+	if total != upload.total {
+		f.Close()
+		return errorf(http.StatusConflict, "Upload of %s is %d bytes, not %d", name, upload.total, total)
+	}
+	if fi.Size() > total {
+		f.Close()
+		return errorf(http.StatusConflict, "Upload of %s already has more than %d bytes", name, total)
+	}
+	if first != fi.Size() {
+		// the client should resume from what we have
+		f.Close()
+		return writeJSON(w, http.StatusConflict, status)
+	}
+
+	n, err := io.CopyN(f, r.Body, last-first+1)
+	status.Received += n
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// keep what arrived for the next attempt
+		return fmt.Errorf("Upload of %s interrupted at %d bytes: %v", name, status.Received, err)
+	}
+	if status.Received < total {
+		return writeJSON(w, http.StatusAccepted, status)
+	}
+	if err := publish(partial, path); err != nil {
+		return err
+	}
+	complete = true
+	status.Complete = true
+	return writeJSON(w, http.StatusCreated, status)
+}
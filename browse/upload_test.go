@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpload_Chunked(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	contents := "chunk one, chunk two, chunk three"
+	chunks := []struct {
+		first, last int
+		status      int
+	}{
+		{0, 9, http.StatusAccepted},
+		// a retried chunk is refused with what's been received
+		{0, 9, http.StatusConflict},
+		{10, 20, http.StatusAccepted},
+		{21, len(contents) - 1, http.StatusCreated},
+	}
+	for _, chunk := range chunks {
+		header := basicAuth("alice", "alice-password")
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", chunk.first, chunk.last, len(contents)))
+		resp, body := ts.do(t, "PUT", "/uploads/upload!?name=chunked.txt", header, []byte(contents[chunk.first:chunk.last+1]))
+		if resp.StatusCode != chunk.status {
+			t.Fatalf("Chunk %d-%d: expected %d, got %d: %s", chunk.first, chunk.last, chunk.status, resp.StatusCode, body)
+		}
+		var status uploadStatus
+		if err := json.Unmarshal(body, &status); err != nil {
+			t.Fatalf("Couldn't parse %s: %v", body, err)
+		}
+		if status.Received != int64(chunk.last+1) {
+			t.Errorf("Chunk %d-%d: expected %d bytes received, got %d", chunk.first, chunk.last, chunk.last+1, status.Received)
+		}
+	}
+
+	uploaded, err := ioutil.ReadFile(filepath.Join(ts.tempdir, "uploads", "chunked.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(uploaded) != contents {
+		t.Errorf("Expected %q, got %q", contents, uploaded)
+	}
+	partial := partialPath(filepath.Join(ts.tempdir, "uploads"), "chunked.txt")
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be gone, got %v", err)
+	}
+	if _, ok := partialUploads.uploads[partial]; ok {
+		t.Errorf("Expected the finished upload to be forgotten")
+	}
+}
+
+func putChunk(t *testing.T, ts *testServer, name string, first, total int, chunk string) *http.Response {
+	header := basicAuth("alice", "alice-password")
+	header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, first+len(chunk)-1, total))
+	resp, _ := ts.do(t, "PUT", "/uploads/upload!?name="+name, header, []byte(chunk))
+	return resp
+}
+
+// Every chunk has to agree with the first about the total size
+func TestUpload_ChangedTotal(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	if resp := putChunk(t, ts, "changed.txt", 0, 10, "12345"); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	if resp := putChunk(t, ts, "changed.txt", 5, 6, "6"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for a smaller total, got %d", resp.StatusCode)
+	}
+	if resp := putChunk(t, ts, "changed.txt", 5, 10, "67890"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected 201, got %d", resp.StatusCode)
+	}
+	uploaded, err := ioutil.ReadFile(filepath.Join(ts.tempdir, "uploads", "changed.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(uploaded) != "1234567890" {
+		t.Errorf("Expected %q, got %q", "1234567890", uploaded)
+	}
+}
+
+// Uploads nobody has touched for a while are forgotten when another one starts
+func TestUpload_Expiry(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	if resp := putChunk(t, ts, "stale.txt", 0, 10, "12345"); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	stale := partialPath(filepath.Join(ts.tempdir, "uploads"), "stale.txt")
+	partialUploads.Lock()
+	partialUploads.uploads[stale].touched = time.Now().Add(-partialExpiry)
+	partialUploads.Unlock()
+
+	if resp := putChunk(t, ts, "fresh.txt", 0, 10, "12345"); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d", resp.StatusCode)
+	}
+	partialUploads.Lock()
+	_, staleKept := partialUploads.uploads[stale]
+	_, freshKept := partialUploads.uploads[partialPath(filepath.Join(ts.tempdir, "uploads"), "fresh.txt")]
+	partialUploads.Unlock()
+	if staleKept || !freshKept {
+		t.Errorf("Expected only the fresh upload to be remembered")
+	}
+
+	// the partial file is still there to resume
+	if resp := putChunk(t, ts, "stale.txt", 5, 10, "67890"); resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected 201 resuming the stale upload, got %d", resp.StatusCode)
+	}
+}
+
+func TestUpload_Denied(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		status int
+	}{
+		{"not on the write list", "/uploads/upload!?name=a.txt", basicAuth("bob", "bob-password"), http.StatusForbidden},
+		{"read-only root", "/files/upload!?name=a.txt", basicAuth("alice", "alice-password"), http.StatusForbidden},
+		{"cross-origin", "/uploads/upload!?name=a.txt", basicAuth("alice", "alice-password"), http.StatusForbidden},
+		{"path in name", "/uploads/upload!?name=../a.txt", basicAuth("alice", "alice-password"), http.StatusBadRequest},
+	}
+	tests[2].header.Set("Origin", "http://elsewhere.example")
+	for _, test := range tests {
+		resp, body := ts.do(t, "PUT", test.path, test.header, []byte("upload"))
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.name, test.status, resp.StatusCode, body)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ts.tempdir, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written outside uploads, got %v", err)
+	}
+}
+
+// Extract an archive into uploads and return the job's final event.
+func extract(t *testing.T, ts *testServer, archive string) string {
+	header := basicAuth("alice", "alice-password")
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, body := ts.do(t, "POST", archive+"/extract!", header, []byte("dest=uploads"))
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", resp.StatusCode, body)
+	}
+	var started extractStarted
+	if err := json.Unmarshal(body, &started); err != nil {
+		t.Fatalf("Couldn't parse %s: %v", body, err)
+	}
+	_, events := ts.get(t, started.Events, basicAuth("alice", "alice-password"))
+	lines := strings.Split(strings.TrimSpace(string(events)), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected events, got %q", events)
+	}
+	return strings.TrimPrefix(lines[len(lines)-2], "event: ")
+}
+
+func TestExtract(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	if event := extract(t, ts, "/files/docs.zip"); event != "done" {
+		t.Fatalf("Expected done, got %s", event)
+	}
+	for name, contents := range testZipFiles {
+		extracted, err := ioutil.ReadFile(filepath.Join(ts.tempdir, "uploads", filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("Couldn't read %s: %v", name, err)
+		} else if string(extracted) != contents {
+			t.Errorf("Expected %s to be %q, got %q", name, contents, extracted)
+		}
+	}
+}
+
+// A byte limit of 0 means no limit, like the other extract limits
+func TestExtract_NoByteLimit(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+	ts.srv.opts.MaxExtractBytes = 0
+
+	if event := extract(t, ts, "/files/docs.zip"); event != "done" {
+		t.Fatalf("Expected done, got %s", event)
+	}
+	extracted, err := ioutil.ReadFile(filepath.Join(ts.tempdir, "uploads", "top.txt"))
+	if err != nil {
+		t.Fatalf("Couldn't read top.txt: %v", err)
+	}
+	if string(extracted) != testZipFiles["top.txt"] {
+		t.Errorf("Expected %q, got %q", testZipFiles["top.txt"], extracted)
+	}
+}
+
+// Members whose names would escape the dest directory fail the job, and nothing is left behind
+func TestExtract_Traversal(t *testing.T) {
+	ts := newAuthTestServer(t)
+	defer ts.Close()
+
+	for i, name := range []string{`..\evil.txt`, "../evil.txt"} {
+		archive := fmt.Sprintf("evil%d.zip", i)
+		evil := zipBytes(t, map[string]string{name: "escaped"})
+		if err := ioutil.WriteFile(filepath.Join(ts.tempdir, "files", archive), evil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if event := extract(t, ts, "/files/"+archive); event != "failed" {
+			t.Errorf("%s: expected failed, got %s", name, event)
+		}
+		names, err := ioutil.ReadDir(filepath.Join(ts.tempdir, "uploads"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 0 {
+			t.Errorf("%s: expected nothing extracted, got %d files", name, len(names))
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ts.tempdir, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written outside uploads, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// Stream a new Zip archive of a directory, or of a directory inside an archive.
+func zipNode(srv *server, w http.ResponseWriter, r *http.Request, target *browseTarget) error {
+	dir, ok := target.node.(arclight.VfsDirNode)
+	if !ok {
+		return errorf(http.StatusBadRequest, "Not a directory: %s", target.Path)
+	}
+
+	// the root of a Zip archive keeps its own name
+	name := target.Crumbs[len(target.Crumbs)-1].Name
+	if !strings.HasSuffix(strings.ToLower(name), ".zip") {
+		name += ".zip"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+
+	// The archive is written as it's built, so errors after the first byte
+	// can't be reported to the client; it'll get a truncated archive instead.
+	if err := arclight.ExportZip(w, dir, arclight.ZipExportOptions{}); err != nil {
+		log.Printf("%s %s: zip interrupted: %v", r.Method, r.URL.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+// Read-only WebDAV server for arclight trees.
+// Archives are presented as collections, so clients can browse into them.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"flag"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	slashpath "path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// XML namespace for NodeAttrs dead properties.
+const attrsNamespace = "https://github.com/SteelPangolin/gotoys/arclight#attrs"
+
+var errReadOnly = os.ErrPermission
+
+type contextKey int
+
+const archivesKey contextKey = iota
+
+// Archives opened while serving a request, closed when the request is done.
+func requestArchives(ctx context.Context) *arclight.Archives {
+	archives, ok := ctx.Value(archivesKey).(*arclight.Archives)
+	if !ok {
+		return new(arclight.Archives)
+	}
+	return archives
+}
+
+// Adapts an arclight tree to webdav.FileSystem.
+type vfsFileSystem struct {
+	root    arclight.VfsDirNode
+	descend bool
+}
+
+func (fs *vfsFileSystem) resolve(ctx context.Context, name string) (arclight.VfsNode, error) {
+	var node arclight.VfsNode
+	var err error
+	// WebDAV paths come straight from the request, so keep them inside the root
+	relpath := strings.TrimPrefix(slashpath.Clean("/"+filepath.ToSlash(name)), "/")
+	if relpath == ".." || strings.HasPrefix(relpath, "../") {
+		err = os.ErrNotExist
+	} else if fs.descend {
+		node, err = requestArchives(ctx).ResolvePath(fs.root, relpath)
+	} else if relpath == "" {
+		node = fs.root
+	} else {
+		node, err = fs.root.Resolve(relpath)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return node, nil
+}
+
+func (fs *vfsFileSystem) specialize(archives *arclight.Archives, node arclight.VfsNode) arclight.VfsNode {
+	if fs.descend {
+		return archives.Specialize(node)
+	}
+	return node
+}
+
+func (fs *vfsFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: errReadOnly}
+}
+
+func (fs *vfsFileSystem) RemoveAll(ctx context.Context, name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+func (fs *vfsFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return &os.PathError{Op: "rename", Path: oldName, Err: errReadOnly}
+}
+
+const writeFlags = os.O_WRONLY | os.O_RDWR | os.O_APPEND | os.O_CREATE | os.O_TRUNC
+
+func (fs *vfsFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&writeFlags != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errReadOnly}
+	}
+	node, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{fs: fs, archives: requestArchives(ctx), node: node}, nil
+}
+
+func (fs *vfsFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	node, err := fs.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return nodeInfo{node}, nil
+}
+
+// Adapts an arclight node to os.FileInfo,
+// with the optional webdav.ContentTyper interface.
+type nodeInfo struct {
+	node arclight.VfsNode
+}
+
+func (fi nodeInfo) Name() string {
+	return fi.node.Name()
+}
+
+func (fi nodeInfo) Size() int64 {
+	if file, ok := fi.node.(arclight.VfsFile); ok && !fi.IsDir() {
+		return file.Size()
+	}
+	return 0
+}
+
+func (fi nodeInfo) Mode() os.FileMode {
+	if fi.IsDir() {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (fi nodeInfo) ModTime() time.Time {
+	return fi.node.ModTime()
+}
+
+func (fi nodeInfo) IsDir() bool {
+	_, ok := fi.node.(arclight.VfsDir)
+	return ok
+}
+
+func (fi nodeInfo) Sys() interface{} {
+	return fi.node
+}
+
+func (fi nodeInfo) ContentType(ctx context.Context) (string, error) {
+	return contentType(fi.node), nil
+}
+
+func contentType(node arclight.VfsNode) string {
+	mediatype, params := node.MimeType()
+	return mime.FormatMediaType(mediatype, params)
+}
+
+// Adapts an arclight node to webdav.File.
+// File contents aren't opened until they're read,
+// since PROPFIND opens files just to look at their properties.
+type davFile struct {
+	fs       *vfsFileSystem
+	archives *arclight.Archives
+	node     arclight.VfsNode
+	reader   arclight.SeekableReader
+	children []os.FileInfo
+	childPos int
+}
+
+func (f *davFile) open() error {
+	if f.reader != nil {
+		return nil
+	}
+	file, ok := f.node.(arclight.VfsFile)
+	if !ok || (nodeInfo{f.node}).IsDir() {
+		return &os.PathError{Op: "read", Path: f.node.Name(), Err: os.ErrInvalid}
+	}
+	reader, err := arclight.OpenSeekable(file)
+	if err != nil {
+		return err
+	}
+	f.reader = reader
+	return nil
+}
+
+func (f *davFile) Close() error {
+	if f.reader != nil {
+		return f.reader.Close()
+	}
+	return nil
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.reader.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.reader.Seek(offset, whence)
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.node.Name(), Err: errReadOnly}
+}
+
+// Same semantics as os.File.Readdir().
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	dir, ok := f.node.(arclight.VfsDir)
+	if !ok {
+		return nil, &os.PathError{Op: "readdir", Path: f.node.Name(), Err: os.ErrInvalid}
+	}
+	if f.children == nil {
+		children, err := dir.Children()
+		if err != nil {
+			return nil, err
+		}
+		f.children = make([]os.FileInfo, len(children))
+		for i, child := range children {
+			f.children[i] = nodeInfo{f.fs.specialize(f.archives, child)}
+		}
+	}
+
+	remaining := f.children[f.childPos:]
+	if count <= 0 {
+		f.childPos = len(f.children)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	f.childPos += count
+	return remaining[:count], nil
+}
+
+func (f *davFile) Stat() (os.FileInfo, error) {
+	return nodeInfo{f.node}, nil
+}
+
+// NodeAttrs become dead properties in attrsNamespace.
+func (f *davFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	props := make(map[xml.Name]webdav.Property)
+	for key, value := range f.node.Attrs() {
+		name := xml.Name{Space: attrsNamespace, Local: xmlLocalName(key)}
+		buf := new(bytes.Buffer)
+		if err := xml.EscapeText(buf, []byte(value)); err != nil {
+			return nil, err
+		}
+		props[name] = webdav.Property{
+			XMLName:  name,
+			InnerXML: buf.Bytes(),
+		}
+	}
+	return props, nil
+}
+
+// Reject all property changes.
+func (f *davFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	propstat := webdav.Propstat{Status: http.StatusForbidden}
+	for _, patch := range patches {
+		for _, prop := range patch.Props {
+			propstat.Props = append(propstat.Props, webdav.Property{XMLName: prop.XMLName})
+		}
+	}
+	return []webdav.Propstat{propstat}, nil
+}
+
+// Replace characters that aren't allowed in XML names.
+func xmlLocalName(key string) string {
+	name := []rune(key)
+	for i, c := range name {
+		isLetter := ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || c == '_' || c > 0x7f
+		isNameChar := isLetter || ('0' <= c && c <= '9') || c == '-' || c == '.'
+		if (i == 0 && !isLetter) || !isNameChar {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+type server struct {
+	fs  *vfsFileSystem
+	dav *webdav.Handler
+}
+
+// The webdav package picks Content-Type for GET by file name,
+// so set it from the node's MIME type first.
+// Archives opened during the request are closed once it's been served.
+func (srv *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	archives := new(arclight.Archives)
+	defer archives.Close()
+	r = r.WithContext(context.WithValue(r.Context(), archivesKey, archives))
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if node, err := srv.fs.resolve(r.Context(), r.URL.Path); err == nil {
+			if !(nodeInfo{node}).IsDir() {
+				w.Header().Set("Content-Type", contentType(node))
+			}
+		}
+	}
+	srv.dav.ServeHTTP(w, r)
+}
+
+func newServer(root arclight.VfsDirNode, descend bool) *server {
+	fs := &vfsFileSystem{
+		root:    root,
+		descend: descend,
+	}
+	return &server{
+		fs: fs,
+		dav: &webdav.Handler{
+			FileSystem: fs,
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+				}
+			},
+		},
+	}
+}
+
+func main() {
+	rootPath := flag.String("root", ".", "directory or archive to serve")
+	listen := flag.String("listen", ":8080", "address to listen on")
+	descend := flag.Bool("descend", true, "present archives as collections")
+	flag.Parse()
+
+	fi, err := os.Stat(*rootPath)
+	if err != nil {
+		log.Fatalf("Couldn't stat root: %v", err)
+	}
+	root, ok := arclight.Specialize(arclight.NewOsNode(*rootPath, fi)).(arclight.VfsDirNode)
+	if !ok {
+		log.Fatalf("Root is not a directory or archive: %s", *rootPath)
+	}
+
+	srv := newServer(root, *descend)
+
+	log.Printf("Serving %s on %s", *rootPath, *listen)
+	log.Fatal(http.ListenAndServe(*listen, srv))
+}
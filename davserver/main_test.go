@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/arclight"
+)
+
+// A server for a directory with a text file and a Zip archive holding docs/a.txt,
+// next to a secret file that shouldn't be served.
+func testServer(t *testing.T, descend bool) (*httptest.Server, func()) {
+	tempdir, err := ioutil.TempDir("", "TestDavServer")
+	if err != nil {
+		t.Fatalf("Couldn't create tempdir: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(tempdir) }
+
+	rootPath := filepath.Join(tempdir, "root")
+	if err := os.Mkdir(rootPath, 0755); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tempdir, "secret.txt"), []byte("secret"), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootPath, "hello.txt"), []byte("hello, world\n"), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"docs/a.txt", "docs/b.txt"} {
+		fw, err := w.Create(name)
+		if err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+		fw.Write([]byte("zipped " + name))
+	}
+	w.Close()
+	if err := ioutil.WriteFile(filepath.Join(rootPath, "sub.zip"), buf.Bytes(), 0644); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(rootPath)
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	root := arclight.NewOsDir(rootPath, fi)
+	ts := httptest.NewServer(newServer(root, descend))
+	return ts, func() {
+		ts.Close()
+		cleanup()
+	}
+}
+
+func do(t *testing.T, method, url string, header map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// Archives are collections, and their members have content types
+func TestPropfind(t *testing.T) {
+	ts, cleanup := testServer(t, true)
+	defer cleanup()
+
+	resp, body := do(t, "PROPFIND", ts.URL+"/", map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d: %s", resp.StatusCode, body)
+	}
+	for _, expected := range []string{"/hello.txt", "/sub.zip/", "text/plain"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in %s", expected, body)
+		}
+	}
+
+	resp, body = do(t, "PROPFIND", ts.URL+"/sub.zip/docs/", map[string]string{"Depth": "1"})
+	if resp.StatusCode != http.StatusMultiStatus {
+		t.Fatalf("Expected 207, got %d: %s", resp.StatusCode, body)
+	}
+	for _, expected := range []string{"/sub.zip/docs/a.txt", "/sub.zip/docs/b.txt", "<D:collection"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in %s", expected, body)
+		}
+	}
+	if strings.Count(body, "<D:getcontenttype>text/plain") != 2 {
+		t.Errorf("Expected both members to be text/plain: %s", body)
+	}
+}
+
+func TestGet_Range(t *testing.T) {
+	ts, cleanup := testServer(t, true)
+	defer cleanup()
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/hello.txt", "ello"},
+		{"/sub.zip/docs/a.txt", "ippe"},
+	}
+	for _, test := range tests {
+		resp, body := do(t, "GET", ts.URL+test.path, map[string]string{"Range": "bytes=1-4"})
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Errorf("%s: expected 206, got %d", test.path, resp.StatusCode)
+		}
+		if body != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.path, test.expected, body)
+		}
+		if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+			t.Errorf("%s: expected text/plain, got %s", test.path, contentType)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	ts, cleanup := testServer(t, true)
+	defer cleanup()
+
+	for _, method := range []string{"PUT", "DELETE", "MKCOL"} {
+		resp, _ := do(t, method, ts.URL+"/new.txt", nil)
+		if resp.StatusCode < 400 {
+			t.Errorf("%s: expected an error, got %d", method, resp.StatusCode)
+		}
+	}
+}
+
+// Paths that climb out of the root aren't served, whether or not archives are descended into
+func TestGet_Traversal(t *testing.T) {
+	for _, descend := range []bool{true, false} {
+		ts, cleanup := testServer(t, descend)
+		for _, path := range []string{"/../secret.txt", "/sub/../../secret.txt", "/..", "/%2e%2e/secret.txt"} {
+			resp, body := do(t, "GET", ts.URL+path, nil)
+			if resp.StatusCode == http.StatusOK || strings.Contains(body, "secret") {
+				t.Errorf("descend %v, %s: expected an error, got %d %q", descend, path, resp.StatusCode, body)
+			}
+		}
+		resp, body := do(t, "GET", ts.URL+"/hello.txt", nil)
+		if resp.StatusCode != http.StatusOK || body != "hello, world\n" {
+			t.Errorf("descend %v: expected hello.txt, got %d %q", descend, resp.StatusCode, body)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,232 @@
+package pdf
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+// Codes from low to high, compared byte by byte, such as <8140> to <9FFC>.
+type codespace struct {
+	low  []byte
+	high []byte
+}
+
+func (cs codespace) contains(code []byte) bool {
+	if len(code) != len(cs.low) {
+		return false
+	}
+	for i, b := range code {
+		if b < cs.low[i] || b > cs.high[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CIDs for codes from low to high, starting with cid.
+type cidRange struct {
+	low  uint32
+	high uint32
+	cid  int
+}
+
+// A CMap maps character codes of 1 to 4 bytes to CIDs, for a CID font's encoding,
+// or to Unicode text, for any font's ToUnicode.
+type cmap struct {
+	codespaces []codespace
+	cids       []cidRange
+	unicode    map[uint32]string
+}
+
+func newCMap() *cmap {
+	return &cmap{
+		unicode: map[uint32]string{},
+	}
+}
+
+// The predefined Identity-H and Identity-V CMaps: 2-byte codes that are their own CIDs.
+func identityCMap() *cmap {
+	c := newCMap()
+	c.useIdentity()
+	return c
+}
+
+func (c *cmap) useIdentity() {
+	c.codespaces = append(c.codespaces, codespace{[]byte{0, 0}, []byte{0xff, 0xff}})
+	c.cids = append(c.cids, cidRange{0, 0xffff, 0})
+}
+
+// A code's bytes as a number.
+func codeValue(code []byte) uint32 {
+	value := uint32(0)
+	for _, b := range code {
+		value = value<<8 | uint32(b)
+	}
+	return value
+}
+
+// Text from a ToUnicode destination, which is UTF-16BE.
+func utf16Text(s String) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// Add one to the last character of a bfrange destination, for each code after the first.
+func offsetText(text string, offset uint32) string {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return text
+	}
+	runes[len(runes)-1] += rune(offset)
+	return string(runes)
+}
+
+// bfrange and cidrange should only vary the last byte,
+// but a broken one shouldn't make a map of billions of codes,
+// and neither should thousands of ranges that are each just small enough.
+// CID font /W ranges have the same limits.
+const (
+	maxCMapRange   = 0xffff
+	maxCMapEntries = 1 << 18
+)
+
+// Parse an embedded CMap, which is PostScript, but simple enough that
+// the content stream parser can read it: each end... operator gets
+// the operands since the matching begin... operator.
+func parseCMap(data []byte) (*cmap, error) {
+	commands, err := ParseContent(data)
+	if err != nil {
+		return nil, err
+	}
+	c := newCMap()
+	// codes filled in by bfranges so far
+	entries := 0
+	for _, command := range commands {
+		ops := command.Operands
+		switch command.Word {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(ops); i += 2 {
+				low, lowOk := ops[i].(String)
+				high, highOk := ops[i+1].(String)
+				if lowOk && highOk && len(low) == len(high) && len(low) >= 1 && len(low) <= 4 {
+					c.codespaces = append(c.codespaces, codespace{[]byte(low), []byte(high)})
+				}
+			}
+
+		case "endbfchar":
+			for i := 0; i+1 < len(ops); i += 2 {
+				code, ok := ops[i].(String)
+				if !ok {
+					continue
+				}
+				switch dst := ops[i+1].(type) {
+				case String:
+					c.unicode[codeValue([]byte(code))] = utf16Text(dst)
+				case Name:
+					// a glyph name instead of text
+					if text, ok := glyphText(string(dst)); ok {
+						c.unicode[codeValue([]byte(code))] = text
+					}
+				}
+			}
+
+		case "endbfrange":
+			for i := 0; i+2 < len(ops); i += 3 {
+				lowStr, lowOk := ops[i].(String)
+				highStr, highOk := ops[i+1].(String)
+				if !lowOk || !highOk {
+					continue
+				}
+				low, high := codeValue([]byte(lowStr)), codeValue([]byte(highStr))
+				if high < low || high-low > maxCMapRange || entries+int(high-low)+1 > maxCMapEntries {
+					continue
+				}
+				entries += int(high-low) + 1
+				switch dst := ops[i+2].(type) {
+				case String:
+					text := utf16Text(dst)
+					for offset := uint32(0); offset <= high-low; offset++ {
+						c.unicode[low+offset] = offsetText(text, offset)
+					}
+				case Array:
+					// one destination per code
+					for j, elem := range dst {
+						if text, ok := elem.(String); ok && low+uint32(j) <= high {
+							c.unicode[low+uint32(j)] = utf16Text(text)
+						}
+					}
+				}
+			}
+
+		case "endcidchar":
+			for i := 0; i+1 < len(ops); i += 2 {
+				code, codeOk := ops[i].(String)
+				cid, cidOk := ops[i+1].(Int)
+				if codeOk && cidOk {
+					value := codeValue([]byte(code))
+					c.cids = append(c.cids, cidRange{value, value, int(cid)})
+				}
+			}
+
+		case "endcidrange":
+			for i := 0; i+2 < len(ops); i += 3 {
+				low, lowOk := ops[i].(String)
+				high, highOk := ops[i+1].(String)
+				cid, cidOk := ops[i+2].(Int)
+				if lowOk && highOk && cidOk {
+					c.cids = append(c.cids, cidRange{codeValue([]byte(low)), codeValue([]byte(high)), int(cid)})
+				}
+			}
+
+		case "usecmap":
+			// only the predefined CMaps that need no data are available
+			if len(ops) > 0 {
+				if name, ok := ops[len(ops)-1].(Name); ok && strings.HasPrefix(string(name), "Identity-") {
+					c.useIdentity()
+				}
+			}
+		}
+	}
+	return c, nil
+}
+
+// The code at the start of s and its length in bytes.
+// A code is the shortest run of bytes that's in a codespace range.
+// Bytes that aren't are taken in pieces as long as the shortest range's codes.
+func (c *cmap) next(s []byte) (code uint32, n int) {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, cs := range c.codespaces {
+			if cs.contains(s[:n]) {
+				return codeValue(s[:n]), n
+			}
+		}
+	}
+	n = 4
+	for _, cs := range c.codespaces {
+		if len(cs.low) < n {
+			n = len(cs.low)
+		}
+	}
+	if len(c.codespaces) == 0 {
+		n = 1
+	}
+	if n > len(s) {
+		n = len(s)
+	}
+	return codeValue(s[:n]), n
+}
+
+// The CID for a code, or 0, which is the missing glyph.
+// Later mappings override earlier ones.
+func (c *cmap) cid(code uint32) int {
+	for i := len(c.cids) - 1; i >= 0; i-- {
+		r := c.cids[i]
+		if r.low <= code && code <= r.high {
+			return r.cid + int(code-r.low)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,135 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testCMap = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Test def
+2 begincodespacerange
+<00> <7F>
+<8000> <FFFF>
+endcodespacerange
+2 begincidrange
+<8000> <80FF> 100
+<41> <5A> 1
+endcidrange
+1 begincidchar
+<8001> 7
+endcidchar
+2 beginbfchar
+<41> <0041>
+<8000> /f_i
+endbfchar
+3 beginbfrange
+<42> <44> <0062>
+<8010> <8012> [<0078> <D83DDE00> <00660066>]
+<45> <46> <00E9>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end
+`
+
+func TestCMap_Parse(t *testing.T) {
+	c, err := parseCMap([]byte(testCMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unicode := map[uint32]string{
+		0x41:   "A",
+		0x42:   "b",
+		0x44:   "d",
+		0x45:   "é",
+		0x46:   "ê",
+		0x8000: "fi",
+		0x8010: "x",
+		0x8011: "\U0001F600",
+		0x8012: "ff",
+	}
+	for code, expected := range unicode {
+		if text := c.unicode[code]; text != expected {
+			t.Errorf("Code %#x: expected %q, got %q", code, expected, text)
+		}
+	}
+
+	cids := map[uint32]int{0x41: 1, 0x5a: 26, 0x8000: 100, 0x8001: 7, 0x8002: 102, 0x9000: 0}
+	for code, expected := range cids {
+		if cid := c.cid(code); cid != expected {
+			t.Errorf("Code %#x: expected CID %d, got %d", code, expected, cid)
+		}
+	}
+}
+
+// Codes are as long as the codespace that contains them
+func TestCMap_Next(t *testing.T) {
+	c, err := parseCMap([]byte(testCMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := []byte("A\x80\x10B\x80")
+	expected := []struct {
+		code uint32
+		n    int
+	}{{0x41, 1}, {0x8010, 2}, {0x42, 1}, {0x80, 1}}
+	for _, e := range expected {
+		code, n := c.next(s)
+		if code != e.code || n != e.n {
+			t.Errorf("Expected code %#x of %d bytes, got %#x of %d", e.code, e.n, code, n)
+		}
+		s = s[n:]
+	}
+	if len(s) != 0 {
+		t.Errorf("Expected the whole string to be used, %d bytes left", len(s))
+	}
+}
+
+func TestGlyphText(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		ok       bool
+	}{
+		{"A", "A", true},
+		{"quoteright", "’", true},
+		{"a.sc", "a", true},
+		{"f_f_i", "ffi", true},
+		{"uni00410042", "AB", true},
+		{"u1F600", "\U0001F600", true},
+		{"g123", "", false},
+		{".notdef", "", false},
+	}
+	for _, test := range tests {
+		text, ok := glyphText(test.name)
+		if text != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %q %v, got %q %v", test.name, test.expected, test.ok, text, ok)
+		}
+	}
+}
+
+// Ranges that are each small enough still can't add up to more than maxCMapEntries codes
+func TestCMap_EntryLimit(t *testing.T) {
+	ranges := maxCMapEntries/(maxCMapRange+1) + 1
+	buf := new(strings.Builder)
+	fmt.Fprintf(buf, "begincmap\n%d beginbfrange\n", ranges)
+	for i := 0; i < ranges; i++ {
+		fmt.Fprintf(buf, "<%04X0000> <%04XFFFF> <0041>\n", i, i)
+	}
+	buf.WriteString("endbfrange\nendcmap\n")
+
+	c, err := parseCMap([]byte(buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.unicode) != maxCMapEntries {
+		t.Errorf("Expected %d codes, got %d", maxCMapEntries, len(c.unicode))
+	}
+	if text, ok := c.unicode[uint32(ranges-1)<<16]; ok {
+		t.Errorf("Expected the last range to be dropped, got %q", text)
+	}
+}
@@ -0,0 +1,78 @@
+// Print the text of each page of a PDF file, with a blank line after each page.
+//
+//	pdftext [-revision n] file.pdf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+import (
+	"github.com/SteelPangolin/gotoys/pdf"
+)
+
+func main() {
+	revision := flag.Int("revision", -1, "read the document as of this revision, counting from 0")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: pdftext [-revision n] file.pdf")
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pdftext: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pdftext: %v\n", err)
+		os.Exit(1)
+	}
+
+	doc, err := pdf.Open(f, fi.Size())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pdftext: %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	printWarnings := func(warnings []error) {
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "pdftext: %s: warning: %v\n", path, warning)
+		}
+	}
+	printWarnings(doc.Warnings)
+	printed := len(doc.Warnings)
+	if *revision >= 0 {
+		if doc, err = doc.AtRevision(*revision); err != nil {
+			fmt.Fprintf(os.Stderr, "pdftext: %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		printed = 0
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "pdftext: %s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	// one bad page shouldn't keep us from reading the rest
+	failed := false
+	for i, page := range pages {
+		text, err := doc.PageText(page)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "pdftext: %s: page %d: %v\n", path, i+1, err)
+			failed = true
+		} else {
+			fmt.Printf("%s\n", text)
+		}
+	}
+	// reading pages can turn up more problems, such as broken fonts
+	printWarnings(doc.Warnings[printed:])
+	if failed {
+		os.Exit(1)
+	}
+}
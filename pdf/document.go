@@ -0,0 +1,385 @@
+// Package pdf reads the object structure of PDF files
+// and parses the content streams that draw their pages.
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// A PDF file. Objects are read from the file as they're needed,
+// using the cross-reference sections to find them.
+type Document struct {
+	// objects that have been read so far
+	Objects map[Ref]Object
+	// Oldest first. Incrementally updated PDFs have one per update.
+	// Linearized PDFs have an extra one for the first page.
+	Revisions []*Revision
+	// Problems that were worked around, such as a damaged cross-reference table
+	Warnings []error
+
+	r    io.ReaderAt
+	size int64
+	// true if every object was read up front because the cross-reference sections were unusable
+	scanned bool
+	// object streams decoded so far, by object number
+	objStreams map[int64]*objectStream
+	// object streams being decoded, to catch ones that need their own objects
+	decodingObjStreams map[int64]bool
+	// true while looking up an indirect stream /Length
+	resolvingLength bool
+	// fonts read so far for text extraction
+	fonts map[Ref]*font
+}
+
+func newDocument() *Document {
+	return &Document{
+		Objects: map[Ref]Object{},
+	}
+}
+
+// Open a PDF file of the given size.
+// If the cross-reference sections are missing or damaged,
+// the whole file is scanned for objects instead.
+func Open(r io.ReaderAt, size int64) (*Document, error) {
+	doc := newDocument()
+	doc.r = r
+	doc.size = size
+
+	offset, err := doc.findStartxref()
+	if err == nil {
+		err = doc.readXrefChain(offset)
+	}
+	if err != nil {
+		doc.Warnings = append(doc.Warnings, err)
+		if err := doc.scan(); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// Parse a PDF file that's already in memory.
+func Parse(buf []byte) (*Document, error) {
+	return Open(bytes.NewReader(buf), int64(len(buf)))
+}
+
+// Read every object in the file, in order, ignoring cross-reference sections.
+// Later definitions of an object replace earlier ones.
+func (doc *Document) scan() error {
+	doc.scanned = true
+	doc.Objects = map[Ref]Object{}
+	doc.Revisions = nil
+
+	dp := &DocumentParser{Doc: doc, offsets: map[Ref]int64{}}
+	t := NewTokenizerAt(doc.r, 0, doc.size)
+	if err := parse(t, dp); err != nil {
+		return err
+	}
+	doc.Warnings = append(doc.Warnings, t.warnings...)
+
+	// xref streams are the trailers of files that use them,
+	// and object streams hold objects the scan couldn't see.
+	// Both are handled in file order, so later updates win.
+	streams := []*Stream{}
+	for _, obj := range doc.Objects {
+		if stream, ok := obj.(*Stream); ok {
+			switch streamType, _ := stream.Attrs["Type"].(Name); streamType {
+			case "XRef", "ObjStm":
+				streams = append(streams, stream)
+			}
+		}
+	}
+	sort.Sort(byOffset(streams))
+	for _, stream := range streams {
+		if streamType, _ := stream.Attrs["Type"].(Name); streamType == "XRef" {
+			doc.Revisions = append(doc.Revisions, &Revision{XrefOffset: -1, Trailer: stream.Attrs})
+			continue
+		}
+		objStm, err := decodeObjectStream(stream)
+		if err != nil {
+			doc.Warnings = append(doc.Warnings, err)
+			continue
+		}
+		for i, num := range objStm.nums {
+			ref := Ref{num, 0}
+			if offset, ok := dp.offsets[ref]; ok && offset > stream.offset {
+				continue
+			}
+			obj, err := objStm.object(doc, i, num)
+			if err != nil {
+				doc.Warnings = append(doc.Warnings, err)
+				continue
+			}
+			doc.Objects[ref] = obj
+			dp.offsets[ref] = stream.offset
+		}
+	}
+	return nil
+}
+
+type byOffset []*Stream
+
+func (streams byOffset) Len() int {
+	return len(streams)
+}
+
+func (streams byOffset) Swap(i, j int) {
+	streams[i], streams[j] = streams[j], streams[i]
+}
+
+func (streams byOffset) Less(i, j int) bool {
+	return streams[i].offset < streams[j].offset
+}
+
+// The object a reference points to, read from the file if it hasn't been yet.
+// Free and missing objects are null, and so are references to generations
+// of an object that have since been replaced.
+func (doc *Document) Object(ref Ref) (Object, error) {
+	if obj, ok := doc.Objects[ref]; ok {
+		return obj, nil
+	}
+	if doc.scanned {
+		return Null{}, nil
+	}
+	entry, ok := doc.xrefEntry(ref.Num)
+	if !ok {
+		return Null{}, nil
+	}
+	switch entry.kind {
+	case xrefInUse:
+		if entry.gen != ref.Gen {
+			return Null{}, nil
+		}
+		obj, _, err := doc.readObject(entry.offset, &ref)
+		if err != nil {
+			return nil, err
+		}
+		doc.Objects[ref] = obj
+		return obj, nil
+	case xrefCompressed:
+		obj, err := doc.compressedObject(ref, entry)
+		if err != nil {
+			return nil, err
+		}
+		doc.Objects[ref] = obj
+		return obj, nil
+	}
+	return Null{}, nil
+}
+
+// The value of an indirect stream /Length.
+// Lengths are integers, so a stream whose length is another stream can't come up,
+// and not looking up lengths while looking up a length keeps that from recursing.
+func (doc *Document) streamLength(ref Ref) (int64, bool) {
+	if doc.resolvingLength {
+		return 0, false
+	}
+	doc.resolvingLength = true
+	defer func() { doc.resolvingLength = false }()
+	obj, err := doc.Resolve(ref)
+	if err != nil {
+		return 0, false
+	}
+	length, ok := obj.(Int)
+	return int64(length), ok
+}
+
+// Parse a page content stream into drawing commands.
+// Offsets in errors are relative to the start of buf.
+func ParseContent(buf []byte) ([]Command, error) {
+	cp := &ContentParser{}
+
+	if err := parse(NewTokenizer(bytes.NewReader(buf)), cp); err != nil {
+		return nil, err
+	}
+
+	return cp.Commands, nil
+}
+
+// Refs can point at other refs, but not forever.
+const maxRefChain = 32
+
+// Follow references until reaching a direct object.
+// Missing objects and missing dictionary entries are null, as the spec says.
+func (doc *Document) Resolve(obj Object) (Object, error) {
+	obj, _, err := doc.resolve(obj)
+	return obj, err
+}
+
+// Like Resolve, but also returns the number of the last object
+// that was looked up, for errors.
+func (doc *Document) resolve(obj Object) (Object, int64, error) {
+	var num int64
+	for i := 0; i < maxRefChain; i++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			if obj == nil {
+				obj = Null{}
+			}
+			return obj, num, nil
+		}
+		num = ref.Num
+		var err error
+		if obj, err = doc.Object(ref); err != nil {
+			return nil, num, err
+		}
+	}
+	return nil, num, errorf(-1, num, "Reference chain too long")
+}
+
+// Resolve an object that must be a dictionary.
+func (doc *Document) ResolveDict(obj Object) (Dict, error) {
+	resolved, num, err := doc.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := resolved.(Dict)
+	if !ok {
+		if stream, isStream := resolved.(*Stream); isStream {
+			return stream.Attrs, nil
+		}
+		return nil, errorf(-1, num, "Expected a dictionary, got %T", resolved)
+	}
+	return dict, nil
+}
+
+// Resolve an object that must be an array.
+func (doc *Document) ResolveArray(obj Object) (Array, error) {
+	resolved, num, err := doc.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := resolved.(Array)
+	if !ok {
+		return nil, errorf(-1, num, "Expected an array, got %T", resolved)
+	}
+	return array, nil
+}
+
+// Resolve an object that must be a stream.
+func (doc *Document) ResolveStream(obj Object) (*Stream, error) {
+	resolved, num, err := doc.resolve(obj)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := resolved.(*Stream)
+	if !ok {
+		return nil, errorf(-1, num, "Expected a stream, got %T", resolved)
+	}
+	return stream, nil
+}
+
+// The document catalog. Every trailer should have one,
+// but if the latest doesn't, use the newest one that does.
+func (doc *Document) Catalog() (Dict, error) {
+	for i := len(doc.Revisions) - 1; i >= 0; i-- {
+		if root, hasRoot := doc.Revisions[i].Trailer["Root"]; hasRoot {
+			return doc.ResolveDict(root)
+		}
+	}
+	return nil, errorf(-1, 0, "No trailer has a document catalog")
+}
+
+// Every page in the document, in order.
+func (doc *Document) Pages() ([]Dict, error) {
+	catalog, err := doc.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	pages := []Dict{}
+	seen := map[Ref]bool{}
+	err = doc.findPages(catalog["Pages"], seen, &pages)
+	return pages, err
+}
+
+// Walk the page tree. seen guards against Kids that loop back on themselves.
+func (doc *Document) findPages(nodeObj Object, seen map[Ref]bool, pages *[]Dict) error {
+	if ref, ok := nodeObj.(Ref); ok {
+		if seen[ref] {
+			return errorf(-1, ref.Num, "Page tree loops back to %s", ref)
+		}
+		seen[ref] = true
+	}
+	node, err := doc.ResolveDict(nodeObj)
+	if err != nil {
+		return err
+	}
+	if nodeType, _ := node["Type"].(Name); nodeType == "Page" {
+		*pages = append(*pages, node)
+		return nil
+	}
+
+	kids, err := doc.ResolveArray(node["Kids"])
+	if err != nil {
+		return err
+	}
+	for _, kid := range kids {
+		if err := doc.findPages(kid, seen, pages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pages can inherit some attributes, such as Resources, from their ancestors in the page tree.
+// Attributes nothing has are null.
+func (doc *Document) PageAttr(page Dict, key string) (Object, error) {
+	node := page
+	for depth := 0; depth < maxPageDepth; depth++ {
+		if value, ok := node[key]; ok {
+			return value, nil
+		}
+		parent, ok := node["Parent"]
+		if !ok {
+			break
+		}
+		var err error
+		if node, err = doc.ResolveDict(parent); err != nil {
+			return nil, err
+		}
+	}
+	return Null{}, nil
+}
+
+// Page trees aren't that deep, but Parent links could loop.
+const maxPageDepth = 64
+
+// A page's content streams, decoded and joined.
+// The spec allows a page's contents to be split anywhere between tokens,
+// so streams are separated by whitespace.
+func (doc *Document) PageContents(page Dict) ([]byte, error) {
+	contentsObj, err := doc.Resolve(page["Contents"])
+	if err != nil {
+		return nil, err
+	}
+
+	var streams Array
+	switch contents := contentsObj.(type) {
+	case Null:
+		// a blank page
+		return nil, nil
+	case *Stream:
+		streams = Array{contents}
+	case Array:
+		streams = contents
+	default:
+		return nil, errorf(-1, 0, "Page: illegal contents: %T %v", contents, contents)
+	}
+
+	var buf bytes.Buffer
+	for _, streamObj := range streams {
+		stream, err := doc.ResolveStream(streamObj)
+		if err != nil {
+			return nil, err
+		}
+		contents, err := stream.Decode()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(contents)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
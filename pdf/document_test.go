@@ -0,0 +1,88 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// Build a PDF with a classic xref table from object bodies numbered from 1.
+func buildPDF(objects ...string) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.4\n")
+	offsets := []int{}
+	for i, obj := range objects {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestParse_Pages(t *testing.T) {
+	content := "BT /F1 12 Tf (Hello) Tj ET"
+	doc, err := Parse(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("Expected 1 page, got %d", len(pages))
+	}
+	contents, err := doc.PageContents(pages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands, err := ParseContent(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := []string{}
+	for _, command := range commands {
+		words = append(words, command.Word)
+	}
+	if fmt.Sprint(words) != "[BT Tf Tj ET]" {
+		t.Errorf("Expected BT Tf Tj ET, got %v", words)
+	}
+	if text := commands[2].Operands[0]; text != String("Hello") {
+		t.Errorf("Expected Tj operand %q, got %v", "Hello", text)
+	}
+}
+
+// Errors say which object went wrong, and where
+func TestParse_ErrorLocation(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Kids [1 0 R >>",
+	)
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// objects aren't read until they're needed
+	_, err = doc.Pages()
+	pdfErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("Expected *Error, got %v", err)
+	}
+	if pdfErr.Object != 2 {
+		t.Errorf("Expected object 2, got %d", pdfErr.Object)
+	}
+	expected := int64(bytes.Index(buf, []byte(">>\nendobj\nxref")))
+	if pdfErr.Offset != expected {
+		t.Errorf("Expected offset %d, got %d", expected, pdfErr.Offset)
+	}
+}
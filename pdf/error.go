@@ -0,0 +1,34 @@
+package pdf
+
+import (
+	"fmt"
+)
+
+// A problem with a PDF file, and where it was found.
+type Error struct {
+	// Byte offset in the file, or -1 if unknown.
+	Offset int64
+	// Number of the object being read, or 0 if not inside an object.
+	Object int64
+	Err    error
+}
+
+func (err *Error) Error() string {
+	switch {
+	case err.Object != 0 && err.Offset >= 0:
+		return fmt.Sprintf("pdf: object %d at offset %d: %v", err.Object, err.Offset, err.Err)
+	case err.Object != 0:
+		return fmt.Sprintf("pdf: object %d: %v", err.Object, err.Err)
+	case err.Offset >= 0:
+		return fmt.Sprintf("pdf: offset %d: %v", err.Offset, err.Err)
+	}
+	return fmt.Sprintf("pdf: %v", err.Err)
+}
+
+func errorf(offset int64, object int64, format string, args ...interface{}) *Error {
+	return &Error{
+		Offset: offset,
+		Object: object,
+		Err:    fmt.Errorf(format, args...),
+	}
+}
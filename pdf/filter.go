@@ -0,0 +1,124 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Decoders for the filters that the standard library doesn't have.
+// Each takes all of its input at once, since stream data is in memory anyway.
+// Errors are wrapped with the filter name by Stream.Decode.
+
+// LZW as in TIFF, with most significant bits first, 9 to 12 bit codes,
+// and code 256 to clear the table and 257 to end the data.
+// With earlyChange 1, the default, codes get wider one code early.
+func lzwDecode(data []byte, earlyChange int) ([]byte, error) {
+	const clear, eod, first = 256, 257, 258
+	table := make([][]byte, first, 4096)
+	for i := 0; i < clear; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	out := []byte{}
+	width := 9
+	var prev []byte
+	var bits uint32
+	nbits := 0
+	for pos := 0; ; {
+		for nbits < width {
+			if pos >= len(data) {
+				// plenty of files leave out the EOD code
+				return out, nil
+			}
+			bits = bits<<8 | uint32(data[pos])
+			pos++
+			nbits += 8
+		}
+		nbits -= width
+		code := int(bits>>uint(nbits)) & (1<<uint(width) - 1)
+
+		if code == clear {
+			table = table[:first]
+			width = 9
+			prev = nil
+			continue
+		}
+		if code == eod {
+			return out, nil
+		}
+		var entry []byte
+		switch {
+		case code < len(table) && table[code] != nil:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			// the entry this code is about to add
+			entry = append(prev[:len(prev):len(prev)], prev[0])
+		default:
+			return nil, fmt.Errorf("Bad code %d", code)
+		}
+		out = append(out, entry...)
+		if prev != nil && len(table) < cap(table) {
+			table = append(table, append(prev[:len(prev):len(prev)], entry[0]))
+		}
+		prev = entry
+		if len(table)+earlyChange >= 1<<uint(width) && width < 12 {
+			width++
+		}
+	}
+}
+
+// Runs of up to 128 literal bytes, each preceded by its length minus 1,
+// and up to 128 repeats of a byte, preceded by 257 minus the count.
+// A length byte of 128 ends the data.
+func runLengthDecode(data []byte) ([]byte, error) {
+	out := []byte{}
+	for pos := 0; pos < len(data); {
+		n := int(data[pos])
+		pos++
+		switch {
+		case n < 128:
+			if pos+n+1 > len(data) {
+				return nil, fmt.Errorf("Run of %d bytes goes past the end of the data", n+1)
+			}
+			out = append(out, data[pos:pos+n+1]...)
+			pos += n + 1
+		case n > 128:
+			if pos >= len(data) {
+				return nil, fmt.Errorf("Repeat goes past the end of the data")
+			}
+			out = append(out, bytes.Repeat(data[pos:pos+1], 257-n)...)
+			pos++
+		default:
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// Pairs of hex digits, with whitespace ignored and > ending the data.
+// A missing final digit is 0.
+func asciiHexDecode(data []byte) ([]byte, error) {
+	digits := []byte{}
+	for _, c := range data {
+		switch {
+		case isHexDigit(c):
+			digits = append(digits, c)
+		case isWhitespace(c):
+		case c == '>':
+			return decodeHex(digits), nil
+		default:
+			return nil, fmt.Errorf("Unexpected %q", c)
+		}
+	}
+	return decodeHex(digits), nil
+}
+
+// The standard library's decoder doesn't know the <~ and ~> delimiters,
+// and PDF only uses the second one.
+func trimASCII85(data []byte) []byte {
+	data = bytes.TrimLeft(data, "\x00\t\n\f\r ")
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end >= 0 {
+		data = data[:end]
+	}
+	return data
+}
@@ -0,0 +1,134 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/lzw"
+	"encoding/hex"
+	"testing"
+)
+
+func newStream(attrs Dict, raw []byte) *Stream {
+	return &Stream{Attrs: attrs, Raw: raw, doc: newDocument()}
+}
+
+func lzwEncode(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := lzw.NewWriter(buf, lzw.MSB, 8)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+func unhex(s string) []byte {
+	buf, _ := hex.DecodeString(s)
+	return buf
+}
+
+// enough different pairs of bytes to need 10-bit LZW codes
+var lzwLong = func() []byte {
+	buf := []byte{}
+	for i := 0; i < 2000; i++ {
+		buf = append(buf, byte(i), byte(i*7), byte(i/3))
+	}
+	return buf
+}()
+
+var filterTests = []struct {
+	name     string
+	attrs    Dict
+	raw      []byte
+	expected []byte
+}{
+	{"none", Dict{}, []byte("plain"), []byte("plain")},
+	{"ASCIIHex", Dict{"Filter": Name("ASCIIHexDecode")}, []byte("48 65 6c\n6C 6f>"), []byte("Hello")},
+	{"ASCIIHex odd", Dict{"Filter": Name("AHx")}, []byte("7>"), []byte("p")},
+	{"ASCII85", Dict{"Filter": Name("ASCII85Decode")}, []byte("87cURD]i,\"Ebo80~>"), []byte("Hello World!")},
+	{"ASCII85 z", Dict{"Filter": Name("ASCII85Decode")}, []byte("z~>"), []byte{0, 0, 0, 0}},
+	{"RunLength", Dict{"Filter": Name("RunLengthDecode")}, []byte("\x02abc\xfdx\x00y\x80ignored"), []byte("abcxxxxy")},
+	{"LZW spec example", Dict{"Filter": Name("LZWDecode")}, unhex("800B6050220C0C8501"), []byte("-----A---B")},
+	{"LZW early change off", Dict{"Filter": Name("LZWDecode"), "DecodeParms": Dict{"EarlyChange": Int(0)}},
+		lzwEncode(lzwLong), lzwLong},
+	{"LZW with TIFF predictor", Dict{"Filter": Name("LZWDecode"),
+		"DecodeParms": Dict{"EarlyChange": Int(0), "Predictor": Int(2), "Colors": Int(2), "Columns": Int(3)}},
+		lzwEncode([]byte{1, 2, 1, 1, 1, 1, 5, 5, 0xff, 0, 0, 0}), []byte{1, 2, 2, 3, 3, 4, 5, 5, 4, 5, 4, 5}},
+	{"TIFF predictor 4 bits", Dict{"Filter": Name("FlateDecode"),
+		"DecodeParms": Dict{"Predictor": Int(2), "BitsPerComponent": Int(4), "Columns": Int(3)}},
+		deflate([]byte{0x31, 0xf0}), []byte{0x34, 0x30}},
+	{"TIFF predictor 16 bits", Dict{"Filter": Name("FlateDecode"),
+		"DecodeParms": Dict{"Predictor": Int(2), "BitsPerComponent": Int(16), "Columns": Int(2)}},
+		deflate([]byte{0x01, 0xff, 0x00, 0x02}), []byte{0x01, 0xff, 0x02, 0x01}},
+	{"filter array", Dict{"Filter": Array{Name("ASCIIHexDecode"), Name("FlateDecode")},
+		"DecodeParms": Array{Null{}, Dict{"Predictor": Int(12), "Columns": Int(2)}}},
+		[]byte(hex.EncodeToString(deflate([]byte{2, 1, 2, 2, 1, 1}))), []byte{1, 2, 2, 3}},
+	{"Crypt identity", Dict{"Filter": Array{Name("Crypt"), Name("AHx")}, "DecodeParms": Array{Dict{"Name": Name("Identity")}}},
+		[]byte("41>"), []byte("A")},
+	{"image passes through", Dict{"Filter": Array{Name("ASCIIHexDecode"), Name("DCTDecode")}},
+		[]byte("ffd8>"), []byte{0xff, 0xd8}},
+}
+
+func TestStream_Filters(t *testing.T) {
+	for _, test := range filterTests {
+		data, err := newStream(test.attrs, test.raw).Decode()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(data, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, data)
+		}
+	}
+}
+
+func TestStream_FilterErrors(t *testing.T) {
+	for _, attrs := range []Dict{
+		{"Filter": Name("NoSuchDecode")},
+		{"Filter": Name("Crypt"), "DecodeParms": Dict{"Name": Name("StdCF")}},
+		{"Filter": Array{Name("DCTDecode"), Name("FlateDecode")}},
+		{"Filter": Name("FlateDecode"), "DecodeParms": Dict{"Predictor": Int(3)}},
+	} {
+		if data, err := newStream(attrs, []byte("data")).Decode(); err == nil {
+			t.Errorf("%v: expected an error, got %q", attrs, data)
+		}
+	}
+}
+
+// Image filters are left for the caller, with their parameters
+func TestStream_ImageFilterParms(t *testing.T) {
+	stream := newStream(Dict{
+		"Filter":      Array{Name("FlateDecode"), Name("CCF")},
+		"DecodeParms": Array{Null{}, Dict{"K": Int(-1), "Columns": Int(1728)}},
+	}, nil)
+	filters, err := stream.Filters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 2 || len(filters[0].Parms) != 0 {
+		t.Fatalf("Expected Flate without parameters and CCITT, got %v", filters)
+	}
+	last := filters[1]
+	if last.Name != "CCITTFaxDecode" || !ImageFilters[last.Name] || last.Parms["K"] != Int(-1) {
+		t.Errorf("Expected CCITTFaxDecode with K -1, got %v", last)
+	}
+}
+
+// Predictor parameters that would overflow or allocate huge rows are errors, not panics
+func TestStream_PredictorErrors(t *testing.T) {
+	for _, parms := range []Dict{
+		{"Predictor": Int(12), "Colors": Int(4), "Columns": Int(1 << 58)},
+		{"Predictor": Int(2), "Colors": Int(4), "Columns": Int(1 << 58)},
+		{"Predictor": Int(12), "Columns": Int(1 << 62), "BitsPerComponent": Int(16)},
+		{"Predictor": Int(12), "Columns": Int(6)},
+		{"Predictor": Int(12), "Colors": Int(33)},
+		{"Predictor": Int(12), "Colors": Int(1 << 60)},
+		{"Predictor": Int(12), "Colors": Int(0)},
+		{"Predictor": Int(12), "Columns": Int(0)},
+		{"Predictor": Int(12), "BitsPerComponent": Int(3)},
+		{"Predictor": Int(12), "BitsPerComponent": Int(32)},
+		{"Predictor": Int(2), "BitsPerComponent": Int(12)},
+	} {
+		attrs := Dict{"Filter": Name("FlateDecode"), "DecodeParms": parms}
+		if data, err := newStream(attrs, deflate([]byte{0, 1, 2, 3, 4})).Decode(); err == nil {
+			t.Errorf("%v: expected an error, got %q", parms, data)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// What text extraction needs from a font: how shown strings split into codes,
+// what text each code stands for, and how far each glyph moves the text position.
+type font struct {
+	// splits strings into codes and maps them to CIDs; nil for simple fonts, whose codes are single bytes
+	encoding *cmap
+	// text for codes, which beats everything else; nil if the font doesn't have one
+	toUnicode *cmap
+	// text for each code of a simple font, from its encoding
+	simple [256]string
+	// the codes of a CID font are already UTF-16, as with the UniJIS-UCS2-H CMap
+	unicodeCodes bool
+	// glyph widths in thousandths of a text space unit,
+	// by code for simple fonts and by CID for CID fonts
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+// One glyph from a shown string.
+type glyph struct {
+	text string
+	// in thousandths of a text space unit
+	width float64
+	// single-byte code 32, which word spacing applies to
+	wordSpace bool
+}
+
+// A font for when a page doesn't set one, or its font can't be read.
+func fallbackFont() *font {
+	f := &font{
+		widths:       map[int]float64{},
+		defaultWidth: 500,
+	}
+	f.setEncoding(&standardEncoding)
+	return f
+}
+
+func (f *font) setEncoding(encoding *[256]rune) {
+	for code, r := range encoding {
+		if r != 0 {
+			f.simple[code] = string(r)
+		} else {
+			f.simple[code] = ""
+		}
+	}
+}
+
+// Split a shown string into glyphs.
+func (f *font) glyphs(s []byte) []glyph {
+	glyphs := []glyph{}
+	for len(s) > 0 {
+		code, n := uint32(s[0]), 1
+		widthKey := int(code)
+		if f.encoding != nil {
+			code, n = f.encoding.next(s)
+			widthKey = f.encoding.cid(code)
+		}
+		g := glyph{wordSpace: n == 1 && code == 32}
+		text, ok := "", false
+		if f.toUnicode != nil {
+			text, ok = f.toUnicode.unicode[code]
+		}
+		switch {
+		case ok:
+			g.text = text
+		case f.encoding == nil:
+			g.text = f.simple[code]
+		case f.unicodeCodes:
+			g.text = string(rune(code))
+		default:
+			// a CID font without a ToUnicode; its glyphs could be anything
+			g.text = "\ufffd"
+		}
+		if width, ok := f.widths[widthKey]; ok {
+			g.width = width
+		} else {
+			g.width = f.defaultWidth
+		}
+		glyphs = append(glyphs, g)
+		s = s[n:]
+	}
+	return glyphs
+}
+
+// The text for a glyph name: a name from the glyph list, uniXXXX, or uXXXX to uXXXXXX.
+// Suffixes like .sc are variants of the same character,
+// and names like f_f_i are ligatures of several.
+func glyphText(name string) (string, bool) {
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" {
+		return "", false
+	}
+	text := ""
+	for _, part := range strings.Split(name, "_") {
+		if r, ok := glyphNames[part]; ok {
+			text += string(r)
+			continue
+		}
+		if strings.HasPrefix(part, "uni") && len(part) >= 7 && (len(part)-3)%4 == 0 {
+			for i := 3; i < len(part); i += 4 {
+				value, err := strconv.ParseUint(part[i:i+4], 16, 32)
+				if err != nil {
+					return "", false
+				}
+				text += string(rune(value))
+			}
+			continue
+		}
+		if strings.HasPrefix(part, "u") && len(part) >= 5 && len(part) <= 7 {
+			if value, err := strconv.ParseUint(part[1:], 16, 32); err == nil {
+				text += string(rune(value))
+				continue
+			}
+		}
+		return "", false
+	}
+	return text, true
+}
+
+// The encodings a simple font can name.
+func namedEncoding(name Name) (*[256]rune, bool) {
+	switch name {
+	case "StandardEncoding":
+		return &standardEncoding, true
+	case "WinAnsiEncoding":
+		return &winAnsiEncoding, true
+	case "MacRomanEncoding":
+		return &macRomanEncoding, true
+	}
+	return nil, false
+}
+
+// A number, following references.
+func (doc *Document) resolveNumber(obj Object) (float64, bool) {
+	resolved, err := doc.Resolve(obj)
+	if err != nil {
+		return 0, false
+	}
+	return number(resolved)
+}
+
+// A font dictionary, read into what text extraction needs.
+// Fonts are cached, since pages tend to share them.
+func (doc *Document) font(obj Object) (*font, error) {
+	ref, isRef := obj.(Ref)
+	if isRef {
+		if f, ok := doc.fonts[ref]; ok {
+			return f, nil
+		}
+	}
+	dict, err := doc.ResolveDict(obj)
+	if err != nil {
+		return nil, err
+	}
+	f := &font{
+		widths: map[int]float64{},
+	}
+	if subtype, _ := dict["Subtype"].(Name); subtype == "Type0" {
+		err = doc.loadCIDFont(f, dict)
+	} else {
+		err = doc.loadSimpleFont(f, dict, subtype)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Some files have /Identity-H here, which doesn't mean anything.
+	if toUnicode, err := doc.Resolve(dict["ToUnicode"]); err != nil {
+		return nil, err
+	} else if stream, ok := toUnicode.(*Stream); ok {
+		data, err := stream.Decode()
+		if err == nil {
+			f.toUnicode, err = parseCMap(data)
+		}
+		if err != nil {
+			// the encoding will have to do
+			doc.Warnings = append(doc.Warnings, err)
+		}
+	}
+
+	if isRef {
+		if doc.fonts == nil {
+			doc.fonts = map[Ref]*font{}
+		}
+		doc.fonts[ref] = f
+	}
+	return f, nil
+}
+
+// Type 1, TrueType, and Type 3 fonts, which have one-byte codes
+// and an encoding that maps them to glyph names.
+func (doc *Document) loadSimpleFont(f *font, dict Dict, subtype Name) error {
+	encoding := &standardEncoding
+	var differences Array
+	encodingObj, err := doc.Resolve(dict["Encoding"])
+	if err != nil {
+		return err
+	}
+	switch encodingObj := encodingObj.(type) {
+	case Name:
+		if named, ok := namedEncoding(encodingObj); ok {
+			encoding = named
+		}
+	case Dict:
+		if base, ok := encodingObj["BaseEncoding"].(Name); ok {
+			if named, ok := namedEncoding(base); ok {
+				encoding = named
+			}
+		}
+		if _, ok := encodingObj["Differences"]; ok {
+			if differences, err = doc.ResolveArray(encodingObj["Differences"]); err != nil {
+				return err
+			}
+		}
+	}
+	f.setEncoding(encoding)
+	// a code, then names for it and the codes after it
+	code := 0
+	for _, elem := range differences {
+		switch elem := elem.(type) {
+		case Int:
+			code = int(elem)
+		case Name:
+			if code >= 0 && code < len(f.simple) {
+				// a name that isn't in the glyph list could be anything
+				f.simple[code], _ = glyphText(string(elem))
+			}
+			code++
+		}
+	}
+
+	// Type 3 glyphs are measured in their own units
+	scale := 1.0
+	if subtype == "Type3" {
+		if matrix, err := doc.ResolveArray(dict["FontMatrix"]); err == nil && len(matrix) > 0 {
+			if m, ok := doc.resolveNumber(matrix[0]); ok {
+				scale = m * 1000
+			}
+		}
+	}
+	if _, ok := dict["Widths"]; ok {
+		widths, err := doc.ResolveArray(dict["Widths"])
+		if err != nil {
+			return err
+		}
+		first, _ := doc.resolveNumber(dict["FirstChar"])
+		for i, w := range widths {
+			if width, ok := doc.resolveNumber(w); ok {
+				f.widths[int(first)+i] = width * scale
+			}
+		}
+		if descriptor, err := doc.Resolve(dict["FontDescriptor"]); err == nil {
+			if descriptor, ok := descriptor.(Dict); ok {
+				f.defaultWidth, _ = doc.resolveNumber(descriptor["MissingWidth"])
+			}
+		}
+	} else {
+		// The standard 14 fonts don't need widths. Only Courier has the same width for every glyph,
+		// but an average is good enough for finding spaces.
+		f.defaultWidth = 500
+		if baseFont, _ := dict["BaseFont"].(Name); strings.Contains(string(baseFont), "Courier") {
+			f.defaultWidth = 600
+		}
+	}
+	return nil
+}
+
+// Type 0 fonts, whose encoding is a CMap that maps codes to CIDs,
+// and whose descendant CID font has the widths.
+func (doc *Document) loadCIDFont(f *font, dict Dict) error {
+	encodingObj, err := doc.Resolve(dict["Encoding"])
+	if err != nil {
+		return err
+	}
+	switch encodingObj := encodingObj.(type) {
+	case *Stream:
+		data, err := encodingObj.Decode()
+		if err != nil {
+			return err
+		}
+		if f.encoding, err = parseCMap(data); err != nil {
+			return err
+		}
+	case Name:
+		// Predefined CMaps other than Identity-H and Identity-V need data we don't have,
+		// but they all have 2-byte codes for most characters.
+		f.encoding = identityCMap()
+		f.unicodeCodes = strings.Contains(string(encodingObj), "UCS2") || strings.Contains(string(encodingObj), "UTF16")
+	default:
+		f.encoding = identityCMap()
+	}
+
+	f.defaultWidth = 1000
+	descendants, err := doc.ResolveArray(dict["DescendantFonts"])
+	if err != nil || len(descendants) == 0 {
+		return err
+	}
+	cidFont, err := doc.ResolveDict(descendants[0])
+	if err != nil {
+		return err
+	}
+	if dw, ok := doc.resolveNumber(cidFont["DW"]); ok {
+		f.defaultWidth = dw
+	}
+	if _, ok := cidFont["W"]; !ok {
+		return nil
+	}
+	w, err := doc.ResolveArray(cidFont["W"])
+	if err != nil {
+		return err
+	}
+	// c [w1 w2 ...] gives widths from c on, and c1 c2 w gives the same width from c1 to c2
+	entries := 0
+	for i := 0; i+1 < len(w); {
+		first, ok := doc.resolveNumber(w[i])
+		if !ok {
+			break
+		}
+		if widths, err := doc.Resolve(w[i+1]); err == nil {
+			if widths, ok := widths.(Array); ok {
+				for j, width := range widths {
+					if width, ok := doc.resolveNumber(width); ok {
+						f.widths[int(first)+j] = width
+					}
+				}
+				i += 2
+				continue
+			}
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last, lastOk := doc.resolveNumber(w[i+1])
+		width, widthOk := doc.resolveNumber(w[i+2])
+		if !lastOk || !widthOk || last-first > maxCMapRange {
+			break
+		}
+		if last >= first {
+			if entries += int(last-first) + 1; entries > maxCMapEntries {
+				break
+			}
+		}
+		for cid := int(first); cid <= int(last); cid++ {
+			f.widths[cid] = width
+		}
+		i += 3
+	}
+	return nil
+}
@@ -0,0 +1,474 @@
+package pdf
+
+// Glyph names from the Adobe Glyph List that are in the standard encodings,
+// plus common ligatures, accented letters, and symbols.
+// Names like uni20AC and u1F600 are handled by glyphText.
+var glyphNames = map[string]rune{
+	"A":              0x0041,
+	"a":              0x0061,
+	"Aacute":         0x00c1,
+	"aacute":         0x00e1,
+	"Acircumflex":    0x00c2,
+	"acircumflex":    0x00e2,
+	"acute":          0x00b4,
+	"Adieresis":      0x00c4,
+	"adieresis":      0x00e4,
+	"AE":             0x00c6,
+	"ae":             0x00e6,
+	"Agrave":         0x00c0,
+	"agrave":         0x00e0,
+	"alpha":          0x03b1,
+	"Amacron":        0x0100,
+	"amacron":        0x0101,
+	"ampersand":      0x0026,
+	"angleleft":      0x2329,
+	"angleright":     0x232a,
+	"Aogonek":        0x0104,
+	"aogonek":        0x0105,
+	"apple":          0xf8ff,
+	"approxequal":    0x2248,
+	"Aring":          0x00c5,
+	"aring":          0x00e5,
+	"arrowboth":      0x2194,
+	"arrowdown":      0x2193,
+	"arrowleft":      0x2190,
+	"arrowright":     0x2192,
+	"arrowup":        0x2191,
+	"asciicircum":    0x005e,
+	"asciitilde":     0x007e,
+	"asterisk":       0x002a,
+	"asteriskmath":   0x2217,
+	"at":             0x0040,
+	"Atilde":         0x00c3,
+	"atilde":         0x00e3,
+	"B":              0x0042,
+	"b":              0x0062,
+	"backslash":      0x005c,
+	"bar":            0x007c,
+	"beta":           0x03b2,
+	"braceleft":      0x007b,
+	"braceright":     0x007d,
+	"bracketleft":    0x005b,
+	"bracketright":   0x005d,
+	"breve":          0x02d8,
+	"brokenbar":      0x00a6,
+	"bullet":         0x2022,
+	"C":              0x0043,
+	"c":              0x0063,
+	"Cacute":         0x0106,
+	"cacute":         0x0107,
+	"caron":          0x02c7,
+	"Ccaron":         0x010c,
+	"ccaron":         0x010d,
+	"Ccedilla":       0x00c7,
+	"ccedilla":       0x00e7,
+	"cedilla":        0x00b8,
+	"cent":           0x00a2,
+	"checkmark":      0x2713,
+	"chi":            0x03c7,
+	"circumflex":     0x02c6,
+	"club":           0x2663,
+	"colon":          0x003a,
+	"comma":          0x002c,
+	"copyright":      0x00a9,
+	"currency":       0x00a4,
+	"D":              0x0044,
+	"d":              0x0064,
+	"dagger":         0x2020,
+	"daggerdbl":      0x2021,
+	"Dcaron":         0x010e,
+	"dcaron":         0x010f,
+	"Dcroat":         0x0110,
+	"dcroat":         0x0111,
+	"degree":         0x00b0,
+	"Delta":          0x2206,
+	"delta":          0x03b4,
+	"diamond":        0x2666,
+	"dieresis":       0x00a8,
+	"divide":         0x00f7,
+	"dollar":         0x0024,
+	"dotaccent":      0x02d9,
+	"dotlessi":       0x0131,
+	"dotlessj":       0x0237,
+	"dotmath":        0x22c5,
+	"E":              0x0045,
+	"e":              0x0065,
+	"Eacute":         0x00c9,
+	"eacute":         0x00e9,
+	"Ecaron":         0x011a,
+	"ecaron":         0x011b,
+	"Ecircumflex":    0x00ca,
+	"ecircumflex":    0x00ea,
+	"Edieresis":      0x00cb,
+	"edieresis":      0x00eb,
+	"Egrave":         0x00c8,
+	"egrave":         0x00e8,
+	"eight":          0x0038,
+	"element":        0x2208,
+	"ellipsis":       0x2026,
+	"Emacron":        0x0112,
+	"emacron":        0x0113,
+	"emdash":         0x2014,
+	"emptyset":       0x2205,
+	"endash":         0x2013,
+	"Eogonek":        0x0118,
+	"eogonek":        0x0119,
+	"epsilon":        0x03b5,
+	"equal":          0x003d,
+	"equivalence":    0x2261,
+	"eta":            0x03b7,
+	"Eth":            0x00d0,
+	"eth":            0x00f0,
+	"Euro":           0x20ac,
+	"exclam":         0x0021,
+	"exclamdown":     0x00a1,
+	"existential":    0x2203,
+	"F":              0x0046,
+	"f":              0x0066,
+	"ff":             0xfb00,
+	"ffi":            0xfb03,
+	"ffl":            0xfb04,
+	"fi":             0xfb01,
+	"five":           0x0035,
+	"fl":             0xfb02,
+	"florin":         0x0192,
+	"four":           0x0034,
+	"fraction":       0x2044,
+	"G":              0x0047,
+	"g":              0x0067,
+	"Gamma":          0x0393,
+	"gamma":          0x03b3,
+	"Gbreve":         0x011e,
+	"gbreve":         0x011f,
+	"germandbls":     0x00df,
+	"grave":          0x0060,
+	"greater":        0x003e,
+	"greaterequal":   0x2265,
+	"guillemotleft":  0x00ab,
+	"guillemotright": 0x00bb,
+	"guilsinglleft":  0x2039,
+	"guilsinglright": 0x203a,
+	"H":              0x0048,
+	"h":              0x0068,
+	"heart":          0x2665,
+	"hungarumlaut":   0x02dd,
+	"hyphen":         0x002d,
+	"I":              0x0049,
+	"i":              0x0069,
+	"Iacute":         0x00cd,
+	"iacute":         0x00ed,
+	"Icircumflex":    0x00ce,
+	"icircumflex":    0x00ee,
+	"Idieresis":      0x00cf,
+	"idieresis":      0x00ef,
+	"Idotaccent":     0x0130,
+	"Igrave":         0x00cc,
+	"igrave":         0x00ec,
+	"Imacron":        0x012a,
+	"imacron":        0x012b,
+	"infinity":       0x221e,
+	"integral":       0x222b,
+	"intersection":   0x2229,
+	"iota":           0x03b9,
+	"J":              0x004a,
+	"j":              0x006a,
+	"K":              0x004b,
+	"k":              0x006b,
+	"kappa":          0x03ba,
+	"L":              0x004c,
+	"l":              0x006c,
+	"Lambda":         0x039b,
+	"lambda":         0x03bb,
+	"Lcaron":         0x013d,
+	"lcaron":         0x013e,
+	"less":           0x003c,
+	"lessequal":      0x2264,
+	"logicalnot":     0x00ac,
+	"lozenge":        0x25ca,
+	"Lslash":         0x0141,
+	"lslash":         0x0142,
+	"M":              0x004d,
+	"m":              0x006d,
+	"macron":         0x00af,
+	"minus":          0x2212,
+	"minute":         0x2032,
+	"mu":             0x00b5,
+	"multiply":       0x00d7,
+	"N":              0x004e,
+	"n":              0x006e,
+	"nabla":          0x2207,
+	"Nacute":         0x0143,
+	"nacute":         0x0144,
+	"napostrophe":    0x0149,
+	"nbspace":        0x00a0,
+	"Ncaron":         0x0147,
+	"ncaron":         0x0148,
+	"nine":           0x0039,
+	"notequal":       0x2260,
+	"Ntilde":         0x00d1,
+	"ntilde":         0x00f1,
+	"nu":             0x03bd,
+	"numbersign":     0x0023,
+	"O":              0x004f,
+	"o":              0x006f,
+	"Oacute":         0x00d3,
+	"oacute":         0x00f3,
+	"Ocircumflex":    0x00d4,
+	"ocircumflex":    0x00f4,
+	"Odieresis":      0x00d6,
+	"odieresis":      0x00f6,
+	"OE":             0x0152,
+	"oe":             0x0153,
+	"ogonek":         0x02db,
+	"Ograve":         0x00d2,
+	"ograve":         0x00f2,
+	"Ohungarumlaut":  0x0150,
+	"ohungarumlaut":  0x0151,
+	"Omacron":        0x014c,
+	"omacron":        0x014d,
+	"Omega":          0x03a9,
+	"omega":          0x03c9,
+	"omicron":        0x03bf,
+	"one":            0x0031,
+	"onehalf":        0x00bd,
+	"onequarter":     0x00bc,
+	"onesuperior":    0x00b9,
+	"ordfeminine":    0x00aa,
+	"ordmasculine":   0x00ba,
+	"Oslash":         0x00d8,
+	"oslash":         0x00f8,
+	"Otilde":         0x00d5,
+	"otilde":         0x00f5,
+	"P":              0x0050,
+	"p":              0x0070,
+	"paragraph":      0x00b6,
+	"parenleft":      0x0028,
+	"parenright":     0x0029,
+	"partialdiff":    0x2202,
+	"percent":        0x0025,
+	"period":         0x002e,
+	"periodcentered": 0x00b7,
+	"perthousand":    0x2030,
+	"Phi":            0x03a6,
+	"phi":            0x03c6,
+	"Pi":             0x03a0,
+	"pi":             0x03c0,
+	"plus":           0x002b,
+	"plusminus":      0x00b1,
+	"product":        0x220f,
+	"proportional":   0x221d,
+	"Psi":            0x03a8,
+	"psi":            0x03c8,
+	"Q":              0x0051,
+	"q":              0x0071,
+	"question":       0x003f,
+	"questiondown":   0x00bf,
+	"quotedbl":       0x0022,
+	"quotedblbase":   0x201e,
+	"quotedblleft":   0x201c,
+	"quotedblright":  0x201d,
+	"quoteleft":      0x2018,
+	"quoteright":     0x2019,
+	"quotesinglbase": 0x201a,
+	"quotesingle":    0x0027,
+	"R":              0x0052,
+	"r":              0x0072,
+	"radical":        0x221a,
+	"Rcaron":         0x0158,
+	"rcaron":         0x0159,
+	"registered":     0x00ae,
+	"rho":            0x03c1,
+	"ring":           0x02da,
+	"S":              0x0053,
+	"s":              0x0073,
+	"Sacute":         0x015a,
+	"sacute":         0x015b,
+	"Scaron":         0x0160,
+	"scaron":         0x0161,
+	"Scedilla":       0x015e,
+	"scedilla":       0x015f,
+	"second":         0x2033,
+	"section":        0x00a7,
+	"semicolon":      0x003b,
+	"seven":          0x0037,
+	"sfthyphen":      0x00ad,
+	"Sigma":          0x03a3,
+	"sigma":          0x03c3,
+	"similar":        0x223c,
+	"six":            0x0036,
+	"slash":          0x002f,
+	"space":          0x0020,
+	"spade":          0x2660,
+	"sterling":       0x00a3,
+	"summation":      0x2211,
+	"T":              0x0054,
+	"t":              0x0074,
+	"tau":            0x03c4,
+	"Tcaron":         0x0164,
+	"tcaron":         0x0165,
+	"Theta":          0x0398,
+	"theta":          0x03b8,
+	"Thorn":          0x00de,
+	"thorn":          0x00fe,
+	"three":          0x0033,
+	"threequarters":  0x00be,
+	"threesuperior":  0x00b3,
+	"tilde":          0x02dc,
+	"trademark":      0x2122,
+	"two":            0x0032,
+	"twosuperior":    0x00b2,
+	"U":              0x0055,
+	"u":              0x0075,
+	"Uacute":         0x00da,
+	"uacute":         0x00fa,
+	"Ucircumflex":    0x00db,
+	"ucircumflex":    0x00fb,
+	"Udieresis":      0x00dc,
+	"udieresis":      0x00fc,
+	"Ugrave":         0x00d9,
+	"ugrave":         0x00f9,
+	"Uhungarumlaut":  0x0170,
+	"uhungarumlaut":  0x0171,
+	"Umacron":        0x016a,
+	"umacron":        0x016b,
+	"underscore":     0x005f,
+	"union":          0x222a,
+	"universal":      0x2200,
+	"upsilon":        0x03c5,
+	"Uring":          0x016e,
+	"uring":          0x016f,
+	"V":              0x0056,
+	"v":              0x0076,
+	"visiblespace":   0x2423,
+	"W":              0x0057,
+	"w":              0x0077,
+	"X":              0x0058,
+	"x":              0x0078,
+	"Xi":             0x039e,
+	"xi":             0x03be,
+	"Y":              0x0059,
+	"y":              0x0079,
+	"Yacute":         0x00dd,
+	"yacute":         0x00fd,
+	"Ydieresis":      0x0178,
+	"ydieresis":      0x00ff,
+	"yen":            0x00a5,
+	"Z":              0x005a,
+	"z":              0x007a,
+	"Zacute":         0x0179,
+	"zacute":         0x017a,
+	"Zcaron":         0x017d,
+	"zcaron":         0x017e,
+	"Zdotaccent":     0x017b,
+	"zdotaccent":     0x017c,
+	"zero":           0x0030,
+	"zeta":           0x03b6,
+}
+
+// StandardEncoding, the default for Type 1 fonts. Codes without a glyph are 0.
+var standardEncoding = [256]rune{
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x00
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x08
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x10
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x18
+	0x0020, 0x0021, 0x0022, 0x0023, 0x0024, 0x0025, 0x0026, 0x2019, // 0x20
+	0x0028, 0x0029, 0x002a, 0x002b, 0x002c, 0x002d, 0x002e, 0x002f, // 0x28
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037, // 0x30
+	0x0038, 0x0039, 0x003a, 0x003b, 0x003c, 0x003d, 0x003e, 0x003f, // 0x38
+	0x0040, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047, // 0x40
+	0x0048, 0x0049, 0x004a, 0x004b, 0x004c, 0x004d, 0x004e, 0x004f, // 0x48
+	0x0050, 0x0051, 0x0052, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, // 0x50
+	0x0058, 0x0059, 0x005a, 0x005b, 0x005c, 0x005d, 0x005e, 0x005f, // 0x58
+	0x2018, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067, // 0x60
+	0x0068, 0x0069, 0x006a, 0x006b, 0x006c, 0x006d, 0x006e, 0x006f, // 0x68
+	0x0070, 0x0071, 0x0072, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, // 0x70
+	0x0078, 0x0079, 0x007a, 0x007b, 0x007c, 0x007d, 0x007e, 0x0000, // 0x78
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x80
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x88
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x90
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x98
+	0x0000, 0x00a1, 0x00a2, 0x00a3, 0x2044, 0x00a5, 0x0192, 0x00a7, // 0xa0
+	0x00a4, 0x0027, 0x201c, 0x00ab, 0x2039, 0x203a, 0xfb01, 0xfb02, // 0xa8
+	0x0000, 0x2013, 0x2020, 0x2021, 0x00b7, 0x0000, 0x00b6, 0x2022, // 0xb0
+	0x201a, 0x201e, 0x201d, 0x00bb, 0x2026, 0x2030, 0x0000, 0x00bf, // 0xb8
+	0x0000, 0x0060, 0x00b4, 0x02c6, 0x02dc, 0x00af, 0x02d8, 0x02d9, // 0xc0
+	0x00a8, 0x0000, 0x02da, 0x00b8, 0x0000, 0x02dd, 0x02db, 0x02c7, // 0xc8
+	0x2014, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0xd0
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0xd8
+	0x0000, 0x00c6, 0x0000, 0x00aa, 0x0000, 0x0000, 0x0000, 0x0000, // 0xe0
+	0x0141, 0x00d8, 0x0152, 0x00ba, 0x0000, 0x0000, 0x0000, 0x0000, // 0xe8
+	0x0000, 0x00e6, 0x0000, 0x0000, 0x0000, 0x0131, 0x0000, 0x0000, // 0xf0
+	0x0142, 0x00f8, 0x0153, 0x00df, 0x0000, 0x0000, 0x0000, 0x0000, // 0xf8
+}
+
+// WinAnsiEncoding, which is Windows code page 1252.
+var winAnsiEncoding = [256]rune{
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x00
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x08
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x10
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x18
+	0x0020, 0x0021, 0x0022, 0x0023, 0x0024, 0x0025, 0x0026, 0x0027, // 0x20
+	0x0028, 0x0029, 0x002a, 0x002b, 0x002c, 0x002d, 0x002e, 0x002f, // 0x28
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037, // 0x30
+	0x0038, 0x0039, 0x003a, 0x003b, 0x003c, 0x003d, 0x003e, 0x003f, // 0x38
+	0x0040, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047, // 0x40
+	0x0048, 0x0049, 0x004a, 0x004b, 0x004c, 0x004d, 0x004e, 0x004f, // 0x48
+	0x0050, 0x0051, 0x0052, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, // 0x50
+	0x0058, 0x0059, 0x005a, 0x005b, 0x005c, 0x005d, 0x005e, 0x005f, // 0x58
+	0x0060, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067, // 0x60
+	0x0068, 0x0069, 0x006a, 0x006b, 0x006c, 0x006d, 0x006e, 0x006f, // 0x68
+	0x0070, 0x0071, 0x0072, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, // 0x70
+	0x0078, 0x0079, 0x007a, 0x007b, 0x007c, 0x007d, 0x007e, 0x0000, // 0x78
+	0x20ac, 0x0000, 0x201a, 0x0192, 0x201e, 0x2026, 0x2020, 0x2021, // 0x80
+	0x02c6, 0x2030, 0x0160, 0x2039, 0x0152, 0x0000, 0x017d, 0x0000, // 0x88
+	0x0000, 0x2018, 0x2019, 0x201c, 0x201d, 0x2022, 0x2013, 0x2014, // 0x90
+	0x02dc, 0x2122, 0x0161, 0x203a, 0x0153, 0x0000, 0x017e, 0x0178, // 0x98
+	0x0020, 0x00a1, 0x00a2, 0x00a3, 0x00a4, 0x00a5, 0x00a6, 0x00a7, // 0xa0
+	0x00a8, 0x00a9, 0x00aa, 0x00ab, 0x00ac, 0x002d, 0x00ae, 0x00af, // 0xa8
+	0x00b0, 0x00b1, 0x00b2, 0x00b3, 0x00b4, 0x00b5, 0x00b6, 0x00b7, // 0xb0
+	0x00b8, 0x00b9, 0x00ba, 0x00bb, 0x00bc, 0x00bd, 0x00be, 0x00bf, // 0xb8
+	0x00c0, 0x00c1, 0x00c2, 0x00c3, 0x00c4, 0x00c5, 0x00c6, 0x00c7, // 0xc0
+	0x00c8, 0x00c9, 0x00ca, 0x00cb, 0x00cc, 0x00cd, 0x00ce, 0x00cf, // 0xc8
+	0x00d0, 0x00d1, 0x00d2, 0x00d3, 0x00d4, 0x00d5, 0x00d6, 0x00d7, // 0xd0
+	0x00d8, 0x00d9, 0x00da, 0x00db, 0x00dc, 0x00dd, 0x00de, 0x00df, // 0xd8
+	0x00e0, 0x00e1, 0x00e2, 0x00e3, 0x00e4, 0x00e5, 0x00e6, 0x00e7, // 0xe0
+	0x00e8, 0x00e9, 0x00ea, 0x00eb, 0x00ec, 0x00ed, 0x00ee, 0x00ef, // 0xe8
+	0x00f0, 0x00f1, 0x00f2, 0x00f3, 0x00f4, 0x00f5, 0x00f6, 0x00f7, // 0xf0
+	0x00f8, 0x00f9, 0x00fa, 0x00fb, 0x00fc, 0x00fd, 0x00fe, 0x00ff, // 0xf8
+}
+
+// MacRomanEncoding, as the PDF spec has it.
+var macRomanEncoding = [256]rune{
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x00
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x08
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x10
+	0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, // 0x18
+	0x0020, 0x0021, 0x0022, 0x0023, 0x0024, 0x0025, 0x0026, 0x0027, // 0x20
+	0x0028, 0x0029, 0x002a, 0x002b, 0x002c, 0x002d, 0x002e, 0x002f, // 0x28
+	0x0030, 0x0031, 0x0032, 0x0033, 0x0034, 0x0035, 0x0036, 0x0037, // 0x30
+	0x0038, 0x0039, 0x003a, 0x003b, 0x003c, 0x003d, 0x003e, 0x003f, // 0x38
+	0x0040, 0x0041, 0x0042, 0x0043, 0x0044, 0x0045, 0x0046, 0x0047, // 0x40
+	0x0048, 0x0049, 0x004a, 0x004b, 0x004c, 0x004d, 0x004e, 0x004f, // 0x48
+	0x0050, 0x0051, 0x0052, 0x0053, 0x0054, 0x0055, 0x0056, 0x0057, // 0x50
+	0x0058, 0x0059, 0x005a, 0x005b, 0x005c, 0x005d, 0x005e, 0x005f, // 0x58
+	0x0060, 0x0061, 0x0062, 0x0063, 0x0064, 0x0065, 0x0066, 0x0067, // 0x60
+	0x0068, 0x0069, 0x006a, 0x006b, 0x006c, 0x006d, 0x006e, 0x006f, // 0x68
+	0x0070, 0x0071, 0x0072, 0x0073, 0x0074, 0x0075, 0x0076, 0x0077, // 0x70
+	0x0078, 0x0079, 0x007a, 0x007b, 0x007c, 0x007d, 0x007e, 0x0000, // 0x78
+	0x00c4, 0x00c5, 0x00c7, 0x00c9, 0x00d1, 0x00d6, 0x00dc, 0x00e1, // 0x80
+	0x00e0, 0x00e2, 0x00e4, 0x00e3, 0x00e5, 0x00e7, 0x00e9, 0x00e8, // 0x88
+	0x00ea, 0x00eb, 0x00ed, 0x00ec, 0x00ee, 0x00ef, 0x00f1, 0x00f3, // 0x90
+	0x00f2, 0x00f4, 0x00f6, 0x00f5, 0x00fa, 0x00f9, 0x00fb, 0x00fc, // 0x98
+	0x2020, 0x00b0, 0x00a2, 0x00a3, 0x00a7, 0x2022, 0x00b6, 0x00df, // 0xa0
+	0x00ae, 0x00a9, 0x2122, 0x00b4, 0x00a8, 0x2260, 0x00c6, 0x00d8, // 0xa8
+	0x221e, 0x00b1, 0x2264, 0x2265, 0x00a5, 0x00b5, 0x2202, 0x2211, // 0xb0
+	0x220f, 0x03c0, 0x222b, 0x00aa, 0x00ba, 0x03a9, 0x00e6, 0x00f8, // 0xb8
+	0x00bf, 0x00a1, 0x00ac, 0x221a, 0x0192, 0x2248, 0x2206, 0x00ab, // 0xc0
+	0x00bb, 0x2026, 0x00a0, 0x00c0, 0x00c3, 0x00d5, 0x0152, 0x0153, // 0xc8
+	0x2013, 0x2014, 0x201c, 0x201d, 0x2018, 0x2019, 0x00f7, 0x25ca, // 0xd0
+	0x00ff, 0x0178, 0x2044, 0x00a4, 0x2039, 0x203a, 0xfb01, 0xfb02, // 0xd8
+	0x2021, 0x00b7, 0x201a, 0x201e, 0x2030, 0x00c2, 0x00ca, 0x00c1, // 0xe0
+	0x00cb, 0x00c8, 0x00cd, 0x00ce, 0x00cf, 0x00cc, 0x00d3, 0x00d4, // 0xe8
+	0xf8ff, 0x00d2, 0x00da, 0x00db, 0x00d9, 0x0131, 0x02c6, 0x02dc, // 0xf0
+	0x00af, 0x02d8, 0x02d9, 0x02da, 0x00b8, 0x02dd, 0x02db, 0x02c7, // 0xf8
+}
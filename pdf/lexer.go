@@ -1,8 +1,10 @@
-package main
+package pdf
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 )
 
@@ -20,10 +22,10 @@ const (
 	ModeWord
 	ModeSymbol
 	ModeHex
-	ModeStream
-	ModeStreamStart
 	ModeString
 	ModeStringEscape
+	ModeStringOctal
+	ModeStringCR
 )
 
 type OperatorToken struct {
@@ -104,235 +106,503 @@ var AttrsEnd = &OperatorToken{">>"}
 var ArrayStart = &OperatorToken{"["}
 var ArrayEnd = &OperatorToken{"]"}
 
+// Whitespace, delimiter, and regular characters are the spec's three character classes.
 func isWhitespace(c byte) bool {
-	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
 }
 
-func isDigit(c byte) bool {
-	return '0' <= c && c <= '9'
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
 }
 
-func isLetter(c byte) bool {
-	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z')
+func isRegular(c byte) bool {
+	return !isWhitespace(c) && !isDelimiter(c)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
 }
 
 func isHexDigit(c byte) bool {
 	return isDigit(c) || ('A' <= c && c <= 'F') || ('a' <= c && c <= 'f')
 }
 
-func lex(buf []byte) ([]Token, error) {
+func hexValue(c byte) byte {
+	switch {
+	case isDigit(c):
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// Hex digits to bytes. A missing final digit is 0.
+func decodeHex(digits []byte) []byte {
+	buf := make([]byte, (len(digits)+1)/2)
+	for i, c := range digits {
+		if i%2 == 0 {
+			buf[i/2] = hexValue(c) << 4
+		} else {
+			buf[i/2] |= hexValue(c)
+		}
+	}
+	return buf
+}
+
+// Split buf into tokens, and return the offset where each token starts.
+func lex(buf []byte) ([]Token, []int64, error) {
+	t := NewTokenizer(bytes.NewReader(buf))
+	tokens := []Token{}
+	offsets := []int64{}
+	for {
+		token, offset, err := t.Next()
+		if err == io.EOF {
+			return tokens, offsets, nil
+		}
+		if err != nil {
+			return tokens, offsets, err
+		}
+		tokens = append(tokens, token)
+		offsets = append(offsets, offset)
+	}
+}
+
+// Reads PDF tokens one at a time, so only the token being read is in memory.
+type Tokenizer struct {
+	r *bufio.Reader
+	// offset of the next byte r will return
+	offset int64
+	// the last token was the stream keyword, so stream data is next
+	inStream bool
+	// content streams have inline images: ID, then image data, then EI
+	inlineImages bool
+	inImage      bool
+	// a token that was read along with the previous one
+	pending       Token
+	pendingOffset int64
+	// Gives the /Length of the stream being read. If nil, or if it fails,
+	// stream data is found by looking for endstream.
+	streamLength func() (int64, bool)
+	// number of the object being read, for errors
+	object int64
+	// streams whose /Length was wrong
+	warnings []error
+}
+
+// Tokens from r, with offsets counted from where r starts.
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return &Tokenizer{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Tokens from the part of r starting at offset and ending at size,
+// with offsets counted from the start of r.
+func NewTokenizerAt(r io.ReaderAt, offset int64, size int64) *Tokenizer {
+	t := NewTokenizer(io.NewSectionReader(r, offset, size-offset))
+	t.offset = offset
+	return t
+}
+
+func (t *Tokenizer) errorf(offset int64, format string, args ...interface{}) error {
+	return errorf(offset, t.object, format, args...)
+}
+
+// The next byte without reading it. At EOF, it's a space,
+// which ends any token that isn't a string or stream.
+func (t *Tokenizer) peek() (c byte, atEOF bool, err error) {
+	buf, err := t.r.Peek(1)
+	if err == io.EOF {
+		return ' ', true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return buf[0], false, nil
+}
+
+// Read the byte that peek returned.
+func (t *Tokenizer) advance() {
+	t.r.Discard(1)
+	t.offset++
+}
+
+// Read the next token and the offset where it starts. At the end of the input,
+// the error is io.EOF.
+func (t *Tokenizer) Next() (Token, int64, error) {
+	if t.pending != nil {
+		token := t.pending
+		t.pending = nil
+		return token, t.pendingOffset, nil
+	}
+	if t.inStream {
+		t.inStream = false
+		return t.readStream()
+	}
+	if t.inImage {
+		t.inImage = false
+		return t.readInlineImage()
+	}
+
 	mode := ModeStart
 	tokenBuf := []byte{}
-	tokens := []Token{}
-	for pos := 0; pos < len(buf); {
-		c := buf[pos]
+	// start of the token being read
+	start := t.offset
+	// literal string state: unbalanced parentheses, and an octal escape in progress
+	depth := 0
+	octal, octalDigits := 0, 0
+	for {
+		c, atEOF, err := t.peek()
+		if err != nil {
+			return nil, t.offset, err
+		}
+		if mode == ModeStart {
+			start = t.offset
+			if atEOF {
+				return nil, start, io.EOF
+			}
+		}
+		if atEOF {
+			switch mode {
+			case ModeString, ModeStringEscape, ModeHex:
+				return nil, start, t.errorf(start, "Mode %d: Unfinished business", mode)
+			}
+		}
 		switch mode {
 		case ModeStart:
 			switch {
 			case isWhitespace(c):
-				pos++
+				t.advance()
 			case c == '%':
 				mode = ModeMeta
-				pos++
-			case c == '-':
+				t.advance()
+			case c == '+' || c == '-':
 				mode = ModeInt
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
+			case c == '.':
+				mode = ModeFloat
+				tokenBuf = append(tokenBuf, c)
+				t.advance()
 			case isDigit(c):
 				mode = ModeInt
-			case isLetter(c):
-				mode = ModeWord
 			case c == '<':
 				mode = ModeLT
-				pos++
+				t.advance()
 			case c == '>':
 				mode = ModeGT
-				pos++
+				t.advance()
 			case c == '[':
-				tokens = append(tokens, ArrayStart)
-				pos++
+				t.advance()
+				return ArrayStart, start, nil
 			case c == ']':
-				tokens = append(tokens, ArrayEnd)
-				pos++
+				t.advance()
+				return ArrayEnd, start, nil
 			case c == '/':
 				mode = ModeSymbol
-				pos++
+				t.advance()
 			case c == '(':
 				mode = ModeString
-				pos++
+				t.advance()
+			case c == '{' || c == '}':
+				// only used in PostScript calculator functions
+				t.advance()
+				return &OperatorToken{string(c)}, start, nil
+			case c == ')':
+				return nil, start, t.errorf(start, "ModeStart: Unexpected %q", c)
 			default:
-				return tokens, fmt.Errorf("ModeStart: Unexpected %q at pos %d", c, pos)
+				// keywords are runs of regular characters, like T* and '
+				mode = ModeWord
 			}
 		case ModeMeta:
+			// comments run to the end of the line
 			switch {
-			case isWhitespace(c):
-				tokens = append(tokens, &MetaToken{tokenBuf})
-				tokenBuf = []byte{}
-				mode = ModeStart
+			case atEOF || c == '\r' || c == '\n':
+				return &MetaToken{tokenBuf}, start, nil
 			default:
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			}
 		case ModeInt:
 			switch {
 			case isDigit(c):
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			case c == '.':
 				tokenBuf = append(tokenBuf, c)
 				mode = ModeFloat
-				pos++
+				t.advance()
 			default:
 				value, err := strconv.ParseInt(string(tokenBuf), 10, 64)
 				if err != nil {
-					return tokens, err
+					return nil, start, t.errorf(start, "Bad number %q", tokenBuf)
 				}
-				tokens = append(tokens, &IntToken{value})
-				tokenBuf = []byte{}
-				mode = ModeStart
+				return &IntToken{value}, start, nil
 			}
 		case ModeFloat:
 			switch {
 			case isDigit(c):
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			case c == '.':
-				return tokens, fmt.Errorf("ModeFloat: Unexpected %q at pos %d", c, pos)
+				return nil, start, t.errorf(t.offset, "ModeFloat: Unexpected %q", c)
 			default:
 				value, err := strconv.ParseFloat(string(tokenBuf), 64)
 				if err != nil {
-					return tokens, err
+					return nil, start, t.errorf(start, "Bad number %q", tokenBuf)
 				}
-				tokens = append(tokens, &FloatToken{value})
-				tokenBuf = []byte{}
-				mode = ModeStart
+				return &FloatToken{value}, start, nil
 			}
 		case ModeWord:
 			switch {
-			case isLetter(c) || c == '*':
+			case isRegular(c) && !atEOF:
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			default:
 				word := &WordToken{string(tokenBuf)}
-				tokens = append(tokens, word)
-				tokenBuf = []byte{}
-				if word.val == "stream" {
-					mode = ModeStreamStart
-				} else {
-					mode = ModeStart
-				}
+				t.inStream = word.val == "stream"
+				t.inImage = word.val == "ID" && t.inlineImages
+				return word, start, nil
 			}
 		case ModeLT:
 			switch {
 			case c == '<':
-				tokens = append(tokens, AttrsStart)
-				mode = ModeStart
-				pos++
-			case isHexDigit(c):
-				mode = ModeHex
+				t.advance()
+				return AttrsStart, start, nil
 			default:
-				return tokens, fmt.Errorf("ModeLT: Unexpected %q at pos %d", c, pos)
+				mode = ModeHex
 			}
 		case ModeGT:
 			switch {
 			case c == '>':
-				tokens = append(tokens, AttrsEnd)
-				mode = ModeStart
-				pos++
+				t.advance()
+				return AttrsEnd, start, nil
 			default:
-				return tokens, fmt.Errorf("ModeGT: Unexpected %q at pos %d", c, pos)
+				return nil, start, t.errorf(t.offset, "ModeGT: Unexpected %q", c)
 			}
 		case ModeHex:
 			switch {
 			case isHexDigit(c):
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
+			case isWhitespace(c):
+				t.advance()
 			case c == '>':
-				tokens = append(tokens, &HexToken{tokenBuf})
-				tokenBuf = []byte{}
-				mode = ModeStart
-				pos++
+				t.advance()
+				return &HexToken{decodeHex(tokenBuf)}, start, nil
 			default:
-				return tokens, fmt.Errorf("ModeHex: Unexpected %q at pos %d", c, pos)
+				return nil, start, t.errorf(t.offset, "ModeHex: Unexpected %q", c)
 			}
 		case ModeSymbol:
+			if c == '#' {
+				// #xx escapes any byte; a # without two hex digits is literal, as before PDF 1.2
+				if escape, _ := t.r.Peek(3); len(escape) == 3 && isHexDigit(escape[1]) && isHexDigit(escape[2]) {
+					tokenBuf = append(tokenBuf, decodeHex(escape[1:])...)
+					t.advance()
+					t.advance()
+					t.advance()
+					break
+				}
+			}
 			switch {
-			case isLetter(c):
-				fallthrough
-			case isDigit(c):
-				fallthrough
-			case c == '_' || c == '-' || c == ',' || c == '*':
+			case isRegular(c) && !atEOF:
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			default:
-				tokens = append(tokens, &SymbolToken{string(tokenBuf)})
-				tokenBuf = []byte{}
-				mode = ModeStart
+				return &SymbolToken{string(tokenBuf)}, start, nil
 			}
 		case ModeString:
-			switch {
-			case c == '\\':
+			switch c {
+			case '\\':
 				mode = ModeStringEscape
-				pos++
-			case c == ')':
-				tokens = append(tokens, &StringToken{string(tokenBuf)})
-				tokenBuf = []byte{}
-				mode = ModeStart
-				pos++
+				t.advance()
+			case '(':
+				// balanced parentheses don't need escaping
+				depth++
+				tokenBuf = append(tokenBuf, c)
+				t.advance()
+			case ')':
+				t.advance()
+				if depth == 0 {
+					return &StringToken{string(tokenBuf)}, start, nil
+				}
+				depth--
+				tokenBuf = append(tokenBuf, c)
+			case '\r':
+				// every end-of-line marker in a string means \n
+				tokenBuf = append(tokenBuf, '\n')
+				mode = ModeStringCR
+				t.advance()
 			default:
 				tokenBuf = append(tokenBuf, c)
-				pos++
+				t.advance()
 			}
+		case ModeStringCR:
+			// the LF of a CRLF has already been accounted for
+			if c == '\n' && !atEOF {
+				t.advance()
+			}
+			mode = ModeString
 		case ModeStringEscape:
-			switch {
-			case isWhitespace(c):
-				mode = ModeString
-				pos++
+			mode = ModeString
+			switch c {
+			case 'n':
+				tokenBuf = append(tokenBuf, '\n')
+			case 'r':
+				tokenBuf = append(tokenBuf, '\r')
+			case 't':
+				tokenBuf = append(tokenBuf, '\t')
+			case 'b':
+				tokenBuf = append(tokenBuf, '\b')
+			case 'f':
+				tokenBuf = append(tokenBuf, '\f')
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				octal = int(c - '0')
+				octalDigits = 1
+				mode = ModeStringOctal
+			case '\n':
+				// line continuation
+			case '\r':
+				// line continuation, possibly CRLF
+				mode = ModeStringCR
 			default:
+				// includes \(, \), and \\; other escapes drop the backslash
 				tokenBuf = append(tokenBuf, c)
+			}
+			t.advance()
+		case ModeStringOctal:
+			// up to 3 digits; overflow past a byte is ignored
+			if '0' <= c && c <= '7' && octalDigits < 3 && !atEOF {
+				octal = octal*8 + int(c-'0')
+				octalDigits++
+				t.advance()
+			} else {
+				tokenBuf = append(tokenBuf, byte(octal))
 				mode = ModeString
-				pos++
 			}
-		case ModeStreamStart:
-			switch {
-			case isWhitespace(c):
-				pos++
-			default:
-				mode = ModeStream
+		default:
+			return nil, start, t.errorf(t.offset, "Mode %d: Unexpected %q", mode, c)
+		}
+	}
+}
+
+var endstream = []byte("endstream")
+
+// Read stream data, which follows the stream keyword and an end-of-line marker.
+// Its length comes from the stream dictionary, unless that's missing or wrong,
+// in which case the first endstream ends the data.
+func (t *Tokenizer) readStream() (Token, int64, error) {
+	if eol, _ := t.r.Peek(2); bytes.HasPrefix(eol, []byte("\r\n")) {
+		t.advance()
+		t.advance()
+	} else if len(eol) > 0 && (eol[0] == '\r' || eol[0] == '\n') {
+		t.advance()
+	}
+	start := t.offset
+
+	wrongLength := int64(-1)
+	if t.streamLength != nil {
+		if length, ok := t.streamLength(); ok && length >= 0 {
+			// grows as data arrives, so a huge bogus length doesn't allocate a huge buffer
+			data := new(bytes.Buffer)
+			n, err := io.CopyN(data, t.r, length)
+			t.offset += n
+			if err != nil && err != io.EOF {
+				return nil, start, err
 			}
-		case ModeStream:
-			// TODO: doesn't use object's stream length info
-		StreamSwitch:
-			switch {
-			case isWhitespace(c):
-				// look ahead for endstream token
-				for lPos := pos + 1; ; lPos++ {
-					if lPos >= len(buf) {
-						return tokens, fmt.Errorf("ModeStream: EOF while looking for endstream from pos %d", pos)
-					}
-					if isWhitespace(buf[lPos]) {
-						continue
-					}
-					if bytes.HasPrefix(buf[lPos:], []byte("endstream")) {
-						tokens = append(tokens, &StreamToken{tokenBuf})
-						tokenBuf = []byte{}
-						mode = ModeStart
-						break StreamSwitch
-					}
-					// if we don't see an endstream, c is part of the stream data
-					break
-				}
-				fallthrough
-			default:
-				tokenBuf = append(tokenBuf, c)
-				pos++
+			if err == nil && t.endstreamNext() {
+				return &StreamToken{data.Bytes()}, start, nil
 			}
-		default:
-			return tokens, fmt.Errorf("Mode %d: Unexpected %q at pos %d", mode, c, pos)
+			// go back to the start of the data and look for endstream
+			t.r = bufio.NewReader(io.MultiReader(bytes.NewReader(data.Bytes()), t.r))
+			t.offset -= n
+			wrongLength = length
+		}
+	}
+
+	data := []byte{}
+	for {
+		c, err := t.r.ReadByte()
+		if err == io.EOF {
+			return nil, start, t.errorf(start, "Stream: EOF while looking for endstream")
 		}
+		if err != nil {
+			return nil, start, err
+		}
+		t.offset++
+		data = append(data, c)
+		// endstream by itself or after whitespace, which isn't part of the data
+		if end := len(data) - len(endstream); end >= 0 && bytes.Equal(data[end:], endstream) &&
+			(end == 0 || isWhitespace(data[end-1])) {
+			t.pending = &WordToken{string(endstream)}
+			t.pendingOffset = t.offset - int64(len(endstream))
+			// only the end of line before endstream; anything else could be data
+			data = data[:end]
+			if bytes.HasSuffix(data, []byte("\r\n")) {
+				data = data[:len(data)-2]
+			} else if bytes.HasSuffix(data, []byte("\n")) || bytes.HasSuffix(data, []byte("\r")) {
+				data = data[:len(data)-1]
+			}
+			break
+		}
+	}
+	if wrongLength >= 0 {
+		t.warnings = append(t.warnings, t.errorf(start,
+			"Stream /Length is %d bytes, but endstream follows %d bytes of data", wrongLength, len(data)))
 	}
-	if mode != ModeStart {
-		return tokens, fmt.Errorf("Mode %d: Unfinished business", mode)
+	return &StreamToken{data}, start, nil
+}
+
+// Read inline image data, which follows the ID operator and one whitespace character.
+// Image data has no length, so it ends at the first EI with whitespace on both sides.
+func (t *Tokenizer) readInlineImage() (Token, int64, error) {
+	if c, atEOF, err := t.peek(); err != nil {
+		return nil, t.offset, err
+	} else if isWhitespace(c) && !atEOF {
+		t.advance()
+	}
+	start := t.offset
+
+	data := []byte{}
+	for {
+		c, err := t.r.ReadByte()
+		if err == io.EOF {
+			return nil, start, t.errorf(start, "Inline image: EOF while looking for EI")
+		}
+		if err != nil {
+			return nil, start, err
+		}
+		t.offset++
+		data = append(data, c)
+		if end := len(data) - len("EI"); end >= 1 && data[end] == 'E' && data[end+1] == 'I' && isWhitespace(data[end-1]) {
+			if next, atEOF, err := t.peek(); err != nil {
+				return nil, start, err
+			} else if isWhitespace(next) || atEOF {
+				t.pending = &WordToken{"EI"}
+				t.pendingOffset = t.offset - int64(len("EI"))
+				return &StreamToken{data[: end-1 : end-1]}, start, nil
+			}
+		}
+	}
+}
+
+// Whether endstream, possibly after whitespace, is next.
+func (t *Tokenizer) endstreamNext() bool {
+	for n := 0; ; n++ {
+		buf, _ := t.r.Peek(n + len(endstream))
+		if len(buf) < n+len(endstream) {
+			return false
+		}
+		if bytes.HasPrefix(buf[n:], endstream) {
+			return true
+		}
+		if !isWhitespace(buf[n]) {
+			return false
+		}
 	}
-	return tokens, nil
 }
@@ -0,0 +1,151 @@
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var literalStringTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"empty", `()`, ""},
+	{"plain", `(This is a string)`, "This is a string"},
+	{"balanced parens", `(Strings may contain balanced parentheses ( ) and special characters (*!&}^% and so on).)`,
+		"Strings may contain balanced parentheses ( ) and special characters (*!&}^% and so on)."},
+	{"nested parens", `(a(b(c)d)e)`, "a(b(c)d)e"},
+	{"escaped parens", `(unbalanced \( and \))`, "unbalanced ( and )"},
+	{"escaped backslash", `(C:\\Windows\\)`, `C:\Windows\`},
+	{"named escapes", `(\n\r\t\b\f)`, "\n\r\t\b\f"},
+	{"octal", `(\101\102\103)`, "ABC"},
+	{"short octal", `(\0053)`, "\x053"},
+	{"one digit octal", `(\5x)`, "\x05x"},
+	{"octal overflow", `(\777)`, "\xff"},
+	{"octal at end", `(\53)`, "+"},
+	{"unknown escape", `(\q\%)`, "q%"},
+	{"LF continuation", "(These \\\ntwo strings \\\nare the same.)", "These two strings are the same."},
+	{"CRLF continuation", "(split \\\r\nline)", "split line"},
+	{"CR continuation", "(split \\\rline)", "split line"},
+	{"LF", "(two\nlines)", "two\nlines"},
+	{"CRLF", "(two\r\nlines)", "two\nlines"},
+	{"CR", "(two\rlines)", "two\nlines"},
+	{"CR CR", "(two\r\rlines)", "two\n\nlines"},
+	{"binary", "(\x00\xff\x80)", "\x00\xff\x80"},
+	{"UTF-16 BOM", `(\376\377\000A)`, "\xfe\xff\x00A"},
+	{"escaped paren in nested", `((\)))`, "())"},
+}
+
+func TestLex_LiteralStrings(t *testing.T) {
+	for _, test := range literalStringTests {
+		tokens, _, err := lex([]byte(test.input + "\n"))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if len(tokens) != 1 {
+			t.Errorf("%s: expected 1 token, got %v", test.name, tokens)
+			continue
+		}
+		str, ok := tokens[0].(*StringToken)
+		if !ok {
+			t.Errorf("%s: expected a string, got %v", test.name, tokens[0])
+			continue
+		}
+		if str.val != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, str.val)
+		}
+	}
+}
+
+// Tokens after a string start where the string ends
+func TestLex_LiteralStringThenToken(t *testing.T) {
+	tokens, offsets, err := lex([]byte("(a(b)c)Tj\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("Expected 2 tokens, got %v", tokens)
+	}
+	if word, ok := tokens[1].(*WordToken); !ok || word.val != "Tj" || offsets[1] != 7 {
+		t.Errorf("Expected Tj at offset 7, got %v at %d", tokens[1], offsets[1])
+	}
+}
+
+var tokenTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"name", `/Name1`, `[Symbol "Name1"]`},
+	{"name punctuation", `/A;Name_With-Various***Characters?`, `[Symbol "A;Name_With-Various***Characters?"]`},
+	{"name digits", `/1.2`, `[Symbol "1.2"]`},
+	{"name escapes", `/Lime#20Green /paired#28#29parentheses /The_Key_of_F#23_Minor`,
+		`[Symbol "Lime Green" Symbol "paired()parentheses" Symbol "The_Key_of_F#_Minor"]`},
+	{"name lower case escape", `/A#2f#2FB`, `[Symbol "A//B"]`},
+	{"name bad escape", `/A#zz /B#2`, `[Symbol "A#zz" Symbol "B#2"]`},
+	{"empty name", `/ /A`, `[Symbol "" Symbol "A"]`},
+	{"names run together", `/A/B[/C]`, `[Symbol "A" Symbol "B" [ Symbol "C" ]]`},
+	{"integers", `123 43445 +17 -98 0`, `[Int 123 Int 43445 Int 17 Int -98 Int 0]`},
+	{"reals", `34.5 -3.62 +123.6 4. -.002 0.0 .5`,
+		`[Float 34.500000 Float -3.620000 Float 123.600000 Float 4.000000 Float -0.002000 Float 0.000000 Float 0.500000]`},
+	{"numbers before delimiters", `[1 2.5]<</W 3>>`, `[[ Int 1 Float 2.500000 ] << Symbol "W" Int 3 >>]`},
+	{"hex", `<4E6F762073686D6F7A206B6120706F702E>`, `[Hex "Nov shmoz ka pop."]`},
+	{"hex lower case", `<feff0041>`, `[Hex "\xfe\xff\x00A"]`},
+	{"hex whitespace", "<48 65\n6c\t6C 6f>", `[Hex "Hello"]`},
+	{"hex odd length", `<901FA>`, `[Hex "\x90\x1f\xa0"]`},
+	{"hex empty", `<>`, `[Hex ""]`},
+	{"braces", `{ 2 copy }`, `[{ Int 2 Word "copy" }]`},
+	{"form feed and NUL", "1\f2\x003", `[Int 1 Int 2 Int 3]`},
+	{"operators", `BT T* ' " d0 ET`, `[Word "BT" Word "T*" Word "'" Word "\"" Word "d0" Word "ET"]`},
+	{"comment", "1 % a comment /with (tokens)\r2", `[Int 1 Meta " a comment /with (tokens)" Int 2]`},
+	{"no trailing whitespace", `1 0 R`, `[Int 1 Int 0 Word "R"]`},
+}
+
+func TestLex_Tokens(t *testing.T) {
+	for _, test := range tokenTests {
+		tokens, _, err := lex([]byte(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if actual := fmt.Sprint(tokens); actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestLex_BadNumber(t *testing.T) {
+	_, _, err := lex([]byte("1 -.\n"))
+	if pdfErr, ok := err.(*Error); !ok || pdfErr.Offset != 2 {
+		t.Errorf("Expected an error at offset 2, got %v", err)
+	}
+}
+
+// Reading a byte at a time gives the same tokens, so nothing depends on how reads are split up
+func TestTokenizer_OneByteReader(t *testing.T) {
+	input := "1 0 obj\n<< /Name#20Escape (a\\\r\nb) /Hex <41 4> /Num -.5 >>\nendobj % done"
+	expected, expectedOffsets, err := lex([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenizer := NewTokenizer(iotest.OneByteReader(strings.NewReader(input)))
+	for i := 0; ; i++ {
+		token, offset, err := tokenizer.Next()
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Errorf("Expected %d tokens, got %d", len(expected), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(expected) || token.String() != expected[i].String() || offset != expectedOffsets[i] {
+			t.Errorf("Token %d: got %v at %d", i, token, offset)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package pdf
+
+import (
+	"fmt"
+)
+
+// Any PDF object. Val() returns the equivalent Go value for scalars,
+// and the object itself for everything else.
+// Refs are returned unresolved; use Document.Resolve() to follow them.
+type Object interface {
+	Val() interface{}
+}
+
+type Null struct{}
+
+func (o Null) Val() interface{} {
+	return nil
+}
+
+type Bool bool
+
+func (o Bool) Val() interface{} {
+	return bool(o)
+}
+
+type Int int64
+
+func (o Int) Val() interface{} {
+	return int64(o)
+}
+
+type Float float64
+
+func (o Float) Val() interface{} {
+	return float64(o)
+}
+
+// Strings are arbitrary bytes. Their encoding depends on where they're used.
+type String string
+
+func (o String) Val() interface{} {
+	return string(o)
+}
+
+type Name string
+
+func (o Name) Val() interface{} {
+	return string(o)
+}
+
+type Array []Object
+
+func (o Array) Val() interface{} {
+	return o
+}
+
+// Keys are names, without the leading slash.
+type Dict map[string]Object
+
+func (o Dict) Val() interface{} {
+	return o
+}
+
+// An indirect reference to an object in a Document
+type Ref struct {
+	Num, Gen int64
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("Ref %d %d", r.Num, r.Gen)
+}
+
+func (r Ref) Val() interface{} {
+	return r
+}
+
+// PDF numbers can be integers or reals wherever they appear.
+func number(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case Int:
+		return float64(obj), true
+	case Float:
+		return float64(obj), true
+	}
+	return 0, false
+}
@@ -0,0 +1,131 @@
+package pdf
+
+import ()
+
+// A decoded /Type /ObjStm stream: N objects, stored one after another
+// after a header of object number and offset pairs.
+type objectStream struct {
+	stream *Stream
+	data   []byte
+	nums   []int64
+	// where each object starts in data
+	offsets []int
+}
+
+// Decode an object stream, or return the one decoded earlier.
+// Object streams can't be compressed themselves, and can't need their own objects
+// (or those of another stream that needs theirs) to be decoded.
+func (doc *Document) objectStream(num int64) (*objectStream, error) {
+	if objStm, ok := doc.objStreams[num]; ok {
+		return objStm, nil
+	}
+	if entry, ok := doc.xrefEntry(num); !ok || entry.kind != xrefInUse {
+		return nil, errorf(-1, num, "Object stream %d isn't an uncompressed object in use", num)
+	}
+	if doc.decodingObjStreams[num] {
+		return nil, errorf(-1, num, "Object stream %d needs one of its own objects to be decoded", num)
+	}
+	if doc.decodingObjStreams == nil {
+		doc.decodingObjStreams = map[int64]bool{}
+	}
+	doc.decodingObjStreams[num] = true
+	defer delete(doc.decodingObjStreams, num)
+
+	stream, err := doc.ResolveStream(Ref{num, 0})
+	if err != nil {
+		return nil, err
+	}
+	objStm, err := decodeObjectStream(stream)
+	if err != nil {
+		return nil, err
+	}
+	if doc.objStreams == nil {
+		doc.objStreams = map[int64]*objectStream{}
+	}
+	doc.objStreams[num] = objStm
+	return objStm, nil
+}
+
+func decodeObjectStream(stream *Stream) (*objectStream, error) {
+	if streamType, _ := stream.Attrs["Type"].(Name); streamType != "ObjStm" {
+		return nil, stream.errorf("Expected object stream, got type %v", stream.Attrs["Type"])
+	}
+	n, nOk := stream.Attrs["N"].(Int)
+	first, firstOk := stream.Attrs["First"].(Int)
+	if !nOk || !firstOk || n < 0 || first < 0 {
+		return nil, stream.errorf("Object stream needs /N and /First")
+	}
+	data, err := stream.Decode()
+	if err != nil {
+		return nil, err
+	}
+	if int(first) > len(data) {
+		return nil, stream.errorf("Object stream /First %d is past the end of its %d bytes", first, len(data))
+	}
+
+	tokens, _, err := lex(data[:first])
+	if err != nil {
+		return nil, stream.errorf("Object stream header: %v", err)
+	}
+	if int64(len(tokens))/2 < int64(n) {
+		return nil, stream.errorf("Object stream header has %d numbers, expected %d pairs", len(tokens), n)
+	}
+	objStm := &objectStream{
+		stream: stream,
+		data:   data,
+	}
+	for i := 0; i < int(n); i++ {
+		num, numOk := tokens[2*i].(*IntToken)
+		offset, offsetOk := tokens[2*i+1].(*IntToken)
+		if !numOk || !offsetOk || offset.val < 0 || offset.val > int64(len(data))-int64(first) {
+			return nil, stream.errorf("Bad object stream header entry %d: %v %v", i, tokens[2*i], tokens[2*i+1])
+		}
+		objStm.nums = append(objStm.nums, num.val)
+		objStm.offsets = append(objStm.offsets, int(first)+int(offset.val))
+	}
+	return objStm, nil
+}
+
+// Parse the object at index in the stream, which should be object number num.
+func (objStm *objectStream) object(doc *Document, index int, num int64) (Object, error) {
+	if index >= len(objStm.nums) || objStm.nums[index] != num {
+		// trust the stream's own header over the xref index
+		index = -1
+		for i, n := range objStm.nums {
+			if n == num {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return nil, objStm.stream.errorf("Object %d isn't in this object stream", num)
+		}
+	}
+
+	end := len(objStm.data)
+	if index+1 < len(objStm.offsets) && objStm.offsets[index+1] >= objStm.offsets[index] {
+		end = objStm.offsets[index+1]
+	}
+	obj, err := doc.parseDirect(objStm.data[objStm.offsets[index]:end], 0)
+	if err != nil {
+		// offsets inside decoded data don't mean anything in the file
+		if pdfErr, ok := err.(*Error); ok {
+			pdfErr.Offset = objStm.stream.offset
+			pdfErr.Object = num
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Objects in object streams always have generation 0.
+func (doc *Document) compressedObject(ref Ref, entry xrefEntry) (Object, error) {
+	if ref.Gen != 0 {
+		return Null{}, nil
+	}
+	objStm, err := doc.objectStream(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	return objStm.object(doc, int(entry.gen), ref.Num)
+}
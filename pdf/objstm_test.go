@@ -0,0 +1,201 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+)
+
+func deflate(data []byte) []byte {
+	buf := new(bytes.Buffer)
+	z := zlib.NewWriter(buf)
+	z.Write(data)
+	z.Close()
+	return buf.Bytes()
+}
+
+// Build a PDF whose objects, numbered from 1, are all compressed in object stream N+1.
+func buildObjStmPDF(objects ...string) []byte {
+	return buildObjStmPDFWith("/FlateDecode", false, objects...)
+}
+
+// Like buildObjStmPDF, with the object stream's /Filter value,
+// and if selfCompressed, an xref stream that says the object stream is inside itself.
+func buildObjStmPDFWith(filter string, selfCompressed bool, objects ...string) []byte {
+	header := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+	for i, obj := range objects {
+		fmt.Fprintf(header, "%d %d ", i+1, body.Len())
+		body.WriteString(obj + "\n")
+	}
+	data := deflate(append(header.Bytes(), body.Bytes()...))
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.5\n")
+	objStmNum := len(objects) + 1
+	objStmOffset := buf.Len()
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter %s /Length %d >>\nstream\n",
+		objStmNum, len(objects), header.Len(), filter, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	xref := buf.Len()
+	rows := new(bytes.Buffer)
+	rows.Write([]byte{0, 0, 0, 0xff})
+	for i := range objects {
+		rows.Write([]byte{2, 0, byte(objStmNum), byte(i)})
+	}
+	if selfCompressed {
+		rows.Write([]byte{2, 0, byte(objStmNum), byte(len(objects))})
+	} else {
+		rows.Write([]byte{1, byte(objStmOffset >> 8), byte(objStmOffset), 0})
+	}
+	rows.Write([]byte{1, byte(xref >> 8), byte(xref), 0})
+	xrefData := deflate(rows.Bytes())
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /Length %d >>\nstream\n",
+		objStmNum+1, objStmNum+2, len(xrefData))
+	buf.Write(xrefData)
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+func TestOpen_ObjStm(t *testing.T) {
+	doc, err := Parse(buildObjStmPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Rotate 90 >>",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 || pages[0]["Rotate"] != Int(90) {
+		t.Errorf("Expected page 3 from the object stream, got %v", pages)
+	}
+	if len(doc.objStreams) != 1 {
+		t.Errorf("Expected the object stream to be decoded once, got %d", len(doc.objStreams))
+	}
+}
+
+// Scanning a damaged file still finds objects inside object streams
+func TestOpen_ObjStmReconstruct(t *testing.T) {
+	buf := buildObjStmPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+	)
+	buf = bytes.Replace(buf, []byte("startxref\n"), []byte("startxref\n9"), 1)
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Pages(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Object streams that need themselves to be decoded are errors, not endless recursion
+func TestOpen_ObjStmSelfReference(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"compressed in itself", buildObjStmPDFWith("/FlateDecode", true,
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [] /Count 0 >>",
+		)},
+		{"filter in itself", buildObjStmPDFWith("3 0 R", false,
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [] /Count 0 >>",
+			"/FlateDecode",
+		)},
+	}
+	for _, test := range tests {
+		doc, err := Parse(test.buf)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		_, err = doc.Object(Ref{1, 0})
+		if _, ok := err.(*Error); !ok {
+			t.Errorf("%s: expected an error, got %v", test.name, err)
+		}
+		if len(doc.decodingObjStreams) != 0 {
+			t.Errorf("%s: expected no object streams left decoding, got %v", test.name, doc.decodingObjStreams)
+		}
+	}
+}
+
+// An uncompressed object stream holding objects with the given numbers
+func objStmObject(num int, nums []int, bodies []string) string {
+	header := new(bytes.Buffer)
+	body := new(bytes.Buffer)
+	for i, objNum := range nums {
+		fmt.Fprintf(header, "%d %d ", objNum, body.Len())
+		body.WriteString(bodies[i] + "\n")
+	}
+	data := header.String() + body.String()
+	return fmt.Sprintf("%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		num, len(nums), header.Len(), len(data), data)
+}
+
+// Scanning a damaged file applies object streams and xref streams in file order,
+// so objects from later updates replace earlier ones, wherever they're stored.
+func TestOpen_ObjStmReconstructOrder(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		buf := new(bytes.Buffer)
+		buf.WriteString("%PDF-1.5\n")
+		buf.WriteString(objStmObject(10, []int{1, 2, 3, 4}, []string{
+			"<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [] /Count 0 >>", "(first 3)", "(first 4)",
+		}))
+		buf.WriteString("11 0 obj\n<< /Type /XRef /Size 12 /Root 1 0 R /Revision 1 /Length 0 >>\nstream\n\nendstream\nendobj\n")
+		buf.WriteString("4 0 obj\n(top 4)\nendobj\n")
+		buf.WriteString("5 0 obj\n(top 5)\nendobj\n")
+		buf.WriteString(objStmObject(12, []int{3, 5}, []string{"(second 3)", "(second 5)"}))
+		buf.WriteString("13 0 obj\n<< /Type /XRef /Size 14 /Root 1 0 R /Revision 2 /Length 0 >>\nstream\n\nendstream\nendobj\n")
+		buf.WriteString("startxref\n9\n%%EOF\n")
+
+		doc, err := Parse(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			ref      Ref
+			expected Object
+		}{
+			{Ref{3, 0}, String("second 3")},
+			{Ref{4, 0}, String("top 4")},
+			{Ref{5, 0}, String("second 5")},
+		}
+		for _, test := range tests {
+			obj, err := doc.Object(test.ref)
+			if err != nil || obj != test.expected {
+				t.Errorf("Expected %v to be %v, got %v, %v", test.ref, test.expected, obj, err)
+			}
+		}
+		if len(doc.Revisions) != 2 || doc.Revisions[1].Trailer["Revision"] != Int(2) {
+			t.Errorf("Expected 2 revisions in file order, got %v", doc.Revisions)
+		}
+	}
+}
+
+// Header counts and offsets too large to add or double are errors, not panics
+func TestDecodeObjectStream_Overflow(t *testing.T) {
+	tests := []struct {
+		name string
+		n    Int
+		data string
+	}{
+		{"huge /N", 4611686018427387904, "1 0 (one)"},
+		{"huge offset", 1, "1 9223372036854775807 (one)"},
+	}
+	for _, test := range tests {
+		first := len(test.data) - len("(one)")
+		stream := newStream(Dict{"Type": Name("ObjStm"), "N": test.n, "First": Int(first)}, []byte(test.data))
+		if _, err := decodeObjectStream(stream); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -1,90 +1,27 @@
-package main
+package pdf
 
 import (
-	"fmt"
+	"io"
 )
 
 type WordHandler interface {
 	Connect(p *ParserState)
-	Word(word string)
-}
-
-type Document struct {
-	Objects map[Ref]PDFValue
-	// linearized PDFs and incrementally updated PDFs have multiple trailers
-	Trailers []PDFMap
-}
-
-// An object reference can be used almost anywhere in a PDF
-type PDFValue interface {
-	Val() interface{}
-}
-
-type PDFNull struct{}
-
-func (o PDFNull) Val() interface{} {
-	return nil
-}
-
-type PDFBool bool
-
-func (o PDFBool) Val() interface{} {
-	return bool(o)
-}
-
-type PDFInt int64
-
-func (o PDFInt) Val() interface{} {
-	return int64(o)
-}
-
-type PDFFloat float64
-
-func (o PDFFloat) Val() interface{} {
-	return float64(o)
-}
-
-type PDFString string
-
-func (o PDFString) Val() interface{} {
-	return string(o)
-}
-
-type PDFList []PDFValue
-
-func (o PDFList) Val() interface{} {
-	return o
-}
-
-// TODO: I really hope map keys can't be references
-type PDFMap map[string]PDFValue
-
-func (o PDFMap) Val() interface{} {
-	return o
-}
-
-type Ref struct {
-	Doc      *Document
-	Num, Gen int64
-}
-
-func (r Ref) String() string {
-	return fmt.Sprintf("Ref %d %d", r.Num, r.Gen)
-}
-
-func (r Ref) Val() interface{} {
-	if obj, ok := r.Doc.Objects[r]; ok {
-		return obj.Val()
-	}
-	panic(fmt.Errorf("Missing object reference: %s", r))
-	// TODO: PDF standard says dangling refs should be treated as nulls, not errors
+	Word(word string) error
 }
 
 type ParserState struct {
-	tokens       []Token
-	pos          int
-	stack        []interface{}
+	tokenizer *Tokenizer
+	// the current token, and where it starts
+	token       Token
+	tokenOffset int64
+	stack       []interface{}
+	// where each stack item starts
+	offsets      []int64
 	contextStack []int
+	// number of the object being parsed, for errors
+	object int64
+	// set by a WordHandler to stop before the end of the input
+	done bool
 	// TODO: context stack doesn't check the kind of context (map, list, object)
 }
 
@@ -93,59 +30,98 @@ func (p *ParserState) len() int {
 }
 
 func (p *ParserState) push(o interface{}) {
+	p.pushAt(o, p.tokenOffset)
+}
+
+func (p *ParserState) pushAt(o interface{}, offset int64) {
 	p.stack = append(p.stack, o)
+	p.offsets = append(p.offsets, offset)
 }
 
 func (p *ParserState) dropFrom(index int) {
 	p.stack = p.stack[:index]
+	p.offsets = p.offsets[:index]
+}
+
+// Offset of the stack item at index, or of the current token if there's no such item
+func (p *ParserState) offsetAt(index int) int64 {
+	if index < len(p.offsets) {
+		return p.offsets[index]
+	}
+	return p.tokenOffset
+}
+
+// Read the next token and ignore it.
+func (p *ParserState) skip() error {
+	_, _, err := p.tokenizer.Next()
+	if err == io.EOF {
+		return nil
+	}
+	return err
 }
 
 func (p *ParserState) ctxPush(index int) {
 	p.contextStack = append(p.contextStack, index)
 }
 
-func (p *ParserState) ctxPop() int {
+func (p *ParserState) ctxPop() (int, error) {
 	ctxEnd := len(p.contextStack) - 1
+	if ctxEnd < 0 {
+		return 0, p.errorf("Unbalanced %s", p.token)
+	}
 	index := p.contextStack[ctxEnd]
 	p.contextStack = p.contextStack[:ctxEnd]
-	return index
+	return index, nil
+}
+
+// An error at the current token
+func (p *ParserState) errorf(format string, args ...interface{}) error {
+	return errorf(p.tokenOffset, p.object, format, args...)
 }
 
-func parse(tokens []Token, wh WordHandler) {
+// The object at a stack index, if it's an Object at all.
+func (p *ParserState) objectAt(index int) (Object, error) {
+	if obj, ok := p.stack[index].(Object); ok {
+		return obj, nil
+	}
+	return nil, p.errorf("Expected an object, got %v", p.stack[index])
+}
+
+// Parse tokens until the end of the input, or until wh says it's done.
+func parse(t *Tokenizer, wh WordHandler) error {
 	p := &ParserState{
-		tokens: tokens,
+		tokenizer: t,
 	}
 	wh.Connect(p)
 
-	// on panic, print stack and re-panic
-	defer func() {
-		e := recover()
-		if e != nil {
-			if len(p.stack) > 0 {
-				fmt.Printf("stack = %v\n", p.stack)
-				fmt.Printf("contextStack = %v\n", p.contextStack)
-			}
-			panic(e)
+	for !p.done {
+		t.object = p.object
+		token, offset, err := t.Next()
+		if err == io.EOF {
+			break
 		}
-	}()
+		if err != nil {
+			return err
+		}
+		p.token = token
+		p.tokenOffset = offset
 
-	for ; p.pos < len(tokens); p.pos++ {
-		switch token := tokens[p.pos].(type) {
+		switch token := token.(type) {
 
 		case *MetaToken:
 			// TODO: drop comments for now
 
 		// wrap primitives
 		case *IntToken:
-			p.push(PDFInt(token.val))
+			p.push(Int(token.val))
 		case *FloatToken:
-			p.push(PDFFloat(token.val))
+			p.push(Float(token.val))
 		case *SymbolToken:
-			p.push(PDFString(token.val))
+			p.push(Name(token.val))
 		case *StringToken:
-			p.push(PDFString(token.val))
+			p.push(String(token.val))
 		case *HexToken:
-			p.push(PDFString(token.buf))
+			p.push(String(token.buf))
 
 		case *StreamToken:
 			// leave as is
@@ -157,59 +133,74 @@ func parse(tokens []Token, wh WordHandler) {
 			case "[":
 				p.ctxPush(p.len())
 			case "]":
-				start := p.ctxPop()
-				length := p.len() - start
-				if length < 0 {
-					panic(fmt.Errorf("Not enough items for list"))
+				start, err := p.ctxPop()
+				if err != nil {
+					return err
 				}
 
-				list := PDFList{}
-				for i := start + 1; i < p.len(); i++ {
-					list = append(list, p.stack[i].(PDFValue))
+				list := Array{}
+				for i := start; i < p.len(); i++ {
+					obj, err := p.objectAt(i)
+					if err != nil {
+						return err
+					}
+					list = append(list, obj)
 				}
 
+				offset := p.offsetAt(start)
 				p.dropFrom(start)
-				p.push(list)
+				p.pushAt(list, offset)
 
 			// map
 			case "<<":
 				p.ctxPush(p.len())
 			case ">>":
-				start := p.ctxPop()
-				length := p.len() - start
-				if length < 2 {
-					panic(fmt.Errorf("Not enough items for map"))
+				start, err := p.ctxPop()
+				if err != nil {
+					return err
 				}
+				length := p.len() - start
 				if length%2 != 0 {
-					panic(fmt.Errorf("Map needs an even number of items"))
+					return p.errorf("Map needs an even number of items")
 				}
 
-				m := PDFMap{}
+				m := Dict{}
 				for i := start; i < p.len(); i += 2 {
-					key := p.stack[i].(PDFValue).Val().(string)
-					m[key] = p.stack[i+1].(PDFValue)
+					key, ok := p.stack[i].(Name)
+					if !ok {
+						return p.errorf("Map key must be a name, got %v", p.stack[i])
+					}
+					value, err := p.objectAt(i + 1)
+					if err != nil {
+						return err
+					}
+					m[string(key)] = value
 				}
 
+				offset := p.offsetAt(start)
 				p.dropFrom(start)
-				p.push(m)
+				p.pushAt(m, offset)
 
 			default:
-				panic(fmt.Errorf("Unknown operator %s", token.op))
+				return p.errorf("Unknown operator %s", token.op)
 			}
 
 		case *WordToken:
 			switch token.val {
 			// more primitives
 			case "null":
-				p.push(PDFNull{})
+				p.push(Null{})
 			case "false":
-				p.push(PDFBool(false))
+				p.push(Bool(false))
 			case "true":
-				p.push(PDFBool(true))
+				p.push(Bool(true))
 
 			default:
-				wh.Word(token.val)
+				if err := wh.Word(token.val); err != nil {
+					return err
+				}
 			}
 		}
 	}
+	return nil
 }
@@ -1,10 +1,11 @@
-package main
+package pdf
 
 import ()
 
+// One content stream operator with its operands, such as: /F1 12 Tf
 type Command struct {
 	Word     string
-	Operands []interface{}
+	Operands []Object
 }
 
 type ContentParser struct {
@@ -14,15 +15,26 @@ type ContentParser struct {
 
 func (cp *ContentParser) Connect(p *ParserState) {
 	cp.p = p
+	p.tokenizer.inlineImages = true
 }
 
-func (cp *ContentParser) Word(word string) {
+func (cp *ContentParser) Word(word string) error {
 	command := Command{
 		Word: word,
 	}
-	for _, operand := range cp.p.stack {
+	for i := range cp.p.stack {
+		// inline image data is the only operand of EI
+		if token, ok := cp.p.stack[i].(*StreamToken); ok {
+			command.Operands = append(command.Operands, String(token.buf))
+			continue
+		}
+		operand, err := cp.p.objectAt(i)
+		if err != nil {
+			return err
+		}
 		command.Operands = append(command.Operands, operand)
 	}
 	cp.p.dropFrom(0)
 	cp.Commands = append(cp.Commands, command)
+	return nil
 }
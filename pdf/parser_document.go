@@ -1,31 +1,71 @@
-package main
+package pdf
 
-import (
-	"fmt"
-)
+import ()
 
 type DocumentParser struct {
 	p   *ParserState
-	Doc Document
+	Doc *Document
+	// where parsed objects go; Doc.Objects if nil
+	Objects map[Ref]Object
+	// where the current object starts
+	objOffset int64
+	// how many objects have been parsed, and the last one
+	count int
+	last  Ref
+	// stop after one indirect object
+	single bool
+	// if not nil, where each object was last defined
+	offsets map[Ref]int64
+	// stack length at the start of an xref table, or -1 if not in one
+	xrefStart int
 }
 
+// Objects are added to Doc, or to a new Document if Doc is nil.
 func (dp *DocumentParser) Connect(p *ParserState) {
 	dp.p = p
-	dp.Doc = Document{
-		Objects: map[Ref]PDFValue{},
+	if dp.Doc == nil {
+		dp.Doc = newDocument()
 	}
+	if dp.Objects == nil {
+		dp.Objects = dp.Doc.Objects
+	}
+	dp.xrefStart = -1
+	p.tokenizer.streamLength = dp.streamLength
+}
+
+// The /Length of the stream whose dictionary is on top of the stack.
+func (dp *DocumentParser) streamLength() (int64, bool) {
+	if dp.p.len() == 0 {
+		return 0, false
+	}
+	attrs, ok := dp.p.stack[dp.p.len()-1].(Dict)
+	if !ok {
+		return 0, false
+	}
+	switch length := attrs["Length"].(type) {
+	case Int:
+		return int64(length), true
+	case Ref:
+		return dp.Doc.streamLength(length)
+	}
+	return 0, false
 }
 
 // Read an object number and generation from a given index.
-func (dp *DocumentParser) parseRef(index int) Ref {
-	return Ref{
-		Num: dp.p.stack[index].(PDFInt).Val().(int64),
-		Gen: dp.p.stack[index+1].(PDFInt).Val().(int64),
-		Doc: &dp.Doc,
+func (dp *DocumentParser) parseRef(index int) (Ref, error) {
+	num, numOk := dp.p.stack[index].(Int)
+	gen, genOk := dp.p.stack[index+1].(Int)
+	if !numOk || !genOk {
+		return Ref{}, dp.p.errorf("Expected object number and generation, got %v %v",
+			dp.p.stack[index], dp.p.stack[index+1])
 	}
+	return Ref{
+		Num: int64(num),
+		Gen: int64(gen),
+	}, nil
 }
 
-func (dp *DocumentParser) Word(word string) {
+func (dp *DocumentParser) Word(word string) error {
 	switch word {
 	case "stream":
 		fallthrough
@@ -36,81 +76,126 @@ func (dp *DocumentParser) Word(word string) {
 		// object reference: num gen R
 		start := dp.p.len() - 2
 		if start < 0 {
-			panic(fmt.Errorf("Not enough items for object ref"))
+			return dp.p.errorf("Not enough items for object ref")
+		}
+		ref, err := dp.parseRef(start)
+		if err != nil {
+			return err
 		}
-		ref := dp.parseRef(start)
+		offset := dp.p.offsetAt(start)
 		dp.p.dropFrom(start)
-		dp.p.push(ref)
+		dp.p.pushAt(ref, offset)
 
 	case "obj":
 		// num gen obj attrs? value endobj
 		start := dp.p.len() - 2
 		if start < 0 {
-			panic(fmt.Errorf("Not enough items for object ref"))
+			return dp.p.errorf("Not enough items for object ref")
 		}
+		ref, err := dp.parseRef(start)
+		if err != nil {
+			return err
+		}
+		dp.p.object = ref.Num
+		dp.objOffset = dp.p.offsetAt(start)
 		dp.p.ctxPush(start)
 	case "endobj":
-		start := dp.p.ctxPop()
+		start, err := dp.p.ctxPop()
+		if err != nil {
+			return err
+		}
 		length := dp.p.len() - start
 		if length < 3 {
-			panic(fmt.Errorf("Not enough items for object"))
+			return dp.p.errorf("Not enough items for object")
 		}
 		if length > 4 {
-			panic(fmt.Errorf("Too many items for object"))
+			return dp.p.errorf("Too many items for object")
 		}
 
-		ref := dp.parseRef(start)
+		ref, err := dp.parseRef(start)
+		if err != nil {
+			return err
+		}
 
-		var obj PDFValue
+		var obj Object
 		if length > 3 {
 			// object is a stream with an attribute map
-			obj = Stream{
-				attrs: dp.p.stack[start+2].(PDFMap),
-				buf:   dp.p.stack[start+3].(*StreamToken).buf,
+			attrs, attrsOk := dp.p.stack[start+2].(Dict)
+			token, tokenOk := dp.p.stack[start+3].(*StreamToken)
+			if !attrsOk || !tokenOk {
+				return dp.p.errorf("Expected stream dictionary and data")
+			}
+			obj = &Stream{
+				Attrs:  attrs,
+				Raw:    token.buf,
+				doc:    dp.Doc,
+				ref:    ref,
+				offset: dp.objOffset,
 			}
 		} else {
 			// object is a map, list, scalar, or ref
-			obj = dp.p.stack[start+2].(PDFValue)
+			obj, err = dp.p.objectAt(start + 2)
+			if err != nil {
+				return err
+			}
 		}
 
 		// add object to document object map
 		dp.p.dropFrom(start)
-		dp.Doc.Objects[ref] = obj
+		dp.p.object = 0
+		dp.Objects[ref] = obj
+		if dp.offsets != nil {
+			dp.offsets[ref] = dp.objOffset
+		}
+		dp.count++
+		dp.last = ref
+		if dp.single {
+			dp.p.done = true
+		}
 
 	case "xref":
-		// look ahead to discover the number of xref entries
-		xrefEntryCountIdx := dp.p.pos + 2
-		if xrefEntryCountIdx >= len(dp.p.tokens) {
-			panic(fmt.Errorf("xref table truncated by EOF"))
-		}
-		var xrefEntryCount int
-		if xrefEntryCountToken, ok := dp.p.tokens[xrefEntryCountIdx].(*IntToken); ok {
-			xrefEntryCount = int(xrefEntryCountToken.val)
-		} else {
-			panic(fmt.Errorf("Wrong type for xref entry count"))
+		// the xref table is useless if reading the entire file,
+		// so its numbers are dropped when the trailer starts
+		dp.xrefStart = dp.p.len()
+	case "f", "n":
+		if dp.xrefStart < 0 {
+			return dp.p.errorf("Unknown word %s", word)
 		}
-		// skip over the xref table, which is useless if reading the entire file
-		dp.p.pos += 2 + xrefEntryCount*3
 
 	case "trailer":
 		// trailer attrs startxref xref_offset %%EOF
+		if dp.xrefStart >= 0 {
+			dp.p.dropFrom(dp.xrefStart)
+			dp.xrefStart = -1
+		}
 		dp.p.ctxPush(dp.p.len())
 	case "startxref":
-		start := dp.p.ctxPop()
+		if len(dp.p.contextStack) == 0 {
+			// after an xref stream, which has no trailer keyword
+			return dp.p.skip()
+		}
+		start, err := dp.p.ctxPop()
+		if err != nil {
+			return err
+		}
 		length := dp.p.len() - start
 		if length < 1 {
-			panic(fmt.Errorf("Not enough items for trailer"))
+			return dp.p.errorf("Not enough items for trailer")
+		}
+		attrs, ok := dp.p.stack[start].(Dict)
+		if !ok {
+			return dp.p.errorf("Expected trailer dictionary, got %v", dp.p.stack[start])
 		}
-		attrs := dp.p.stack[start].(PDFMap)
 
-		// add to document trailers list
-		dp.Doc.Trailers = append(dp.Doc.Trailers, attrs)
+		// each trailer ends a revision
+		dp.Doc.Revisions = append(dp.Doc.Revisions, &Revision{XrefOffset: -1, Trailer: attrs})
 		dp.p.dropFrom(start)
 
 		// skip over the xref table offset
-		dp.p.pos++
+		return dp.p.skip()
 
 	default:
-		panic(fmt.Errorf("Unknown word %s", word))
+		return dp.p.errorf("Unknown word %s", word)
 	}
+	return nil
 }
@@ -0,0 +1,96 @@
+package pdf
+
+import (
+	"sort"
+)
+
+// One save of a document. Incremental updates append a revision
+// with new and changed objects, a cross-reference section for them,
+// and a trailer, leaving everything before them untouched.
+type Revision struct {
+	// Offset of the revision's cross-reference section, or -1 if the file had to be scanned
+	XrefOffset int64
+	Trailer    Dict
+	// entries from this revision's section only
+	xref map[int64]xrefEntry
+}
+
+// Numbers of the objects this revision adds, changes, or frees, in order.
+func (rev *Revision) Objects() []int64 {
+	nums := make([]int64, 0, len(rev.xref))
+	for num := range rev.xref {
+		nums = append(nums, num)
+	}
+	sort.Sort(int64s(nums))
+	return nums
+}
+
+type int64s []int64
+
+func (nums int64s) Len() int {
+	return len(nums)
+}
+
+func (nums int64s) Swap(i, j int) {
+	nums[i], nums[j] = nums[j], nums[i]
+}
+
+func (nums int64s) Less(i, j int) bool {
+	return nums[i] < nums[j]
+}
+
+// Add entries for objects this revision doesn't already have.
+// Hybrid files split a revision between a table and an xref stream,
+// and the table wins.
+func (rev *Revision) merge(entries map[int64]xrefEntry) {
+	for num, entry := range entries {
+		if _, ok := rev.xref[num]; !ok {
+			rev.xref[num] = entry
+		}
+	}
+}
+
+// The revision the document is being read as of.
+func (doc *Document) Revision() *Revision {
+	if len(doc.Revisions) == 0 {
+		return nil
+	}
+	return doc.Revisions[len(doc.Revisions)-1]
+}
+
+// The trailer of the revision the document is being read as of.
+func (doc *Document) Trailer() Dict {
+	if rev := doc.Revision(); rev != nil {
+		return rev.Trailer
+	}
+	return Dict{}
+}
+
+// The latest cross-reference entry for an object number, searching from the newest revision back.
+// The newest revision that mentions an object decides what it is,
+// even if that's a free entry and an older revision had the object in use.
+func (doc *Document) xrefEntry(num int64) (xrefEntry, bool) {
+	for i := len(doc.Revisions) - 1; i >= 0; i-- {
+		if entry, ok := doc.Revisions[i].xref[num]; ok {
+			return entry, true
+		}
+	}
+	return xrefEntry{}, false
+}
+
+// The document as it was when revision i was saved, counting from 0 for the original.
+// The returned Document shares the file with doc but has its own objects,
+// so objects changed by later updates appear as they were.
+func (doc *Document) AtRevision(i int) (*Document, error) {
+	if doc.scanned {
+		return nil, errorf(-1, 0, "Revisions aren't available for a file without usable cross-reference sections")
+	}
+	if i < 0 || i >= len(doc.Revisions) {
+		return nil, errorf(-1, 0, "No revision %d; the document has %d", i, len(doc.Revisions))
+	}
+	view := newDocument()
+	view.r = doc.r
+	view.size = doc.size
+	view.Revisions = doc.Revisions[: i+1 : i+1]
+	return view, nil
+}
@@ -0,0 +1,101 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// An entry in an incremental update: a new body for an object, or a free entry if body is "".
+type update struct {
+	ref  Ref
+	body string
+}
+
+// Append an incremental update to a PDF built by buildPDF or appendUpdate,
+// with one single-entry xref subsection per update.
+func appendUpdate(buf []byte, updates ...update) []byte {
+	prev := bytes.LastIndex(buf, []byte("\nxref\n")) + 1
+	offsets := []int{}
+	for _, u := range updates {
+		offsets = append(offsets, len(buf))
+		if u.body != "" {
+			buf = append(buf, fmt.Sprintf("%d %d obj\n%s\nendobj\n", u.ref.Num, u.ref.Gen, u.body)...)
+		}
+	}
+	xref := len(buf)
+	buf = append(buf, "xref\n"...)
+	for i, u := range updates {
+		if u.body == "" {
+			buf = append(buf, fmt.Sprintf("%d 1\n0000000000 %05d f \n", u.ref.Num, u.ref.Gen)...)
+		} else {
+			buf = append(buf, fmt.Sprintf("%d 1\n%010d %05d n \n", u.ref.Num, offsets[i], u.ref.Gen)...)
+		}
+	}
+	return append(buf, fmt.Sprintf("trailer\n<< /Size 10 /Root 1 0 R /Prev %d >>\nstartxref\n%d\n%%%%EOF\n", prev, xref)...)
+}
+
+func TestRevisions(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"(original 3)",
+		"(original 4)",
+		"(original 5)",
+	)
+	buf = appendUpdate(buf,
+		update{Ref{3, 0}, "(changed 3)"},
+		update{Ref{4, 1}, ""},
+	)
+	buf = appendUpdate(buf,
+		update{Ref{5, 1}, "(reused 5)"},
+	)
+
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Revisions) != 3 {
+		t.Fatalf("Expected 3 revisions, got %d", len(doc.Revisions))
+	}
+	if objects := fmt.Sprint(doc.Revisions[1].Objects()); objects != "[3 4]" {
+		t.Errorf("Expected revision 1 to touch [3 4], got %s", objects)
+	}
+
+	expected := []struct {
+		revision int
+		ref      Ref
+		obj      Object
+	}{
+		{2, Ref{3, 0}, String("changed 3")},
+		{2, Ref{4, 0}, Null{}},
+		{2, Ref{5, 0}, Null{}},
+		{2, Ref{5, 1}, String("reused 5")},
+		{1, Ref{3, 0}, String("changed 3")},
+		{1, Ref{4, 0}, Null{}},
+		{1, Ref{5, 0}, String("original 5")},
+		{1, Ref{5, 1}, Null{}},
+		{0, Ref{3, 0}, String("original 3")},
+		{0, Ref{4, 0}, String("original 4")},
+	}
+	for _, e := range expected {
+		view, err := doc.AtRevision(e.revision)
+		if err != nil {
+			t.Fatal(err)
+		}
+		obj, err := view.Object(e.ref)
+		if err != nil {
+			t.Errorf("Revision %d, %s: %v", e.revision, e.ref, err)
+		} else if obj != e.obj {
+			t.Errorf("Revision %d, %s: expected %v, got %v", e.revision, e.ref, e.obj, obj)
+		}
+	}
+
+	// the full document sees the latest revision
+	if obj, err := doc.Object(Ref{3, 0}); err != nil || obj != String("changed 3") {
+		t.Errorf("Expected the latest object 3, got %v, %v", obj, err)
+	}
+	if _, err := doc.AtRevision(3); err == nil {
+		t.Errorf("Expected an error for a revision that doesn't exist")
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package pdf
 
 import (
 	"bytes"
@@ -11,69 +11,336 @@ import (
 
 // PDF stream object. Bytes, but may be compressed or otherwise encoded.
 type Stream struct {
-	buf   []byte
-	attrs PDFMap
+	Attrs Dict
+	// Stream data as stored in the file
+	Raw []byte
+
+	doc    *Document
+	ref    Ref
+	offset int64
 }
 
-func (o Stream) String() string {
-	return fmt.Sprintf("Stream (%d bytes) %v", len(o.buf), o.attrs)
+func (o *Stream) String() string {
+	return fmt.Sprintf("Stream (%d bytes) %v", len(o.Raw), o.Attrs)
 }
 
-func (o Stream) Val() interface{} {
-	// check length
-	expected := o.attrs["Length"].Val().(int64)
-	actual := int64(len(o.buf))
-	if expected != actual {
-		panic(fmt.Errorf("Stream: expected length %d bytes, actual length %d bytes", expected, actual))
-	}
+func (o *Stream) Val() interface{} {
+	return o
+}
 
-	filterAttr, filtered := o.attrs["Filter"]
-	// fast path for unfiltered streams
-	if !filtered {
-		return o.buf
-	}
+func (o *Stream) errorf(format string, args ...interface{}) error {
+	return errorf(o.offset, o.ref.Num, format, args...)
+}
+
+// One step of a stream's filter chain.
+type Filter struct {
+	Name string
+	// decode parameters, empty if there aren't any
+	Parms Dict
+}
+
+// Image compression filters. Decode leaves data in these formats as it is,
+// for an image decoder that can use the filter's parameters.
+var ImageFilters = map[string]bool{
+	"DCTDecode":      true,
+	"JPXDecode":      true,
+	"CCITTFaxDecode": true,
+	"JBIG2Decode":    true,
+}
+
+// Inline images can use short filter names.
+var filterAbbreviations = map[string]string{
+	"AHx": "ASCIIHexDecode",
+	"A85": "ASCII85Decode",
+	"LZW": "LZWDecode",
+	"Fl":  "FlateDecode",
+	"RL":  "RunLengthDecode",
+	"CCF": "CCITTFaxDecode",
+	"DCT": "DCTDecode",
+}
 
-	// get a list of filter names
-	filterNames := []string{}
-	switch filterVal := filterAttr.Val().(type) {
-	case string:
-		filterNames = append(filterNames, filterVal)
-	case PDFList:
+// The stream's filters, in the order they're applied when decoding.
+func (o *Stream) Filters() ([]Filter, error) {
+	filterVal, err := o.doc.Resolve(o.Attrs["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	names := []Name{}
+	switch filterVal := filterVal.(type) {
+	case Null:
+	case Name:
+		names = append(names, filterVal)
+	case Array:
 		for _, filterValElem := range filterVal {
-			filterNames = append(filterNames, filterValElem.Val().(string))
+			filterName, err := o.doc.Resolve(filterValElem)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := filterName.(Name)
+			if !ok {
+				return nil, o.errorf("Stream: illegal filter: %v", filterValElem)
+			}
+			names = append(names, name)
 		}
 	default:
-		panic(fmt.Errorf("Stream: illegal filter: %T %s", filterVal, filterVal))
+		return nil, o.errorf("Stream: illegal filter: %T %v", filterVal, filterVal)
 	}
 
-	// build a filter chain
-	var r io.Reader = bytes.NewReader(o.buf)
-	for _, filterName := range filterNames {
-		switch filterName {
-		case "FlateDecode":
-			filter, err := zlib.NewReader(r)
-			if err != nil {
-				panic(err)
+	filters := []Filter{}
+	for i, name := range names {
+		parms, err := o.decodeParms(i)
+		if err != nil {
+			return nil, err
+		}
+		filter := Filter{Name: string(name), Parms: parms}
+		if long, ok := filterAbbreviations[filter.Name]; ok {
+			filter.Name = long
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// Stream data with all filters undone, except for a final image filter
+// (see ImageFilters), which is left for an image decoder.
+func (o *Stream) Decode() ([]byte, error) {
+	// Raw was read using /Length, and if that was wrong, the document has a warning
+	filters, err := o.Filters()
+	if err != nil {
+		return nil, err
+	}
+
+	data := o.Raw
+	for i, filter := range filters {
+		if ImageFilters[filter.Name] {
+			if i != len(filters)-1 {
+				return nil, o.errorf("Stream: %s must be the last filter", filter.Name)
 			}
-			defer func() {
-				if err := filter.Close(); err != nil {
-					panic(err)
-				}
-			}()
-			r = filter
-
-		case "ASCII85Decode":
-			r = ascii85.NewDecoder(r)
-
-		default:
-			panic(fmt.Errorf("Unknown filter: %s", filterName))
+			break
+		}
+		if data, err = o.decodeFilter(data, filter); err != nil {
+			return nil, err
 		}
 	}
+	return data, nil
+}
+
+// Undo one filter.
+func (o *Stream) decodeFilter(data []byte, filter Filter) ([]byte, error) {
+	var err error
+	switch filter.Name {
+	case "FlateDecode":
+		var r io.ReadCloser
+		if r, err = zlib.NewReader(bytes.NewReader(data)); err == nil {
+			data, err = ioutil.ReadAll(r)
+			r.Close()
+		}
+		if err == nil {
+			data, err = o.unpredict(data, filter.Parms)
+		}
+
+	case "LZWDecode":
+		if data, err = lzwDecode(data, intParm(filter.Parms, "EarlyChange", 1)); err == nil {
+			data, err = o.unpredict(data, filter.Parms)
+		}
+
+	case "ASCII85Decode":
+		data, err = ioutil.ReadAll(ascii85.NewDecoder(bytes.NewReader(trimASCII85(data))))
 
-	// read all data through the filter chain
-	contents, err := ioutil.ReadAll(r)
+	case "ASCIIHexDecode":
+		data, err = asciiHexDecode(data)
+
+	case "RunLengthDecode":
+		data, err = runLengthDecode(data)
+
+	case "Crypt":
+		// encrypted documents aren't supported, so only the identity filter makes sense
+		if name, ok := filter.Parms["Name"].(Name); ok && name != "Identity" {
+			return nil, o.errorf("Unsupported crypt filter %s", name)
+		}
+
+	default:
+		return nil, o.errorf("Unknown filter: %s", filter.Name)
+	}
 	if err != nil {
-		panic(err)
+		if _, ok := err.(*Error); ok {
+			return nil, err
+		}
+		return nil, o.errorf("%s: %v", filter.Name, err)
+	}
+	return data, nil
+}
+
+// Parameters for the filter at index i in the filter chain.
+// Filter arrays have matching DecodeParms arrays.
+func (o *Stream) decodeParms(i int) (Dict, error) {
+	parmsObj, err := o.doc.Resolve(o.Attrs["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+	if array, ok := parmsObj.(Array); ok {
+		if i >= len(array) {
+			return Dict{}, nil
+		}
+		if parmsObj, err = o.doc.Resolve(array[i]); err != nil {
+			return nil, err
+		}
+	}
+	switch parms := parmsObj.(type) {
+	case Dict:
+		return parms, nil
+	case Null:
+		return Dict{}, nil
+	}
+	return nil, o.errorf("Stream: illegal DecodeParms: %v", parmsObj)
+}
+
+// An integer decode parameter, or its default.
+func intParm(parms Dict, key string, def int) int {
+	if value, ok := parms[key].(Int); ok {
+		return int(value)
+	}
+	return def
+}
+
+// Most components per pixel a predictor can have. DeviceN allows 32 colorants.
+const maxPredictorColors = 32
+
+// Undo the predictor used by Flate- or LZW-compressed images and xref streams.
+// With PNG predictors, each row starts with a byte saying which PNG filter it was encoded with.
+// The TIFF predictor stores each component as the difference from the one to its left.
+func (o *Stream) unpredict(data []byte, parms Dict) ([]byte, error) {
+	predictor := intParm(parms, "Predictor", 1)
+	if predictor == 1 {
+		return data, nil
+	}
+	if predictor != 2 && predictor < 10 {
+		return nil, o.errorf("Unsupported predictor %d", predictor)
+	}
+	colors := intParm(parms, "Colors", 1)
+	bpc := intParm(parms, "BitsPerComponent", 8)
+	columns := intParm(parms, "Columns", 1)
+	if colors < 1 || colors > maxPredictorColors || columns < 1 {
+		return nil, o.errorf("Bad predictor parameters %v", parms)
+	}
+	switch bpc {
+	case 1, 2, 4, 8, 16:
+	default:
+		return nil, o.errorf("Unsupported bits per component %d for a predictor", bpc)
+	}
+	if len(data) == 0 {
+		return data, nil
+	}
+	// a row can't be longer than the data, which also keeps the arithmetic from overflowing
+	if columns > len(data)*8/(colors*bpc) {
+		return nil, o.errorf("Predictor rows of %d columns are longer than the %d bytes of data", columns, len(data))
+	}
+	if predictor == 2 {
+		return o.unpredictTIFF(data, colors, bpc, columns)
+	}
+	rowLen := (colors*bpc*columns + 7) / 8
+	// bytes per pixel, rounded up, for the filters that look left
+	bpp := (colors*bpc + 7) / 8
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		filterType := data[0]
+		row := make([]byte, rowLen)
+		copy(row, data[1:])
+		if len(data) > rowLen+1 {
+			data = data[rowLen+1:]
+		} else {
+			data = nil
+		}
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch filterType {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, o.errorf("Unknown PNG filter type %d", filterType)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// Undo the TIFF predictor, which works on components of any size,
+// and doesn't carry from one row to the next.
+func (o *Stream) unpredictTIFF(data []byte, colors int, bpc int, columns int) ([]byte, error) {
+	out := make([]byte, len(data))
+	copy(out, data)
+	rowLen := (colors*bpc*columns + 7) / 8
+	samples := colors * columns
+	mask := uint(1)<<uint(bpc) - 1
+	for start := 0; start+rowLen <= len(out); start += rowLen {
+		row := out[start : start+rowLen]
+		for i := colors; i < samples; i++ {
+			setSample(row, i, bpc, (sample(row, i, bpc)+sample(row, i-colors, bpc))&mask)
+		}
+	}
+	return out, nil
+}
+
+// Component i of a row of bpc-bit components.
+func sample(row []byte, i int, bpc int) uint {
+	switch bpc {
+	case 8:
+		return uint(row[i])
+	case 16:
+		return uint(row[2*i])<<8 | uint(row[2*i+1])
+	}
+	bit := i * bpc
+	shift := uint(8 - bpc - bit%8)
+	return uint(row[bit/8]>>shift) & (1<<uint(bpc) - 1)
+}
+
+func setSample(row []byte, i int, bpc int, value uint) {
+	switch bpc {
+	case 8:
+		row[i] = byte(value)
+		return
+	case 16:
+		row[2*i] = byte(value >> 8)
+		row[2*i+1] = byte(value)
+		return
+	}
+	bit := i * bpc
+	shift := uint(8 - bpc - bit%8)
+	mask := byte(1<<uint(bpc)-1) << shift
+	row[bit/8] = row[bit/8]&^mask | byte(value)<<shift&mask
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
 	}
-	return contents
+	return x
 }
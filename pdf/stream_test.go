@@ -0,0 +1,95 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// Decode a stream, stored as object 3 of a document whose object 4 is the number 4.
+func readStream(t *testing.T, dict string, data string) (*Document, []byte) {
+	doc, err := Parse(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		fmt.Sprintf("%s\nstream\n%s\nendstream", dict, data),
+		"4",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := doc.ResolveStream(Ref{3, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := stream.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc, decoded
+}
+
+var streamLengthTests = []struct {
+	name     string
+	dict     string
+	data     string
+	expected string
+	warnings int
+}{
+	{"direct", "<< /Length 4 >>", "data", "data", 0},
+	{"indirect", "<< /Length 4 0 R >>", "data", "data", 0},
+	{"contains endstream", "<< /Length 13 >>", "a\nendstream\nb", "a\nendstream\nb", 0},
+	{"trailing whitespace", "<< /Length 5 >>", "data\n", "data\n", 0},
+	{"nested dictionaries", "<< /DecodeParms << /Length 9 >> /Length 4 /Filter [] >>", "data", "data", 0},
+	{"missing", "<< >>", "data", "data", 0},
+	{"missing with trailing whitespace", "<< >>", "data\x00 \n\t", "data\x00 \n\t", 0},
+	{"missing with CRLF", "<< >>", "data\n\r", "data\n", 0},
+	{"missing with space before endstream", "<< >>", "data\n ", "data\n ", 0},
+	{"too long", "<< /Length 40 >>", "data", "data", 1},
+	{"too short", "<< /Length 2 >>", "data", "data", 1},
+	{"indirect wrong", "<< /Length 4 0 R >>", "more data", "more data", 1},
+}
+
+func TestStream_Length(t *testing.T) {
+	for _, test := range streamLengthTests {
+		doc, data := readStream(t, test.dict, test.data)
+		if string(data) != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, data)
+		}
+		if len(doc.Warnings) != test.warnings {
+			t.Errorf("%s: expected %d warnings, got %v", test.name, test.warnings, doc.Warnings)
+		}
+	}
+}
+
+// Binary data can start with whitespace and contain endstream
+func TestTokenizer_StreamLength(t *testing.T) {
+	data := []byte("\n\x00 endstream\r\n")
+	buf := []byte("stream\r\n")
+	buf = append(buf, data...)
+	buf = append(buf, "\nendstream"...)
+	tokenizer := NewTokenizer(bytes.NewReader(buf))
+	tokenizer.streamLength = func() (int64, bool) {
+		return int64(len(data)), true
+	}
+	expected := []struct {
+		token  string
+		offset int64
+	}{
+		{`Word "stream"`, 0},
+		{fmt.Sprintf("Stream (%d bytes)", len(data)), 8},
+		{`Word "endstream"`, int64(9 + len(data))},
+	}
+	for _, e := range expected {
+		token, offset, err := tokenizer.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.String() != e.token || offset != e.offset {
+			t.Errorf("Expected %s at %d, got %v at %d", e.token, e.offset, token, offset)
+		}
+	}
+	if _, _, err := tokenizer.Next(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v", err)
+	}
+}
@@ -0,0 +1,409 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"unicode"
+)
+
+// An affine transformation [a b c d e f], which maps (x, y) to (ax + cy + e, bx + dy + f).
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// m followed by n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(tx, ty float64) matrix {
+	return matrix{1, 0, 0, 1, tx, ty}
+}
+
+// The parts of the graphics state that matter for text. q and Q save and restore all of them.
+type textState struct {
+	ctm       matrix
+	font      *font
+	fontSize  float64
+	charSpace float64
+	wordSpace float64
+	// horizontal scaling, as a fraction
+	scale   float64
+	leading float64
+	rise    float64
+}
+
+// Form XObjects can draw other forms, but not forever: a form isn't drawn inside itself,
+// nesting stops at maxFormDepth, and a page runs at most maxFormRuns forms in all,
+// so forms that each draw the next several times can't multiply.
+const (
+	maxFormDepth = 16
+	maxFormRuns  = 4096
+)
+
+// Gaps wider than this fraction of the font size are spaces between words.
+const wordGap = 0.15
+
+// Works out the text on a page from where each glyph is drawn.
+type textExtractor struct {
+	doc   *Document
+	out   bytes.Buffer
+	depth int
+	// object numbers of the forms being drawn, and how many forms have been run
+	forms    map[int64]bool
+	formRuns int
+	// where the last glyph ended, and the direction and size of its text, in device space
+	started bool
+	lastX   float64
+	lastY   float64
+	lastDir [2]float64
+	// a break seen at a glyph with no text, such as a bullet, waiting for the next text
+	pending textBreak
+}
+
+// What goes between two glyphs. Bigger breaks win.
+type textBreak int
+
+const (
+	noBreak textBreak = iota
+	spaceBreak
+	lineBreak
+)
+
+// The text on a page, in the order it's drawn.
+// Line breaks and spaces between words are inferred from where the text goes,
+// since PDF files don't always have space characters, and never have line breaks.
+func (doc *Document) PageText(page Dict) (string, error) {
+	resourcesObj, err := doc.PageAttr(page, "Resources")
+	if err != nil {
+		return "", err
+	}
+	resources, _ := doc.Resolve(resourcesObj)
+	resourcesDict, _ := resources.(Dict)
+	contents, err := doc.PageContents(page)
+	if err != nil {
+		return "", err
+	}
+	x := &textExtractor{doc: doc}
+	if err := x.run(contents, resourcesDict, identity); err != nil {
+		return "", err
+	}
+	if x.started {
+		x.out.WriteByte('\n')
+	}
+	return x.out.String(), nil
+}
+
+// A named resource, such as a font, or nil if there isn't one.
+func (x *textExtractor) resource(resources Dict, category string, name Name) (Object, error) {
+	categoryObj, err := x.doc.Resolve(resources[category])
+	if err != nil {
+		return nil, err
+	}
+	categoryDict, _ := categoryObj.(Dict)
+	return categoryDict[string(name)], nil
+}
+
+// The last n operands as numbers, if they are numbers.
+func numberOperands(operands []Object, n int) ([]float64, bool) {
+	if len(operands) < n {
+		return nil, false
+	}
+	numbers := make([]float64, n)
+	for i, operand := range operands[len(operands)-n:] {
+		var ok bool
+		if numbers[i], ok = number(operand); !ok {
+			return nil, false
+		}
+	}
+	return numbers, true
+}
+
+// The last operand as a string.
+func stringOperand(operands []Object) ([]byte, bool) {
+	if len(operands) == 0 {
+		return nil, false
+	}
+	s, ok := operands[len(operands)-1].(String)
+	return []byte(s), ok
+}
+
+// Interpret a content stream, collecting its text.
+func (x *textExtractor) run(contents []byte, resources Dict, ctm matrix) error {
+	commands, err := ParseContent(contents)
+	if err != nil {
+		return err
+	}
+	state := textState{ctm: ctm, font: fallbackFont(), scale: 1}
+	saved := []textState{}
+	tm, tlm := identity, identity
+	nextLine := func(tx, ty float64) {
+		tlm = translate(tx, ty).mul(tlm)
+		tm = tlm
+	}
+
+	for _, command := range commands {
+		ops := command.Operands
+		switch command.Word {
+		case "q":
+			saved = append(saved, state)
+		case "Q":
+			if len(saved) > 0 {
+				state = saved[len(saved)-1]
+				saved = saved[:len(saved)-1]
+			}
+		case "cm":
+			if m, ok := numberOperands(ops, 6); ok {
+				state.ctm = matrix{m[0], m[1], m[2], m[3], m[4], m[5]}.mul(state.ctm)
+			}
+
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			size, ok := numberOperands(ops, 1)
+			if !ok || len(ops) < 2 {
+				break
+			}
+			name, _ := ops[len(ops)-2].(Name)
+			state.font = x.font(resources, name)
+			state.fontSize = size[0]
+		case "Tc":
+			if n, ok := numberOperands(ops, 1); ok {
+				state.charSpace = n[0]
+			}
+		case "Tw":
+			if n, ok := numberOperands(ops, 1); ok {
+				state.wordSpace = n[0]
+			}
+		case "Tz":
+			if n, ok := numberOperands(ops, 1); ok {
+				state.scale = n[0] / 100
+			}
+		case "TL":
+			if n, ok := numberOperands(ops, 1); ok {
+				state.leading = n[0]
+			}
+		case "Ts":
+			if n, ok := numberOperands(ops, 1); ok {
+				state.rise = n[0]
+			}
+
+		case "Td":
+			if n, ok := numberOperands(ops, 2); ok {
+				nextLine(n[0], n[1])
+			}
+		case "TD":
+			if n, ok := numberOperands(ops, 2); ok {
+				state.leading = -n[1]
+				nextLine(n[0], n[1])
+			}
+		case "Tm":
+			if m, ok := numberOperands(ops, 6); ok {
+				tlm = matrix{m[0], m[1], m[2], m[3], m[4], m[5]}
+				tm = tlm
+			}
+		case "T*":
+			nextLine(0, -state.leading)
+
+		case "Tj":
+			if s, ok := stringOperand(ops); ok {
+				x.show(&state, &tm, s)
+			}
+		case "'":
+			nextLine(0, -state.leading)
+			if s, ok := stringOperand(ops); ok {
+				x.show(&state, &tm, s)
+			}
+		case "\"":
+			// aw ac string '
+			if len(ops) == 3 {
+				if n, ok := numberOperands(ops[:2], 2); ok {
+					state.wordSpace, state.charSpace = n[0], n[1]
+				}
+			}
+			nextLine(0, -state.leading)
+			if s, ok := stringOperand(ops); ok {
+				x.show(&state, &tm, s)
+			}
+		case "TJ":
+			if len(ops) == 0 {
+				break
+			}
+			array, _ := ops[len(ops)-1].(Array)
+			for _, elem := range array {
+				if s, ok := elem.(String); ok {
+					x.show(&state, &tm, []byte(s))
+				} else if n, ok := number(elem); ok {
+					// thousandths of a text space unit, backwards
+					tm = translate(-n/1000*state.fontSize*state.scale, 0).mul(tm)
+				}
+			}
+
+		case "Do":
+			if len(ops) == 0 {
+				break
+			}
+			name, _ := ops[len(ops)-1].(Name)
+			if err := x.form(resources, name, state.ctm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// The font for a Tf operator. Fonts that are missing or broken get the fallback font,
+// since a page's text shouldn't be lost to one bad font.
+func (x *textExtractor) font(resources Dict, name Name) *font {
+	obj, err := x.resource(resources, "Font", name)
+	if err == nil && obj == nil {
+		err = errorf(-1, 0, "No font named %s", name)
+	}
+	var f *font
+	if err == nil {
+		f, err = x.doc.font(obj)
+	}
+	if err != nil {
+		x.doc.Warnings = append(x.doc.Warnings, err)
+		return fallbackFont()
+	}
+	return f
+}
+
+// Collect the text of a form XObject, which is a content stream of its own.
+// Image XObjects don't have text.
+func (x *textExtractor) form(resources Dict, name Name, ctm matrix) error {
+	obj, err := x.resource(resources, "XObject", name)
+	if err != nil || obj == nil {
+		return err
+	}
+	form, num, err := x.doc.resolve(obj)
+	if err != nil {
+		return err
+	}
+	stream, ok := form.(*Stream)
+	if !ok {
+		return nil
+	}
+	if subtype, _ := stream.Attrs["Subtype"].(Name); subtype != "Form" {
+		return nil
+	}
+	if x.depth >= maxFormDepth || x.forms[num] || x.formRuns >= maxFormRuns {
+		return nil
+	}
+	if matrixObj, err := x.doc.ResolveArray(stream.Attrs["Matrix"]); err == nil {
+		if m, ok := numberOperands(matrixObj, 6); ok && len(matrixObj) == 6 {
+			ctm = matrix{m[0], m[1], m[2], m[3], m[4], m[5]}.mul(ctm)
+		}
+	}
+	// forms without their own resources use the page's
+	if formResources, err := x.doc.Resolve(stream.Attrs["Resources"]); err == nil {
+		if formResources, ok := formResources.(Dict); ok {
+			resources = formResources
+		}
+	}
+	contents, err := stream.Decode()
+	if err != nil {
+		return err
+	}
+	if x.forms == nil {
+		x.forms = map[int64]bool{}
+	}
+	x.forms[num] = true
+	x.formRuns++
+	x.depth++
+	defer func() {
+		x.depth--
+		delete(x.forms, num)
+	}()
+	return x.run(contents, resources, ctm)
+}
+
+// Show a string: add its text, and move the text matrix past each glyph.
+func (x *textExtractor) show(state *textState, tm *matrix, s []byte) {
+	for _, g := range state.font.glyphs(s) {
+		trm := matrix{state.fontSize * state.scale, 0, 0, state.fontSize, 0, state.rise}.mul(*tm).mul(state.ctm)
+		advance := g.width/1000*state.fontSize + state.charSpace
+		if g.wordSpace {
+			advance += state.wordSpace
+		}
+		*tm = translate(advance*state.scale, 0).mul(*tm)
+		end := matrix{1, 0, 0, 1, 0, state.rise}.mul(*tm).mul(state.ctm)
+		x.add(g.text, trm, end[4], end[5])
+	}
+}
+
+// Add a glyph's text, which starts at the origin of trm and ends at (endX, endY),
+// with a line break or space first if it's far enough from the last glyph.
+func (x *textExtractor) add(text string, trm matrix, endX float64, endY float64) {
+	// the baseline's direction, and the font's size, in device space
+	dir := [2]float64{trm[0], trm[1]}
+	if length := math.Hypot(dir[0], dir[1]); length > 0 {
+		dir[0], dir[1] = dir[0]/length, dir[1]/length
+	} else {
+		dir = [2]float64{1, 0}
+	}
+	size := math.Hypot(trm[2], trm[3])
+
+	if x.started {
+		dx, dy := trm[4]-x.lastX, trm[5]-x.lastY
+		along := dx*x.lastDir[0] + dy*x.lastDir[1]
+		across := dy*x.lastDir[0] - dx*x.lastDir[1]
+		switch {
+		case math.Abs(across) > size/2:
+			x.pending = lineBreak
+		case (along > size*wordGap || along < -size) && x.pending < spaceBreak:
+			x.pending = spaceBreak
+		}
+	}
+	if text != "" {
+		switch x.pending {
+		case lineBreak:
+			x.newline()
+		case spaceBreak:
+			x.space(text)
+		}
+		x.pending = noBreak
+		x.out.WriteString(text)
+	}
+	x.started = true
+	x.lastX, x.lastY = endX, endY
+	x.lastDir = dir
+}
+
+func (x *textExtractor) newline() {
+	x.trimSpace()
+	x.out.WriteByte('\n')
+}
+
+// A space, unless there's already one on either side.
+func (x *textExtractor) space(next string) {
+	buf := x.out.Bytes()
+	if len(buf) > 0 && unicode.IsSpace(rune(buf[len(buf)-1])) {
+		return
+	}
+	for _, r := range next {
+		if unicode.IsSpace(r) {
+			return
+		}
+		break
+	}
+	x.out.WriteByte(' ')
+}
+
+// Spaces at the ends of lines don't mean anything.
+func (x *textExtractor) trimSpace() {
+	buf := x.out.Bytes()
+	n := len(buf)
+	for n > 0 && (buf[n-1] == ' ' || buf[n-1] == '\t') {
+		n--
+	}
+	x.out.Truncate(n)
+}
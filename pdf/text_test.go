@@ -0,0 +1,172 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func streamObject(data string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(data), data)
+}
+
+const testToUnicode = `begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <4E2D> <0002> <6587> endbfchar
+endcmap`
+
+func TestPageText(t *testing.T) {
+	content := `BT /F1 12 Tf 72 700 Td
+[(\001\002\003\003\004) -300 (\005\004\006\003\007)] TJ
+0 -14 Td (plain) Tj
+14 TL (second) '
+0 -14 Td [(ke) -50 (rn)] TJ
+/F2 12 Tf 0 -14 Td <00010002> Tj
+ET
+BI /W 4 /H 1 /BPC 8 /CS /G ID EIEI EI
+q 1 0 0 1 0 -100 cm /X1 Do Q
+BT /F9 12 Tf 72 450 Td (missing) Tj ET`
+	form := "BT /F1 12 Tf 72 600 Td (form) Tj ET"
+	doc, err := Parse(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		// the page inherits its resources
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> /XObject << /X1 9 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		streamObject(content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [1 /H /e /l /o /W /r /d] >> >>",
+		"<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /DescendantFonts [7 0 R] /ToUnicode 8 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /DW 1000 >>",
+		streamObject(testToUnicode),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Form /Length %d >>\nstream\n%s\nendstream", len(form), form),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := doc.PageText(pages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "Hello World\nplain\nsecond\nkern\n中文\nform\nmissing\n"
+	if text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+	if len(doc.Warnings) != 1 {
+		t.Errorf("Expected a warning about the missing font, got %v", doc.Warnings)
+	}
+}
+
+func formObject(resources string, content string) string {
+	return fmt.Sprintf("<< /Type /XObject /Subtype /Form /Resources %s /Length %d >>\nstream\n%s\nendstream",
+		resources, len(content), content)
+}
+
+// A form that draws itself is only drawn once, and forms that each draw the next several times
+// stop multiplying after maxFormRuns.
+func TestPageText_FormFanOut(t *testing.T) {
+	font := "/Font << /F1 5 0 R >>"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /Self 6 0 R /Chain 7 0 R >> >> >>",
+		streamObject("/Self Do /Chain Do"),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		formObject("<< "+font+" /XObject << /Self 6 0 R >> >>",
+			"BT /F1 12 Tf 72 700 Td (self) Tj ET /Self Do /Self Do /Self Do /Self Do"),
+	}
+	// each form in the chain draws the next four times, and the last one shows text
+	const chain = 12
+	for i := 0; i < chain; i++ {
+		next := len(objects) + 2
+		if i == chain-1 {
+			objects = append(objects, formObject("<< "+font+" >>", "BT /F1 12 Tf 72 600 Td (leaf) Tj ET"))
+		} else {
+			objects = append(objects, formObject(fmt.Sprintf("<< /XObject << /Next %d 0 R >> >>", next),
+				"/Next Do /Next Do /Next Do /Next Do"))
+		}
+	}
+	doc, err := Parse(buildPDF(objects...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := doc.PageText(pages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := strings.Count(text, "self"); count != 1 {
+		t.Errorf("Expected the self-drawing form once, got %d times", count)
+	}
+	if count := strings.Count(text, "leaf"); count == 0 || count > maxFormRuns {
+		t.Errorf("Expected between 1 and %d leaves, got %d", maxFormRuns, count)
+	}
+}
+
+// Text drawn further along the same line gets a space, and text further down gets a line break,
+// however the text matrix is scaled.
+func TestPageText_Positions(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"BT /F1 1 Tf 12 0 0 12 72 700 Tm (a) Tj (b) Tj 3 0 Td (c) Tj ET", "ab c\n"},
+		{"BT /F1 12 Tf 72 700 Td (a) Tj 72 680 Td (b) Tj ET", "a\nb\n"},
+		{"BT /F1 12 Tf 72 700 Td (a) Tj -100 0 Td (b) Tj ET", "a b\n"},
+		{"BT /F1 12 Tf 2 Tw 72 700 Td (a b) Tj ET", "a b\n"},
+		{"BT /F1 12 Tf 20 TL 72 700 Td (a) Tj T* (b) Tj 1 2 (c) \" ET", "a\nb\nc\n"},
+		{"BT ET", ""},
+	}
+	for _, test := range tests {
+		doc, err := Parse(buildPDF(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+			streamObject(test.content),
+			"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+		))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages, err := doc.Pages()
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := doc.PageText(pages[0])
+		if err != nil {
+			t.Errorf("%s: %v", test.content, err)
+		} else if text != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.content, test.expected, text)
+		}
+	}
+}
+
+// CID font widths have the same limits as CMaps
+func TestFont_WidthEntryLimit(t *testing.T) {
+	ranges := maxCMapEntries/(maxCMapRange+1) + 1
+	w := new(strings.Builder)
+	for i := 0; i < ranges; i++ {
+		fmt.Fprintf(w, "%d %d 500 ", i<<16, i<<16+maxCMapRange)
+	}
+	doc, err := Parse(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /DescendantFonts [4 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /W ["+w.String()+"] >>",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := doc.font(Ref{3, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.widths) != maxCMapEntries {
+		t.Errorf("Expected %d widths, got %d", maxCMapEntries, len(f.widths))
+	}
+}
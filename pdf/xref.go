@@ -0,0 +1,328 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// Kinds of cross-reference entries
+const (
+	xrefFree       = 0
+	xrefInUse      = 1
+	xrefCompressed = 2
+)
+
+// Where to find an object. For compressed objects, offset is the number
+// of the object stream holding it, and gen is its index in that stream.
+type xrefEntry struct {
+	kind   int
+	offset int64
+	gen    int64
+}
+
+// startxref has to be within the last 1024 bytes of the file.
+const startxrefWindow = 1024
+
+// Read a chunk of the file. Short reads at the end of the file aren't errors.
+func (doc *Document) readAt(offset int64, length int64) ([]byte, error) {
+	if offset+length > doc.size {
+		length = doc.size - offset
+	}
+	if length < 0 {
+		return nil, errorf(offset, 0, "Offset past end of file")
+	}
+	buf := make([]byte, length)
+	n, err := doc.r.ReadAt(buf, offset)
+	if err != nil && !(err == io.EOF && int64(n) == length) {
+		return nil, &Error{Offset: offset, Err: err}
+	}
+	return buf, nil
+}
+
+// Find the offset of the last cross-reference section.
+func (doc *Document) findStartxref() (int64, error) {
+	start := doc.size - startxrefWindow
+	if start < 0 {
+		start = 0
+	}
+	buf, err := doc.readAt(start, doc.size-start)
+	if err != nil {
+		return 0, err
+	}
+	i := bytes.LastIndex(buf, []byte("startxref"))
+	if i < 0 {
+		return 0, errorf(start, 0, "No startxref")
+	}
+	fields := bytes.Fields(buf[i+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, errorf(start+int64(i), 0, "startxref without an offset")
+	}
+	offset, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil || offset < 0 || offset >= doc.size {
+		return 0, errorf(start+int64(i), 0, "Bad startxref offset %q", fields[0])
+	}
+	return offset, nil
+}
+
+// Read every cross-reference section, starting from the newest and following /Prev.
+// Each section and its trailer make a revision.
+func (doc *Document) readXrefChain(offset int64) error {
+	seen := map[int64]bool{}
+	revisions := []*Revision{}
+
+	for {
+		if seen[offset] {
+			return errorf(offset, 0, "Cross-reference sections loop back on themselves")
+		}
+		seen[offset] = true
+
+		entries, trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		rev := &Revision{
+			XrefOffset: offset,
+			Trailer:    trailer,
+			xref:       entries,
+		}
+
+		// hybrid files keep entries for objects in object streams in a separate xref stream
+		if xrefStm, ok := trailer["XRefStm"].(Int); ok {
+			entries, _, err := doc.readXrefSection(int64(xrefStm))
+			if err != nil {
+				return err
+			}
+			rev.merge(entries)
+		}
+
+		revisions = append(revisions, rev)
+		prev, ok := trailer["Prev"].(Int)
+		if !ok {
+			break
+		}
+		offset = int64(prev)
+	}
+
+	// oldest first, the order they appear in the file
+	for i := len(revisions) - 1; i >= 0; i-- {
+		doc.Revisions = append(doc.Revisions, revisions[i])
+	}
+	return nil
+}
+
+// Read a classic xref table or an xref stream.
+func (doc *Document) readXrefSection(offset int64) (map[int64]xrefEntry, Dict, error) {
+	head, err := doc.readAt(offset, 4)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(head) == "xref" {
+		return doc.readXrefTable(offset)
+	}
+	return doc.readXrefStream(offset)
+}
+
+// xref
+// 0 3
+// 0000000000 65535 f
+// 0000000017 00000 n
+// 0000000081 00000 n
+// trailer
+// << /Size 3 /Root 1 0 R >>
+// startxref
+func (doc *Document) readXrefTable(offset int64) (map[int64]xrefEntry, Dict, error) {
+	var buf []byte
+	trailerIdx, startxrefIdx := -1, -1
+	for window := int64(4096); trailerIdx < 0 || startxrefIdx < 0; window *= 2 {
+		var err error
+		if buf, err = doc.readAt(offset, window); err != nil {
+			return nil, nil, err
+		}
+		trailerIdx = bytes.Index(buf, []byte("trailer"))
+		if trailerIdx >= 0 {
+			startxrefIdx = bytes.Index(buf[trailerIdx:], []byte("startxref"))
+			if startxrefIdx >= 0 {
+				startxrefIdx += trailerIdx
+			}
+		}
+		if offset+window >= doc.size && (trailerIdx < 0 || startxrefIdx < 0) {
+			return nil, nil, errorf(offset, 0, "xref table has no trailer")
+		}
+	}
+
+	entries := map[int64]xrefEntry{}
+	fields := bytes.Fields(buf[len("xref"):trailerIdx])
+	for i := 0; i < len(fields); {
+		if i+2 > len(fields) {
+			return nil, nil, errorf(offset, 0, "Truncated xref subsection header")
+		}
+		start, err1 := strconv.ParseInt(string(fields[i]), 10, 64)
+		count, err2 := strconv.ParseInt(string(fields[i+1]), 10, 64)
+		if err1 != nil || err2 != nil || start < 0 || count < 0 {
+			return nil, nil, errorf(offset, 0, "Bad xref subsection header %q %q", fields[i], fields[i+1])
+		}
+		i += 2
+		if count > int64(len(fields)-i)/3 {
+			return nil, nil, errorf(offset, 0, "Truncated xref subsection starting at object %d", start)
+		}
+		for num := start; num < start+count; num++ {
+			entryOffset, err1 := strconv.ParseInt(string(fields[i]), 10, 64)
+			gen, err2 := strconv.ParseInt(string(fields[i+1]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return nil, nil, errorf(offset, num, "Bad xref entry %q %q", fields[i], fields[i+1])
+			}
+			switch string(fields[i+2]) {
+			case "n":
+				entries[num] = xrefEntry{xrefInUse, entryOffset, gen}
+			case "f":
+				entries[num] = xrefEntry{xrefFree, entryOffset, gen}
+			default:
+				return nil, nil, errorf(offset, num, "Bad xref entry type %q", fields[i+2])
+			}
+			i += 3
+		}
+	}
+
+	trailerStart := trailerIdx + len("trailer")
+	obj, err := doc.parseDirect(buf[trailerStart:startxrefIdx], offset+int64(trailerStart))
+	if err != nil {
+		return nil, nil, err
+	}
+	trailer, ok := obj.(Dict)
+	if !ok {
+		return nil, nil, errorf(offset+int64(trailerStart), 0, "Expected trailer dictionary, got %T", obj)
+	}
+	return entries, trailer, nil
+}
+
+// A PDF 1.5 cross-reference stream. Its dictionary doubles as the trailer.
+func (doc *Document) readXrefStream(offset int64) (map[int64]xrefEntry, Dict, error) {
+	obj, _, err := doc.readObject(offset, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	stream, ok := obj.(*Stream)
+	if !ok {
+		return nil, nil, errorf(offset, 0, "Expected xref table or stream, got %T", obj)
+	}
+	if streamType, _ := stream.Attrs["Type"].(Name); streamType != "XRef" {
+		return nil, nil, stream.errorf("Expected xref stream, got type %v", stream.Attrs["Type"])
+	}
+	data, err := stream.Decode()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// field widths in bytes
+	widthsArray, ok := stream.Attrs["W"].(Array)
+	if !ok || len(widthsArray) != 3 {
+		return nil, nil, stream.errorf("xref stream needs a /W array of 3 widths")
+	}
+	widths := [3]int{}
+	rowWidth := 0
+	for i, width := range widthsArray {
+		w, ok := width.(Int)
+		if !ok || w < 0 || w > 8 {
+			return nil, nil, stream.errorf("Bad xref stream field width %v", width)
+		}
+		widths[i] = int(w)
+		rowWidth += int(w)
+	}
+
+	// pairs of first object number and count; all objects by default
+	index := Array{Int(0), stream.Attrs["Size"]}
+	if indexArray, ok := stream.Attrs["Index"].(Array); ok {
+		index = indexArray
+	}
+	if len(index)%2 != 0 {
+		return nil, nil, stream.errorf("xref stream /Index needs pairs of numbers")
+	}
+
+	entries := map[int64]xrefEntry{}
+	row := 0
+	for i := 0; i < len(index); i += 2 {
+		start, startOk := index[i].(Int)
+		count, countOk := index[i+1].(Int)
+		if !startOk || !countOk {
+			return nil, nil, stream.errorf("Bad xref stream subsection %v %v", index[i], index[i+1])
+		}
+		for num := int64(start); num < int64(start+count); num++ {
+			if (row+1)*rowWidth > len(data) {
+				return nil, nil, stream.errorf("xref stream too short for object %d", num)
+			}
+			fields := [3]int64{xrefInUse, 0, 0}
+			pos := row * rowWidth
+			for f, width := range widths {
+				if width == 0 {
+					// missing fields take their defaults
+					continue
+				}
+				fields[f] = 0
+				for _, b := range data[pos : pos+width] {
+					fields[f] = fields[f]<<8 | int64(b)
+				}
+				pos += width
+			}
+			switch fields[0] {
+			case xrefFree, xrefInUse, xrefCompressed:
+				entries[num] = xrefEntry{int(fields[0]), fields[1], fields[2]}
+			default:
+				// the spec says unknown types are references to the null object,
+				// which also hides whatever older revisions had for this number
+				entries[num] = xrefEntry{xrefFree, 0, 0}
+			}
+			row++
+		}
+	}
+	return entries, stream.Attrs, nil
+}
+
+// Parse the object that starts at offset: num gen obj ... endobj
+// If want isn't nil, the object must be that one.
+// Only the object itself is read, up to its endobj.
+func (doc *Document) readObject(offset int64, want *Ref) (Object, Ref, error) {
+	if offset < 0 || offset >= doc.size {
+		return nil, Ref{}, errorf(offset, 0, "Object offset is outside the %d-byte file", doc.size)
+	}
+	// the caller decides whether the object belongs in doc.Objects
+	dp := &DocumentParser{Doc: doc, Objects: map[Ref]Object{}, single: true}
+	t := NewTokenizerAt(doc.r, offset, doc.size)
+	if err := parse(t, dp); err != nil {
+		return nil, Ref{}, err
+	}
+	if dp.count == 0 {
+		return nil, Ref{}, errorf(offset, 0, "Object has no endobj")
+	}
+	if dp.p.len() != 0 {
+		return nil, Ref{}, errorf(offset, dp.last.Num, "Expected a single object")
+	}
+	if want != nil && dp.last != *want {
+		return nil, dp.last, errorf(offset, want.Num, "Expected %s at offset, found %s", *want, dp.last)
+	}
+	doc.Warnings = append(doc.Warnings, t.warnings...)
+	return dp.Objects[dp.last], dp.last, nil
+}
+
+// Parse a single direct object, such as a trailer dictionary.
+func (doc *Document) parseDirect(buf []byte, offset int64) (Object, error) {
+	dp := &DocumentParser{Doc: doc}
+	if err := doc.parseAt(buf, offset, dp); err != nil {
+		return nil, err
+	}
+	if dp.p.len() != 1 {
+		return nil, errorf(offset, 0, "Expected a single object")
+	}
+	return dp.p.objectAt(0)
+}
+
+// Lex and parse a piece of the file, with offsets relative to the whole file.
+func (doc *Document) parseAt(buf []byte, offset int64, wh WordHandler) error {
+	t := NewTokenizer(bytes.NewReader(buf))
+	t.offset = offset
+	if err := parse(t, wh); err != nil {
+		return err
+	}
+	doc.Warnings = append(doc.Warnings, t.warnings...)
+	return nil
+}
@@ -0,0 +1,263 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Encode xref stream rows with the PNG Up predictor, as most writers do.
+func pngUp(rows [][]byte) []byte {
+	buf := new(bytes.Buffer)
+	prev := make([]byte, len(rows[0]))
+	for _, row := range rows {
+		buf.WriteByte(2)
+		for i, b := range row {
+			buf.WriteByte(b - prev[i])
+		}
+		prev = row
+	}
+	return buf.Bytes()
+}
+
+// Build a PDF 1.5 file whose objects are listed in an xref stream.
+func buildXrefStreamPDF(objects ...string) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.5\n")
+	rows := [][]byte{{0, 0, 0, 0xff}}
+	for i, obj := range objects {
+		offset := buf.Len()
+		rows = append(rows, []byte{1, byte(offset >> 8), byte(offset), 0})
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	num := len(objects) + 1
+	rows = append(rows, []byte{1, byte(xref >> 8), byte(xref), 0})
+
+	compressed := bytes.NewBuffer(deflate(pngUp(rows)))
+	fmt.Fprintf(buf, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 2 1] /Root 1 0 R"+
+		" /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n",
+		num, num+1, compressed.Len())
+	buf.Write(compressed.Bytes())
+	fmt.Fprintf(buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+func TestOpen_XrefStream(t *testing.T) {
+	doc, err := Parse(buildXrefStreamPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+		"<< /Type /Page /Parent 2 0 R >>",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", doc.Warnings)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected 2 pages, got %d", len(pages))
+	}
+}
+
+// Objects are only read when they're needed
+func TestOpen_OnDemand(t *testing.T) {
+	doc, err := Parse(buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"(never read)",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Pages(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc.Objects[Ref{3, 0}]; ok {
+		t.Errorf("Object 3 was read without being asked for")
+	}
+	obj, err := doc.Object(Ref{3, 0})
+	if err != nil || obj != String("never read") {
+		t.Errorf("Expected object 3 to be read on demand, got %v, %v", obj, err)
+	}
+}
+
+// An incremental update replaces one object and points back to the original xref table
+func TestOpen_Prev(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"(original)",
+	)
+	buf = appendUpdate(buf, update{Ref{3, 0}, "(updated)"})
+
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", doc.Warnings)
+	}
+	if len(doc.Revisions) != 2 {
+		t.Errorf("Expected 2 revisions, got %d", len(doc.Revisions))
+	}
+	obj, err := doc.Object(Ref{3, 0})
+	if err != nil || obj != String("updated") {
+		t.Errorf("Expected the updated object 3, got %v, %v", obj, err)
+	}
+	if _, err := doc.Catalog(); err != nil {
+		t.Errorf("Expected the catalog from the original section, got %v", err)
+	}
+}
+
+// Files with a broken startxref are scanned instead
+func TestOpen_Reconstruct(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+	)
+	buf = bytes.Replace(buf, []byte("startxref\n"), []byte("startxref\n9"), 1)
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 1 {
+		t.Errorf("Expected a warning, got %v", doc.Warnings)
+	}
+	if _, err := doc.Catalog(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Subsection counts so large that three fields each would overflow are truncated, not trusted
+func TestOpen_XrefCountOverflow(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+	)
+	buf = bytes.Replace(buf, []byte("xref\n0 3\n"), []byte("xref\n0 3074457345618258603\n"), 1)
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 1 || !strings.Contains(doc.Warnings[0].Error(), "Truncated xref subsection") {
+		t.Errorf("Expected a truncated xref warning, got %v", doc.Warnings)
+	}
+	if _, err := doc.Catalog(); err != nil {
+		t.Error(err)
+	}
+}
+
+// An uncompressed xref stream object with 1-byte types, 2-byte offsets, and 1-byte generations.
+func xrefStreamObject(num, xref int, rows [][]byte, attrs string) string {
+	data := bytes.Join(rows, nil)
+	return fmt.Sprintf("%d 0 obj\n<< /Type /XRef /W [1 2 1] %s /Length %d >>\nstream\n%s\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n",
+		num, attrs, len(data), data, xref)
+}
+
+func xrefRow(kind int, offset int, gen int) []byte {
+	return []byte{byte(kind), byte(offset >> 8), byte(offset), byte(gen)}
+}
+
+// An update whose xref stream has several /Index subsections, one of them with an unknown entry type
+func TestOpen_XrefStreamSubsections(t *testing.T) {
+	buf := buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"(original 3)",
+	)
+	prev := bytes.LastIndex(buf, []byte("\nxref\n")) + 1
+	ten := len(buf)
+	buf = append(buf, "10 0 obj\n(ten)\nendobj\n"...)
+	xref := len(buf)
+	buf = append(buf, xrefStreamObject(12, xref, [][]byte{
+		// unknown types are null, whatever older sections say
+		xrefRow(7, 0, 0),
+		xrefRow(xrefInUse, ten, 0),
+		xrefRow(xrefFree, 0, 0),
+		xrefRow(xrefInUse, xref, 0),
+	}, fmt.Sprintf("/Index [3 1 10 3] /Size 13 /Root 1 0 R /Prev %d", prev))...)
+
+	doc, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Revisions) != 2 {
+		t.Errorf("Expected 2 revisions, got %d", len(doc.Revisions))
+	}
+	tests := []struct {
+		ref      Ref
+		expected Object
+	}{
+		{Ref{3, 0}, Null{}},
+		{Ref{10, 0}, String("ten")},
+		{Ref{11, 0}, Null{}},
+	}
+	for _, test := range tests {
+		obj, err := doc.Object(test.ref)
+		if err != nil || obj != test.expected {
+			t.Errorf("Expected %v to be %v, got %v, %v", test.ref, test.expected, obj, err)
+		}
+	}
+	if _, err := doc.Catalog(); err != nil {
+		t.Errorf("Expected the catalog from the original section, got %v", err)
+	}
+}
+
+// A hybrid file: an xref table for older readers, with /XRefStm pointing to
+// an xref stream for the objects in object streams.
+func TestOpen_HybridXRefStm(t *testing.T) {
+	header := "4 0 "
+	objStmData := header + "(compressed four)"
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("%PDF-1.5\n")
+	offsets := []int{}
+	for i, obj := range []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		fmt.Sprintf("<< /Type /ObjStm /N 1 /First %d /Length %d >>\nstream\n%s\nendstream",
+			len(header), len(objStmData), objStmData),
+	} {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xrefStm := buf.Len()
+	rows := [][]byte{xrefRow(xrefCompressed, 3, 0), xrefRow(xrefInUse, xrefStm, 0)}
+	data := bytes.Join(rows, nil)
+	fmt.Fprintf(buf, "5 0 obj\n<< /Type /XRef /W [1 2 1] /Index [4 2] /Size 6 /Length %d >>\nstream\n%s\nendstream\nendobj\n",
+		len(data), data)
+
+	// the table leaves out object 4
+	xref := buf.Len()
+	buf.WriteString("xref\n0 4\n0000000000 65535 f \n")
+	for _, offset := range offsets {
+		fmt.Fprintf(buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(buf, "5 1\n%010d 00000 n \n", xrefStm)
+	fmt.Fprintf(buf, "trailer\n<< /Size 6 /Root 1 0 R /XRefStm %d >>\nstartxref\n%d\n%%%%EOF\n", xrefStm, xref)
+
+	doc, err := Parse(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", doc.Warnings)
+	}
+	if len(doc.Revisions) != 1 {
+		t.Errorf("Expected the xref stream to be part of the same revision, got %d revisions", len(doc.Revisions))
+	}
+	obj, err := doc.Object(Ref{4, 0})
+	if err != nil || obj != String("compressed four") {
+		t.Errorf("Expected object 4 from the object stream, got %v, %v", obj, err)
+	}
+	if _, err := doc.Catalog(); err != nil {
+		t.Error(err)
+	}
+}